@@ -0,0 +1,191 @@
+package apierror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"net/http"
+	"time"
+)
+
+// Code is the stable, machine-readable identifier of an error. Clients may
+// switch on it; it never changes once published.
+type Code string
+
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeValidation       Code = "validation_failed"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeRouteNotFound    Code = "route_not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeUnprocessable    Code = "unprocessable_entity"
+	CodeTooManyRequests  Code = "rate_limited"
+	CodeTimeout          Code = "timeout"
+	CodeUnavailable      Code = "service_unavailable"
+	CodeInternal         Code = "internal_error"
+
+	// CodeIdempotencyKeyReused rejects an Idempotency-Key sent again with a
+	// different request.
+	CodeIdempotencyKeyReused Code = "idempotency_key_reused"
+)
+
+// Error is an error with the HTTP status and code it is reported with.
+type Error struct {
+	Code    Code
+	Status  int
+	Message string
+	Err     error
+	// Fields lists the offending fields of a validation error.
+	Fields []FieldError
+	// RetryAfter is sent as the Retry-After header of unavailable and rate
+	// limited responses.
+	RetryAfter time.Duration
+}
+
+// FieldError describes why one field of the request was rejected. Field is
+// the path of the field as the client sent it, such as ingredients[0].title.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(code Code, status int, message string) *Error {
+	return &Error{
+		Code:    code,
+		Status:  status,
+		Message: message,
+	}
+}
+
+func BadRequest(format string, a ...any) *Error {
+	return New(CodeBadRequest, http.StatusBadRequest, fmt.Sprintf(format, a...))
+}
+
+func Validation(format string, a ...any) *Error {
+	return New(CodeValidation, http.StatusBadRequest, fmt.Sprintf(format, a...))
+}
+
+// Invalid reports the fields that failed validation.
+func Invalid(fields ...FieldError) *Error {
+	e := Validation("request has %d invalid field(s)", len(fields))
+	e.Fields = fields
+	return e
+}
+
+func NotFound(format string, a ...any) *Error {
+	return New(CodeNotFound, http.StatusNotFound, fmt.Sprintf(format, a...))
+}
+
+func Conflict(format string, a ...any) *Error {
+	return New(CodeConflict, http.StatusConflict, fmt.Sprintf(format, a...))
+}
+
+func Unauthorized(format string, a ...any) *Error {
+	return New(CodeUnauthorized, http.StatusUnauthorized, fmt.Sprintf(format, a...))
+}
+
+func Forbidden(format string, a ...any) *Error {
+	return New(CodeForbidden, http.StatusForbidden, fmt.Sprintf(format, a...))
+}
+
+// TooManyRequests rejects a request over the rate limit of the client, who
+// may try again after retryAfter.
+func TooManyRequests(retryAfter time.Duration, format string, a ...any) *Error {
+	e := New(CodeTooManyRequests, http.StatusTooManyRequests, fmt.Sprintf(format, a...))
+	e.RetryAfter = retryAfter
+	return e
+}
+
+// WithStatus wraps err so that it is reported with the status and the code
+// that goes with it.
+func WithStatus(status int, err error) *Error {
+	return &Error{
+		Code:    codeForStatus(status),
+		Status:  status,
+		Message: err.Error(),
+		Err:     err,
+	}
+}
+
+func codeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	default:
+		if status >= 400 && status < 500 {
+			return CodeBadRequest
+		}
+		return CodeInternal
+	}
+}
+
+// From classifies any error. Errors created by this package keep their code
+// and status, database errors are mapped to the matching client or server
+// error, and everything else is an internal error.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	// Such as a resilience.OpenError of a circuit breaker.
+	var retryable interface{ RetryAfter() time.Duration }
+	if errors.As(err, &retryable) {
+		return &Error{Code: CodeUnavailable, Status: http.StatusServiceUnavailable, Message: "database is unavailable, retry later", Err: err, RetryAfter: retryable.RetryAfter()}
+	}
+
+	switch {
+	case errors.Is(err, gocb.ErrDocumentNotFound):
+		return &Error{Code: CodeNotFound, Status: http.StatusNotFound, Message: "document not found", Err: err}
+	case errors.Is(err, gocb.ErrInvalidArgument):
+		return &Error{Code: CodeBadRequest, Status: http.StatusBadRequest, Message: err.Error(), Err: err}
+	case errors.Is(err, gocb.ErrCasMismatch),
+		errors.Is(err, gocb.ErrDocumentExists),
+		errors.Is(err, gocb.ErrDocumentLocked):
+		return &Error{Code: CodeConflict, Status: http.StatusConflict, Message: "document was changed concurrently, retry the request", Err: err}
+	case errors.Is(err, gocb.ErrTimeout),
+		errors.Is(err, context.DeadlineExceeded):
+		return &Error{Code: CodeTimeout, Status: http.StatusGatewayTimeout, Message: "database did not respond in time", Err: err}
+	case errors.Is(err, gocb.ErrAuthenticationFailure):
+		return &Error{Code: CodeUnavailable, Status: http.StatusServiceUnavailable, Message: "database rejected the service credentials", Err: err}
+	case errors.Is(err, gocb.ErrServiceNotAvailable),
+		errors.Is(err, gocb.ErrTemporaryFailure),
+		errors.Is(err, gocb.ErrOverload):
+		return &Error{Code: CodeUnavailable, Status: http.StatusServiceUnavailable, Message: "database is temporarily unavailable", Err: err}
+	default:
+		return &Error{Code: CodeInternal, Status: http.StatusInternalServerError, Message: "internal server error", Err: err}
+	}
+}
@@ -0,0 +1,110 @@
+package apierror
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	HeaderRequestID = log.HeaderRequestID
+	ContentType     = "application/problem+json"
+)
+
+// Problem is an RFC 7807 problem details response, extended with the error
+// code and the ID of the request that failed.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+	// Errors holds the field-level details of validation failures.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Problem returns the problem details for the error. Server errors only
+// expose the generic message; the cause is logged instead.
+func (e *Error) Problem(requestID string, instance string) *Problem {
+	return &Problem{
+		Type:      "urn:plan-buy-eat:problem:" + string(e.Code),
+		Title:     titles[e.Code],
+		Status:    e.Status,
+		Detail:    e.Message,
+		Instance:  instance,
+		Code:      e.Code,
+		RequestID: requestID,
+		Errors:    e.Fields,
+	}
+}
+
+var titles = map[Code]string{
+	CodeBadRequest:       "Bad Request",
+	CodeValidation:       "Validation Failed",
+	CodeUnauthorized:     "Unauthorized",
+	CodeForbidden:        "Forbidden",
+	CodeNotFound:         "Not Found",
+	CodeRouteNotFound:    "Not Found",
+	CodeMethodNotAllowed: "Method Not Allowed",
+	CodeConflict:         "Conflict",
+	CodeUnprocessable:    "Unprocessable Entity",
+	CodeTooManyRequests:  "Too Many Requests",
+	CodeTimeout:          "Timeout",
+	CodeUnavailable:      "Service Unavailable",
+	CodeInternal:         "Internal Server Error",
+
+	CodeIdempotencyKeyReused: "Unprocessable Entity",
+}
+
+// Middleware turns errors recorded with c.Error into problem+json responses.
+// It must be registered before the handlers and after log.Middleware, which
+// assigns the request IDs.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 {
+			return
+		}
+		last := c.Errors.Last().Err
+		apiErr := From(last)
+		ctx := c.Request.Context()
+		event := log.Ctx(ctx).Info()
+		if apiErr.Status >= 500 {
+			event = log.Ctx(ctx).Error()
+		}
+		event.Err(last).Str("code", string(apiErr.Code)).Int("status", apiErr.Status).
+			Msgf("%s %s", c.Request.Method, c.Request.URL.Path)
+
+		if c.Writer.Written() {
+			return
+		}
+		Write(c, last)
+	}
+}
+
+// Write writes the problem response of the error. Middleware does this for
+// the errors of the handlers; middlewares that need the response before it,
+// such as idempotency.Middleware, call it themselves.
+func Write(c *gin.Context, err error) {
+	apiErr := From(err)
+	c.Header("Content-Type", ContentType)
+	if apiErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(apiErr.RetryAfter.Seconds()))))
+	}
+	c.JSON(apiErr.Status, apiErr.Problem(log.RequestID(c.Request.Context()), c.Request.URL.Path))
+}
+
+// NoRoute reports unknown routes as problems.
+func NoRoute(c *gin.Context) {
+	_ = c.Error(New(CodeRouteNotFound, http.StatusNotFound, "page not found"))
+}
+
+// NoMethod reports unsupported methods as problems.
+func NoMethod(c *gin.Context) {
+	_ = c.Error(New(CodeMethodNotAllowed, http.StatusMethodNotAllowed, "method not allowed"))
+}
@@ -0,0 +1,125 @@
+// Package auth authenticates the callers of the REST and gRPC APIs by bearer
+// token. Both APIs use the same Authenticator, so a token works for either.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/log"
+	"strings"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID string
+}
+
+// Anonymous is the caller of every request while authentication is disabled.
+var Anonymous = &Principal{UserID: "anonymous"}
+
+type Authenticator interface {
+	// Authenticate returns the caller the value of an Authorization header
+	// belongs to.
+	Authenticate(authorization string) (principal *Principal, err error)
+	// Users returns the IDs of the users that have a token, in the order of
+	// the tokens and without repeats.
+	Users() (userIDs []string)
+}
+
+type token struct {
+	secret []byte
+	userID string
+}
+
+type tokenAuthenticator struct {
+	tokens []token
+}
+
+// NewAuthenticator returns an Authenticator accepting the tokens, given as
+// token=user pairs separated by commas. Without tokens every request is
+// Anonymous.
+func NewAuthenticator(tokens string) (Authenticator, error) {
+	a := &tokenAuthenticator{}
+	for _, pair := range strings.Split(tokens, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		secret, userID, ok := strings.Cut(pair, "=")
+		if !ok || secret == "" || userID == "" {
+			return nil, fmt.Errorf("auth: token %d is not a token=user pair", len(a.tokens)+1)
+		}
+		a.tokens = append(a.tokens, token{secret: []byte(secret), userID: userID})
+	}
+	return a, nil
+}
+
+func (a *tokenAuthenticator) Authenticate(authorization string) (principal *Principal, err error) {
+	if len(a.tokens) == 0 {
+		return Anonymous, nil
+	}
+	scheme, secret, _ := strings.Cut(authorization, " ")
+	if !strings.EqualFold(scheme, "Bearer") || secret == "" {
+		return nil, apierror.Unauthorized("missing bearer token")
+	}
+	// Compare with every token so that the time taken does not tell which
+	// one matched.
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t.secret, []byte(secret)) == 1 && principal == nil {
+			principal = &Principal{UserID: t.userID}
+		}
+	}
+	if principal == nil {
+		return nil, apierror.Unauthorized("invalid bearer token")
+	}
+	return
+}
+
+func (a *tokenAuthenticator) Users() (userIDs []string) {
+	userIDs = []string{}
+	seen := map[string]bool{}
+	for _, t := range a.tokens {
+		if !seen[t.userID] {
+			seen[t.userID] = true
+			userIDs = append(userIDs, t.userID)
+		}
+	}
+	return
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal, whose user ID is
+// added to the request logger.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	ctx = log.With(ctx, func(c zerolog.Context) zerolog.Context {
+		return c.Str("userId", principal.UserID)
+	})
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal of the request, nil outside of one.
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(contextKey{}).(*Principal)
+	return principal
+}
+
+// Middleware authenticates the requests of the routes it is used on and
+// stores the principal in the request context.
+func Middleware(a Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := a.Authenticate(c.GetHeader("Authorization"))
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="shoppinglist"`)
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), principal))
+		c.Next()
+	}
+}
@@ -0,0 +1,106 @@
+// Package backup writes the documents of the data collections into a
+// portable archive and restores them, into Couchbase or the in-memory
+// backend.
+//
+// An archive is gzip compressed NDJSON. The first line holds the Manifest,
+// every document is a line of its own, and the last line counts the
+// documents per collection, so that a truncated archive is noticed:
+//
+//	{"manifest":{"format":"shoppinglist-backup","version":1,...}}
+//	{"collection":"items","id":"item:Milk","doc":{"title":"Milk",...}}
+//	{"end":{"items":1}}
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/log"
+	"io"
+	"time"
+)
+
+const (
+	// Format names the archives of this package.
+	Format = "shoppinglist-backup"
+	// Version is the version of the archive format. Restore reads archives
+	// up to this version.
+	Version = 1
+)
+
+// Manifest describes an archive.
+type Manifest struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// Created is when the backup started, in Unix milliseconds.
+	Created int64 `json:"created"`
+	// Service is the version of the service that wrote the archive.
+	Service     string   `json:"service,omitempty"`
+	Backend     string   `json:"backend"`
+	Bucket      string   `json:"bucket,omitempty"`
+	Collections []string `json:"collections"`
+}
+
+// line is a line of an archive; one of its parts is set.
+type line struct {
+	Manifest   *Manifest       `json:"manifest,omitempty"`
+	Collection string          `json:"collection,omitempty"`
+	ID         string          `json:"id,omitempty"`
+	Doc        json.RawMessage `json:"doc,omitempty"`
+	End        map[string]int  `json:"end,omitempty"`
+}
+
+// Backup writes the documents of the collections, all DataCollections if
+// none are given, to w as an archive. It returns the number of documents
+// per collection.
+func Backup(ctx context.Context, w io.Writer, collections []string) (counts map[string]int, err error) {
+	if len(collections) == 0 {
+		collections = db.DataCollections
+	}
+	conf := config.Get()
+	manifest := &Manifest{
+		Format:      Format,
+		Version:     Version,
+		Created:     time.Now().UTC().UnixMilli(),
+		Service:     conf.Service.Version,
+		Backend:     conf.Database.Backend,
+		Collections: collections,
+	}
+	if manifest.Backend != db.BackendMemory {
+		manifest.Bucket = conf.Database.Bucket
+	}
+
+	compressed := gzip.NewWriter(w)
+	buffered := bufio.NewWriter(compressed)
+	encoder := json.NewEncoder(buffered)
+	if err = encoder.Encode(line{Manifest: manifest}); err != nil {
+		return nil, err
+	}
+	counts = map[string]int{}
+	for _, collection := range collections {
+		documentsDB, err := db.NewDocumentsDB(ctx, collection)
+		if err != nil {
+			return nil, fmt.Errorf("getting db: %w", err)
+		}
+		counts[collection] = 0
+		err = documentsDB.ScanDocuments(ctx, func(id string, body json.RawMessage) error {
+			counts[collection]++
+			return encoder.Encode(line{Collection: collection, ID: id, Doc: body})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("backing up %s: %w", collection, err)
+		}
+		log.Ctx(ctx).Info().Str("collection", collection).Int("documents", counts[collection]).Msg("Backed up")
+	}
+	if err = encoder.Encode(line{End: counts}); err != nil {
+		return nil, err
+	}
+	if err = buffered.Flush(); err != nil {
+		return nil, err
+	}
+	return counts, compressed.Close()
+}
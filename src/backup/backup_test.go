@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	config.MustInit([]string{"-database.backend=memory"})
+	os.Exit(m.Run())
+}
+
+// document writes a document with a key of its own, since the in-memory
+// collections are shared by the process.
+func document(t *testing.T, collection string, body string) (documentsDB db.DocumentsDB, id string) {
+	t.Helper()
+	documentsDB, err := db.NewDocumentsDB(context.Background(), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = collection + ":" + xid.New().String()
+	if err = documentsDB.UpsertDocument(context.Background(), id, json.RawMessage(body)); err != nil {
+		t.Fatal(err)
+	}
+	return documentsDB, id
+}
+
+func backup(t *testing.T, collections []string) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	if _, err := Backup(context.Background(), &archive, collections); err != nil {
+		t.Fatal(err)
+	}
+	return archive.Bytes()
+}
+
+// title returns the title of a document. Items are stored as models.Item,
+// so their bodies do not come back byte for byte.
+func title(t *testing.T, documentsDB db.DocumentsDB, id string) string {
+	t.Helper()
+	body, err := documentsDB.GetDocument(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document struct {
+		Title string `json:"title"`
+	}
+	if err = json.Unmarshal(body, &document); err != nil {
+		t.Fatal(err)
+	}
+	return document.Title
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	itemsDB, itemID := document(t, "items", `{"title":"Milk","updated":2}`)
+	pantryDB, pantryID := document(t, "pantry", `{"title":"Flour","updated":2}`)
+	archive := backup(t, []string{"items", "pantry"})
+
+	// Skip keeps what is there and creates what is missing.
+	pantry, err := db.NewPantryDB(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pantry.DeletePantryItem(ctx, pantryID); err != nil {
+		t.Fatal(err)
+	}
+	if err = itemsDB.UpsertDocument(ctx, itemID, json.RawMessage(`{"title":"Oat milk","updated":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	manifest, results, err := Restore(ctx, bytes.NewReader(archive), Options{Policy: Skip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Backend != db.BackendMemory || len(manifest.Collections) != 2 {
+		t.Errorf("manifest %+v", manifest)
+	}
+	if results["items"].Created != 0 || results["items"].Skipped == 0 {
+		t.Errorf("items %+v, want all skipped", results["items"])
+	}
+	if results["pantry"].Created != 1 {
+		t.Errorf("pantry %+v, want one created", results["pantry"])
+	}
+	if got := title(t, pantryDB, pantryID); got != "Flour" {
+		t.Errorf("skip restored the pantry item as %q", got)
+	}
+	if got := title(t, itemsDB, itemID); got != "Oat milk" {
+		t.Errorf("skip replaced the item with %q", got)
+	}
+
+	// Newer keeps the item, which was updated after the backup.
+	if _, _, err = Restore(ctx, bytes.NewReader(archive), Options{Policy: Newer}); err != nil {
+		t.Fatal(err)
+	}
+	if got := title(t, itemsDB, itemID); got != "Oat milk" {
+		t.Errorf("newer replaced the item with %q", got)
+	}
+
+	// Overwrite puts the backed up item back, limited to the collection.
+	if err = pantryDB.UpsertDocument(ctx, pantryID, json.RawMessage(`{"title":"Rye flour","updated":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	_, results, err = Restore(ctx, bytes.NewReader(archive), Options{Policy: Overwrite, Collections: []string{"items"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := results["pantry"]; ok {
+		t.Errorf("restored the pantry, which was not asked for")
+	}
+	if got := title(t, itemsDB, itemID); got != "Milk" {
+		t.Errorf("overwrite left the item at %q", got)
+	}
+	if got := title(t, pantryDB, pantryID); got != "Rye flour" {
+		t.Errorf("overwrite replaced the pantry item with %q", got)
+	}
+}
+
+func TestRestoreTruncated(t *testing.T) {
+	document(t, "items", `{"title":"Bread"}`)
+	archive, err := gzip.NewReader(bytes.NewReader(backup(t, []string{"items"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := io.ReadAll(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the end line, which counts the documents.
+	lines = bytes.TrimSuffix(lines, []byte("\n"))
+	lines = lines[:bytes.LastIndexByte(lines, '\n')+1]
+	var truncated bytes.Buffer
+	compressed := gzip.NewWriter(&truncated)
+	if _, err = compressed.Write(lines); err != nil {
+		t.Fatal(err)
+	}
+	if err = compressed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Restore(context.Background(), &truncated, Options{}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("got %v, want %v", err, ErrTruncated)
+	}
+}
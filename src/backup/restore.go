@@ -0,0 +1,164 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/log"
+	"io"
+)
+
+// Policy decides what happens to a backed up document whose ID is taken.
+type Policy string
+
+const (
+	// Skip keeps the existing document.
+	Skip Policy = "skip"
+	// Overwrite replaces the existing document.
+	Overwrite Policy = "overwrite"
+	// Newer replaces the existing document if the backed up one was updated
+	// later, by their updated fields. Documents without one count as never
+	// updated.
+	Newer Policy = "newer"
+)
+
+// Policies lists the policies Restore accepts.
+var Policies = []Policy{Skip, Overwrite, Newer}
+
+// Options tune Restore.
+type Options struct {
+	Policy Policy
+	// Collections restores only the documents of these collections, or all
+	// of the archive if empty.
+	Collections []string
+}
+
+// Result counts what Restore did with the documents of a collection.
+type Result struct {
+	// Created documents did not exist, Replaced ones did and were
+	// overwritten, and Skipped ones were kept by the policy.
+	Created  int `json:"created"`
+	Replaced int `json:"replaced"`
+	Skipped  int `json:"skipped"`
+}
+
+// ErrTruncated is returned for archives that end before their last line.
+var ErrTruncated = errors.New("the archive is truncated")
+
+// Restore reads an archive written by Backup and writes its documents into
+// the configured backend. It stops at the first document it cannot write and
+// returns the results so far. The documents before a truncation or a
+// mismatched count are restored when the error is returned.
+func Restore(ctx context.Context, r io.Reader, opts Options) (manifest *Manifest, results map[string]*Result, err error) {
+	switch opts.Policy {
+	case Skip, Overwrite, Newer:
+	case "":
+		opts.Policy = Skip
+	default:
+		return nil, nil, fmt.Errorf("unknown conflict policy %q", opts.Policy)
+	}
+	wanted := map[string]bool{}
+	for _, collection := range opts.Collections {
+		wanted[collection] = true
+	}
+
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the archive is not gzip compressed: %w", err)
+	}
+	decoder := json.NewDecoder(compressed)
+	var first line
+	if err = decoder.Decode(&first); err != nil || first.Manifest == nil || first.Manifest.Format != Format {
+		return nil, nil, fmt.Errorf("the archive does not start with a %s manifest", Format)
+	}
+	manifest = first.Manifest
+	if manifest.Version > Version {
+		return manifest, nil, fmt.Errorf("the archive has version %d, this build reads up to %d", manifest.Version, Version)
+	}
+
+	results = map[string]*Result{}
+	read := map[string]int{}
+	documentsDBs := map[string]db.DocumentsDB{}
+	for {
+		var next line
+		err = decoder.Decode(&next)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return manifest, results, ErrTruncated
+		}
+		if err != nil {
+			return manifest, results, fmt.Errorf("reading the archive: %w", err)
+		}
+		if next.End != nil {
+			for collection, count := range next.End {
+				if read[collection] != count {
+					return manifest, results, fmt.Errorf("the archive holds %d documents of %s, not %d", read[collection], collection, count)
+				}
+			}
+			return manifest, results, nil
+		}
+
+		read[next.Collection]++
+		if len(wanted) > 0 && !wanted[next.Collection] {
+			continue
+		}
+		documentsDB, ok := documentsDBs[next.Collection]
+		if !ok {
+			if documentsDB, err = db.NewDocumentsDB(ctx, next.Collection); err != nil {
+				return manifest, results, fmt.Errorf("getting db: %w", err)
+			}
+			documentsDBs[next.Collection] = documentsDB
+			results[next.Collection] = &Result{}
+			log.Ctx(ctx).Info().Str("collection", next.Collection).Str("policy", string(opts.Policy)).Msg("Restoring")
+		}
+		if err = restore(ctx, documentsDB, opts.Policy, next.ID, next.Doc, results[next.Collection]); err != nil {
+			return manifest, results, fmt.Errorf("restoring %s %s: %w", next.Collection, next.ID, err)
+		}
+	}
+}
+
+// restore writes one document according to the policy.
+func restore(ctx context.Context, documentsDB db.DocumentsDB, policy Policy, id string, body json.RawMessage, result *Result) error {
+	err := documentsDB.InsertDocument(ctx, id, body)
+	if err == nil {
+		result.Created++
+		return nil
+	}
+	if !errors.Is(err, gocb.ErrDocumentExists) {
+		return err
+	}
+
+	switch policy {
+	case Overwrite:
+	case Newer:
+		existing, err := documentsDB.GetDocument(ctx, id)
+		if err != nil {
+			return err
+		}
+		if updated(body) <= updated(existing) {
+			result.Skipped++
+			return nil
+		}
+	default:
+		result.Skipped++
+		return nil
+	}
+	if err = documentsDB.UpsertDocument(ctx, id, body); err != nil {
+		return err
+	}
+	result.Replaced++
+	return nil
+}
+
+// updated returns the updated field of a document, in Unix milliseconds, or
+// zero if it has none.
+func updated(body json.RawMessage) int64 {
+	var times struct {
+		Updated int64 `json:"updated"`
+	}
+	_ = json.Unmarshal(body, &times)
+	return times.Updated
+}
@@ -1,41 +1,287 @@
+// Package config holds the settings of the services. They are loaded at
+// startup from defaults, a YAML file, the environment and the command line,
+// see Load, and validated before the service starts. Settings tagged live can
+// be changed while serving, see Reload.
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/shoppinglist/log"
 	"os"
-	"sync"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// Config is the configuration of a service. Every setting has a YAML key, an
+// environment variable and a flag named by its YAML path, such as
+// server.port, PORT and -server.port. Settings tagged secret can be read from
+// files as well. A Config is never modified once loaded; reloading replaces
+// it, so code that needs live settings calls Get rather than keeping one.
 type Config struct {
-	ServiceName    string
-	HostName       string
-	ServiceVersion string
-	Port           string
+	Service     Service     `yaml:"service"`
+	Server      Server      `yaml:"server"`
+	Database    Database    `yaml:"database"`
+	CORS        CORS        `yaml:"cors"`
+	Auth        Auth        `yaml:"auth"`
+	Log         Log         `yaml:"log"`
+	Tracing     Tracing     `yaml:"tracing"`
+	Expiry      Expiry      `yaml:"expiry"`
+	Webhooks    Webhooks    `yaml:"webhooks"`
+	Features    Features    `yaml:"features"`
+	Health      Health      `yaml:"health"`
+	RateLimit   RateLimit   `yaml:"rateLimit"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	Fixtures    Fixtures    `yaml:"fixtures"`
+
+	// file is the YAML file the configuration was loaded from.
+	file string
 }
 
-var instance *Config
-var mu sync.Mutex
+type Service struct {
+	Name     string `yaml:"name" env:"SERVICE_NAME"`
+	Version  string `yaml:"version" env:"SERVICE_VERSION"`
+	HostName string `yaml:"hostName" env:"HOSTNAME" default:"localhost"`
+}
 
-func Get() *Config {
-	mu.Lock()
-	defer mu.Unlock()
-	if instance != nil {
-		return instance
-	}
+type Server struct {
+	Port string `yaml:"port" env:"PORT" default:"80" binding:"required,numeric"`
+	// GRPCPort is the port of the gRPC API. Empty disables it.
+	GRPCPort string `yaml:"grpcPort" env:"GRPC_PORT" default:"9090" binding:"omitempty,numeric"`
+	// DrainDelay is how long /readyz fails before the server stops accepting
+	// connections on shutdown, so that load balancers take it out first.
+	DrainDelay time.Duration `yaml:"drainDelay" env:"SHUTDOWN_DRAIN_DELAY" default:"0s" binding:"gte=0"`
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies
+	// whose X-Forwarded-For header gives the client address, which the
+	// per-IP rate limit counts. By default no proxy is trusted and the
+	// address of the connection is used.
+	TrustedProxies []string `yaml:"trustedProxies" env:"TRUSTED_PROXIES" binding:"dive,cidr|ip"`
+}
+
+type Database struct {
+	// Backend is couchbase, or memory to keep all collections in the
+	// process for local development and tests, see db.BackendMemory.
+	Backend          string        `yaml:"backend" env:"DB_BACKEND" default:"couchbase" binding:"oneof=couchbase memory"`
+	ConnectionString string        `yaml:"connectionString" env:"COUCHBASE_CONNECTION_STRING" binding:"required_if=Backend couchbase"`
+	Bucket           string        `yaml:"bucket" env:"COUCHBASE_BUCKET" binding:"required_if=Backend couchbase"`
+	Username         string        `yaml:"username" env:"COUCHBASE_USERNAME" binding:"required_if=Backend couchbase"`
+	Password         string        `yaml:"password" env:"COUCHBASE_PASSWORD" secret:"true"`
+	ConnectTimeout   time.Duration `yaml:"connectTimeout" env:"COUCHBASE_CONNECT_TIMEOUT" default:"5s" binding:"gt=0"`
+	// OperationTimeout bounds every key-value operation, QueryTimeout every
+	// N1QL query.
+	OperationTimeout time.Duration `yaml:"operationTimeout" env:"COUCHBASE_OPERATION_TIMEOUT" default:"2.5s" binding:"gt=0" live:"true"`
+	QueryTimeout     time.Duration `yaml:"queryTimeout" env:"COUCHBASE_QUERY_TIMEOUT" default:"10s" binding:"gt=0" live:"true"`
+	// Retries is how often idempotent operations are repeated after a
+	// transient failure, waiting up to RetryBackoff doubled per attempt.
+	Retries      int           `yaml:"retries" env:"COUCHBASE_RETRIES" default:"2" binding:"gte=0,lte=10" live:"true"`
+	RetryBackoff time.Duration `yaml:"retryBackoff" env:"COUCHBASE_RETRY_BACKOFF" default:"100ms" binding:"gte=0" live:"true"`
+	// BreakerFailures consecutive failures open the circuit breaker, which
+	// fails the calls fast for BreakerCooldown before it tries again.
+	BreakerFailures int           `yaml:"breakerFailures" env:"COUCHBASE_BREAKER_FAILURES" default:"5" binding:"gte=1"`
+	BreakerCooldown time.Duration `yaml:"breakerCooldown" env:"COUCHBASE_BREAKER_COOLDOWN" default:"30s" binding:"gt=0"`
+}
+
+type CORS struct {
+	AllowOrigins []string      `yaml:"allowOrigins" env:"CORS_ALLOW_ORIGINS" default:"http://localhost:5173,https://shoppinglist.turevskiy.kharkiv.ua" binding:"dive,httpurl" live:"true"`
+	MaxAge       time.Duration `yaml:"maxAge" env:"CORS_MAX_AGE" default:"12h" binding:"gte=0"`
+}
 
-	instance = &Config{
-		ServiceName:    getValue("SERVICE_NAME", ""),
-		HostName:       getValue("HOSTNAME", "localhost"),
-		ServiceVersion: getValue("SERVICE_VERSION", ""),
-		Port:           getValue("PORT", "80"),
+// Allows tells whether the origin may call the APIs from a browser.
+func (c *CORS) Allows(origin string) bool {
+	for _, allowed := range c.AllowOrigins {
+		if allowed == origin {
+			return true
+		}
 	}
+	return false
+}
+
+type Auth struct {
+	// Tokens lists the accepted bearer tokens as token=user pairs separated
+	// by commas. Empty disables authentication.
+	Tokens string `yaml:"tokens" env:"AUTH_TOKENS" secret:"true"`
+	// Admins and Viewers list the users with the admin and the read-only
+	// viewer role, see policy.Roles. Everybody else is a plain user.
+	Admins  []string `yaml:"admins" env:"AUTH_ADMINS" live:"true"`
+	Viewers []string `yaml:"viewers" env:"AUTH_VIEWERS" live:"true"`
+}
+
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" default:"info" binding:"oneof=trace debug info warn error" live:"true"`
+	Format string `yaml:"format" env:"LOG_FORMAT" default:"json" binding:"oneof=json console" live:"true"`
+}
+
+type Tracing struct {
+	// Exporter is where spans go, see tracing.Setup.
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER" default:"none" binding:"oneof=otlp stdout none"`
+}
+
+type Expiry struct {
+	// CheckInterval is how often the expiry reminder job runs. Zero disables
+	// the job.
+	CheckInterval time.Duration `yaml:"checkInterval" env:"EXPIRY_CHECK_INTERVAL" default:"0s" binding:"gte=0"`
+	WithinDays    int           `yaml:"withinDays" env:"EXPIRY_WITHIN_DAYS" default:"2" binding:"gte=0,lte=365"`
+	Notifier      string        `yaml:"notifier" env:"EXPIRY_NOTIFIER" default:"log" binding:"oneof=log webhook"`
+	WebhookURL    string        `yaml:"webhookUrl" env:"EXPIRY_WEBHOOK_URL" binding:"required_if=Notifier webhook,omitempty,httpurl"`
+}
+
+type Webhooks struct {
+	// DispatchInterval is how often queued webhook deliveries are sent. Zero
+	// disables the dispatcher on this replica.
+	DispatchInterval time.Duration `yaml:"dispatchInterval" env:"WEBHOOK_DISPATCH_INTERVAL" default:"5s" binding:"gte=0"`
+	MaxAttempts      int           `yaml:"maxAttempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"8" binding:"gte=1"`
+	// AllowedNetworks are the CIDR ranges of internal receivers, such as
+	// other services of the cluster. Deliveries to loopback, link-local and
+	// private addresses outside them are refused, see webhook.NewClient.
+	AllowedNetworks []string `yaml:"allowedNetworks" env:"WEBHOOK_ALLOWED_NETWORKS" binding:"dive,cidr"`
+}
+
+// Features switches optional parts of the APIs on and off.
+type Features struct {
+	GraphQL bool `yaml:"graphql" env:"FEATURE_GRAPHQL" default:"true"`
+}
+
+// Health tunes the readiness probe, see health.NewProbes.
+type Health struct {
+	// CacheTTL is how long a readiness report is served before the
+	// dependencies are checked again.
+	CacheTTL time.Duration `yaml:"cacheTtl" env:"HEALTH_CACHE_TTL" default:"2s" binding:"gte=0" live:"true"`
+	Timeout  time.Duration `yaml:"timeout" env:"HEALTH_TIMEOUT" default:"2s" binding:"gt=0" live:"true"`
+	// FailureThreshold failed checks in a row take a dependency down and the
+	// service out of rotation; fewer only degrade it.
+	FailureThreshold int `yaml:"failureThreshold" env:"HEALTH_FAILURE_THRESHOLD" default:"3" binding:"gte=1" live:"true"`
+	// DegradedLatency marks dependencies that answer slower as degraded.
+	DegradedLatency time.Duration `yaml:"degradedLatency" env:"HEALTH_DEGRADED_LATENCY" default:"500ms" binding:"gt=0" live:"true"`
+}
+
+// RateLimit limits the requests of every client, see ratelimit.NewLimiter.
+// Limits are written as requests per period, such as 60/1m, and an empty
+// limit does not limit.
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" env:"RATE_LIMIT_ENABLED" default:"true" live:"true"`
+	// IP limits the requests per client address, authenticated or not.
+	IP string `yaml:"ip" env:"RATE_LIMIT_IP" default:"600/1m" binding:"omitempty,rate" live:"true"`
+	// Default, Mutations and Search limit the requests per authenticated
+	// user, or per address without authentication. Mutations change data,
+	// and searches are list requests with a q parameter and GraphQL queries.
+	Default   string `yaml:"default" env:"RATE_LIMIT_DEFAULT" default:"300/1m" binding:"omitempty,rate" live:"true"`
+	Mutations string `yaml:"mutations" env:"RATE_LIMIT_MUTATIONS" default:"60/1m" binding:"omitempty,rate" live:"true"`
+	Search    string `yaml:"search" env:"RATE_LIMIT_SEARCH" default:"60/1m" binding:"omitempty,rate" live:"true"`
+}
 
-	return instance
+// Idempotency keeps the responses of requests with an Idempotency-Key, see
+// idempotency.Middleware.
+type Idempotency struct {
+	// TTL is how long a response is replayed to retries with the same key.
+	TTL time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL" default:"24h" binding:"gt=0" live:"true"`
+	// LockTimeout is how long a request holds its key while it runs. A retry
+	// within it is rejected as a conflict; after it the request runs again,
+	// in case the replica that held the key died.
+	LockTimeout time.Duration `yaml:"lockTimeout" env:"IDEMPOTENCY_LOCK_TIMEOUT" default:"1m" binding:"gt=0" live:"true"`
 }
 
-func getValue(key, def string) string {
-	val, found := os.LookupEnv(key)
+// Fixtures are the datasets that can be loaded into the database, see
+// fixtures.Load.
+type Fixtures struct {
+	// Enabled allows loading them. Keep it off in production.
+	Enabled bool `yaml:"enabled" env:"FIXTURES_ENABLED" default:"false"`
+	// Dir holds datasets as YAML or JSON files in addition to the built-in
+	// ones, which those of the same name replace.
+	Dir string `yaml:"dir" env:"FIXTURES_DIR"`
+}
+
+// ParseRate parses a limit such as 60/1m into its requests and period.
+func ParseRate(rate string) (requests int, period time.Duration, err error) {
+	count, every, found := strings.Cut(rate, "/")
 	if !found {
-		val = def
+		return 0, 0, fmt.Errorf("%q is not requests per period such as 60/1m", rate)
+	}
+	if requests, err = strconv.Atoi(count); err != nil || requests <= 0 {
+		return 0, 0, fmt.Errorf("%q does not start with a positive number of requests", rate)
+	}
+	if period, err = time.ParseDuration(every); err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("%q does not end with a positive period such as 1m", rate)
+	}
+	return requests, period, nil
+}
+
+var current atomic.Pointer[Config]
+
+// args are the command line arguments the configuration is reloaded with.
+var args []string
+
+// MustInit loads the configuration with the command line arguments and makes
+// it the one Get returns. It exits the process if the configuration is
+// invalid, and after printing the usage for -h. Services call it first thing.
+func MustInit(arguments []string) *Config {
+	c, err := Load(arguments)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Logger().Fatal().Err(err).Msg("Configuration")
+	}
+	args = arguments
+	current.Store(c)
+	return c
+}
+
+// Get returns the current configuration. Without MustInit it is loaded from
+// the defaults and the environment.
+func Get() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	return MustInit(nil)
+}
+
+// MarshalZerologObject logs the settings by path with the secrets redacted,
+// as in log.Logger().Info().Object("config", config.Get()).
+func (c *Config) MarshalZerologObject(e *zerolog.Event) {
+	for _, s := range settings(c) {
+		switch value := s.value.Interface().(type) {
+		case string:
+			if s.secret && value != "" {
+				value = log.Redacted
+			}
+			e.Str(s.path, log.Redact(s.path, value))
+		case time.Duration:
+			e.Str(s.path, value.String())
+		default:
+			e.Interface(s.path, value)
+		}
+	}
+}
+
+// settings returns the leaves of the configuration with their YAML paths.
+func settings(c *Config) (out []*setting) {
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			path := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			out = append(out, &setting{
+				path:   path,
+				env:    field.Tag.Get("env"),
+				def:    field.Tag.Get("default"),
+				secret: field.Tag.Get("secret") == "true",
+				live:   field.Tag.Get("live") == "true",
+				value:  v.Field(i),
+			})
+		}
 	}
-	return val
+	walk(reflect.ValueOf(c).Elem(), "")
+	return
 }
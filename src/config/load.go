@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvFile names the YAML file to load when there is no -config flag.
+const EnvFile = "CONFIG_FILE"
+
+// setting is a leaf of the configuration.
+type setting struct {
+	path   string
+	env    string
+	def    string
+	secret bool
+	// live settings take effect when the configuration is reloaded; the
+	// others need a restart.
+	live  bool
+	value reflect.Value
+}
+
+// Load reads the configuration. Later sources override earlier ones:
+//
+//  1. the defaults of the settings
+//  2. the YAML file given by -config or CONFIG_FILE
+//  3. the environment variables; secrets are also read from the file named
+//     by the variable with a _FILE suffix, such as COUCHBASE_PASSWORD_FILE
+//  4. the flags, named by the YAML path as in -server.port
+//
+// Lists are written comma-separated in the environment and flags. The result
+// is validated, and all invalid settings are reported in one error. Load
+// returns flag.ErrHelp after printing the usage for -h.
+func Load(args []string) (c *Config, err error) {
+	c = &Config{}
+	all := settings(c)
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	file := flags.String("config", os.Getenv(EnvFile), "YAML configuration `file` ($"+EnvFile+")")
+	overrides := map[string]string{}
+	for _, s := range all {
+		s := s
+		usage := fmt.Sprintf("($%s)", s.env)
+		if s.secret {
+			usage = fmt.Sprintf("($%s or $%s_FILE)", s.env, s.env)
+		}
+		if s.def != "" {
+			usage += fmt.Sprintf(" (default %q)", s.def)
+		}
+		flags.Func(s.path, usage, func(value string) error {
+			overrides[s.path] = value
+			return nil
+		})
+	}
+	if err = flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+
+	for _, s := range all {
+		if err = s.set(s.def); err != nil {
+			return nil, fmt.Errorf("default of %s: %w", s.path, err)
+		}
+	}
+	if *file != "" {
+		if err = loadFile(c, *file); err != nil {
+			return nil, err
+		}
+		c.file = *file
+	}
+	for _, s := range all {
+		if err = s.setFromEnv(); err != nil {
+			return nil, err
+		}
+		if value, ok := overrides[s.path]; ok {
+			if err = s.set(value); err != nil {
+				return nil, fmt.Errorf("-%s: %w", s.path, err)
+			}
+		}
+	}
+
+	return c, validate(c, all)
+}
+
+func loadFile(c *Config, name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *setting) setFromEnv() error {
+	value, found := os.LookupEnv(s.env)
+	if s.secret {
+		if name, ok := os.LookupEnv(s.env + "_FILE"); ok {
+			if found {
+				return fmt.Errorf("only one of %s and %s_FILE can be set", s.env, s.env)
+			}
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %w", s.env, err)
+			}
+			value, found = strings.TrimRight(string(data), "\r\n"), true
+		}
+	}
+	if !found {
+		return nil
+	}
+	if err := s.set(value); err != nil {
+		return fmt.Errorf("%s: %w", s.env, err)
+	}
+	return nil
+}
+
+// set parses the text form of the setting.
+func (s *setting) set(value string) error {
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(value)
+	case bool:
+		if value == "" {
+			value = "false"
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		s.value.SetBool(b)
+	case int:
+		if value == "" {
+			value = "0"
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		s.value.SetInt(int64(i))
+	case time.Duration:
+		if value == "" {
+			value = "0s"
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+		}
+		s.value.SetInt(int64(d))
+	case []string:
+		var list []string
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				list = append(list, entry)
+			}
+		}
+		s.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", s.value.Type())
+	}
+	return nil
+}
+
+var validate = func() func(c *Config, all []*setting) error {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("yaml")
+	})
+	v.SetTagName("binding")
+	if err := v.RegisterValidation("httpurl", func(fl validator.FieldLevel) bool {
+		u, err := url.Parse(fl.Field().String())
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	}); err != nil {
+		panic(err)
+	}
+	if err := v.RegisterValidation("rate", func(fl validator.FieldLevel) bool {
+		_, _, err := ParseRate(fl.Field().String())
+		return err == nil
+	}); err != nil {
+		panic(err)
+	}
+
+	return func(c *Config, all []*setting) error {
+		var validationErrors validator.ValidationErrors
+		if err := v.Struct(c); !errors.As(err, &validationErrors) {
+			return err
+		}
+		envs := map[string]string{}
+		for _, s := range all {
+			envs[s.path] = s.env
+		}
+		problems := make([]string, 0, len(validationErrors))
+		for _, fe := range validationErrors {
+			_, path, _ := strings.Cut(fe.Namespace(), ".")
+			// Entries of lists are reported as cors.allowOrigins[0].
+			base, _, _ := strings.Cut(path, "[")
+			problems = append(problems, fmt.Sprintf("%s ($%s, -%s) %s", path, envs[base], base, message(fe)))
+		}
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+}()
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_if":
+		return "is required"
+	case "numeric":
+		return "must be a number"
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s, not %q", strings.Join(strings.Fields(fe.Param()), ", "), fe.Value())
+	case "httpurl":
+		return fmt.Sprintf("must be an absolute http or https URL, not %q", fe.Value())
+	case "rate":
+		return fmt.Sprintf("must be requests per period such as 60/1m, not %q", fe.Value())
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
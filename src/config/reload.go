@@ -0,0 +1,135 @@
+package config
+
+import (
+	"context"
+	"github.com/shoppinglist/log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// watchInterval is how often Watch looks at the configuration file.
+const watchInterval = 5 * time.Second
+
+var subscribers = struct {
+	sync.Mutex
+	next int
+	fns  map[int]func(c *Config)
+}{fns: map[int]func(c *Config){}}
+
+// reloading serializes the reloads.
+var reloading sync.Mutex
+
+// Subscribe calls fn with the new configuration after every reload that
+// changed a live setting, until cancel is called.
+func Subscribe(fn func(c *Config)) (cancel func()) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	id := subscribers.next
+	subscribers.next++
+	subscribers.fns[id] = fn
+	return func() {
+		subscribers.Lock()
+		defer subscribers.Unlock()
+		delete(subscribers.fns, id)
+	}
+}
+
+// Reload loads the configuration again from the same sources and swaps in
+// the changed live settings. Changes to other settings are logged and wait
+// for a restart. An invalid configuration is logged and leaves the current
+// one in place.
+func Reload() (changed []string, err error) {
+	reloading.Lock()
+	defer reloading.Unlock()
+
+	loaded, err := Load(args)
+	if err != nil {
+		log.Logger().Error().Err(err).Msg("Configuration reload failed, keeping the current configuration")
+		return nil, err
+	}
+
+	next := *Get()
+	var restart []string
+	loadedSettings := settings(loaded)
+	for i, s := range settings(&next) {
+		value := loadedSettings[i].value
+		if reflect.DeepEqual(s.value.Interface(), value.Interface()) {
+			continue
+		}
+		if !s.live {
+			restart = append(restart, s.path)
+			continue
+		}
+		s.value.Set(value)
+		changed = append(changed, s.path)
+	}
+	if len(restart) > 0 {
+		log.Logger().Warn().Strs("settings", restart).Msg("Configuration changes that need a restart")
+	}
+	if len(changed) == 0 {
+		log.Logger().Info().Msg("Configuration reloaded without changes")
+		return nil, nil
+	}
+
+	current.Store(&next)
+	subscribers.Lock()
+	fns := make([]func(c *Config), 0, len(subscribers.fns))
+	for _, fn := range subscribers.fns {
+		fns = append(fns, fn)
+	}
+	subscribers.Unlock()
+	for _, fn := range fns {
+		fn(&next)
+	}
+	log.Logger().Info().Strs("settings", changed).Object("config", &next).Msg("Configuration reloaded")
+	return changed, nil
+}
+
+// Watch reloads the configuration on SIGHUP and when its file changes, until
+// the context is cancelled. The file is polled, which also notices the
+// symbolic link swaps of mounted Kubernetes config maps.
+func Watch(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	file := Get().file
+	modified := modTime(file)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Logger().Info().Msg("Reloading the configuration on SIGHUP")
+			_, _ = Reload()
+		case <-ticker.C:
+			if file == "" {
+				continue
+			}
+			if t := modTime(file); !t.Equal(modified) {
+				modified = t
+				log.Logger().Info().Str("file", file).Msg("Reloading the changed configuration file")
+				_, _ = Reload()
+			}
+		}
+	}
+}
+
+// modTime returns when the file was last modified, or the zero time if it
+// cannot be read.
+func modTime(name string) time.Time {
+	if name == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"sync"
+)
+
+// connection is the cluster connection shared by all db instances of the
+// process.
+type connection struct {
+	cluster *gocb.Cluster
+	bucket  *gocb.Bucket
+	scope   *gocb.Scope
+	// prepared holds the collections that were created and indexed.
+	prepared map[string]bool
+}
+
+var shared struct {
+	sync.Mutex
+	conn *connection
+}
+
+// Connect opens the shared connection to the cluster unless it is open. The
+// services call it at startup; the db constructors connect on demand as well.
+// The in-memory backend needs no connection.
+func Connect(ctx context.Context) error {
+	if config.Get().Database.Backend == BackendMemory {
+		return nil
+	}
+	_, err := connect(ctx)
+	return err
+}
+
+// Close closes the shared connection. Later calls connect again.
+func Close(ctx context.Context) error {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.conn == nil {
+		return nil
+	}
+	err := shared.conn.cluster.Close(&gocb.ClusterCloseOptions{})
+	shared.conn = nil
+	return err
+}
+
+// connect returns the shared connection, opening it if needed. A failed
+// attempt is not kept, so the next call tries again once the circuit breaker
+// lets it.
+func connect(ctx context.Context) (conn *connection, err error) {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.conn != nil {
+		return shared.conn, nil
+	}
+
+	// Uncomment following line to enable logging
+	//gocb.SetLogger(gocb.VerboseStdioLogger())
+
+	conf := config.Get().Database
+
+	// While the cluster is down, requests fail fast instead of each waiting
+	// for the connect timeout.
+	if err = couchbaseBreaker().Allow(); err != nil {
+		return nil, err
+	}
+	ctx, connectSpan := tracing.Start(ctx, "couchbase.connect", semconv.DBSystemCouchbase, semconv.DBName(conf.Bucket))
+	defer func() {
+		tracing.End(connectSpan, err)
+	}()
+	cluster, err := gocb.Connect(conf.ConnectionString, gocb.ClusterOptions{
+		Authenticator: gocb.PasswordAuthenticator{
+			Username: conf.Username,
+			Password: conf.Password,
+		},
+		TimeoutsConfig: gocb.TimeoutsConfig{
+			ConnectTimeout: conf.ConnectTimeout,
+			KVTimeout:      conf.OperationTimeout,
+			QueryTimeout:   conf.QueryTimeout,
+		},
+	})
+	if err != nil {
+		couchbaseBreaker().Done(unhealthy(err))
+		log.Ctx(ctx).Err(err).Msg("Connecting to Couchbase")
+		return nil, err
+	}
+
+	bucket := cluster.Bucket(conf.Bucket)
+	err = bucket.WaitUntilReady(conf.ConnectTimeout, &gocb.WaitUntilReadyOptions{
+		Context: ctx,
+	})
+	couchbaseBreaker().Done(unhealthy(err))
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Connecting to Couchbase")
+		_ = cluster.Close(&gocb.ClusterCloseOptions{})
+		return nil, err
+	}
+
+	err = bucket.Collections().CreateScope("0",
+		&gocb.CreateScopeOptions{Context: ctx})
+	if err != nil {
+		if !errors.Is(err, gocb.ErrScopeExists) {
+			log.Ctx(ctx).Err(err).Msg("Creating the scope")
+			_ = cluster.Close(&gocb.ClusterCloseOptions{})
+			return nil, err
+		}
+	}
+
+	shared.conn = &connection{
+		cluster:  cluster,
+		bucket:   bucket,
+		scope:    bucket.Scope("0"),
+		prepared: map[string]bool{},
+	}
+	log.Ctx(ctx).Info().Str("bucket", conf.Bucket).Msg("Connected to Couchbase")
+	return shared.conn, nil
+}
+
+// prepare creates the collection of the db and its indexes, once per
+// process.
+func (c *connection) prepare(ctx context.Context, d *db) (err error) {
+	shared.Lock()
+	defer shared.Unlock()
+	if c.prepared[d.collectionName] {
+		return nil
+	}
+
+	err = d.collectionManager.CreateCollection(gocb.CollectionSpec{
+		Name:      d.collectionName,
+		ScopeName: "0",
+	}, &gocb.CreateCollectionOptions{
+		Context: ctx,
+	})
+	if err != nil {
+		if !errors.Is(err, gocb.ErrCollectionExists) {
+			log.Ctx(ctx).Err(err).Msg("Creating the collection failed")
+			return err
+		}
+	}
+	if err = d.createIndexes(ctx); err != nil {
+		return err
+	}
+
+	//if err = instance.searchIndexManager.UpsertIndex(gocb.SearchIndex{
+	//	UUID:         "title-index",
+	//	Name:         "title-index",
+	//	SourceName:   d.bucket.Name(),
+	//	Type:         "fulltext-index",
+	//	Params:       nil,
+	//	SourceUUID:   "",
+	//	SourceParams: nil,
+	//	SourceType:   "couchbase",
+	//	PlanParams:   nil,
+	//}, &gocb.UpsertSearchIndexOptions{Context: ctx}); err != nil {
+	//	if !errors.Is(err, gocb.ErrIndexExists) {
+	//		log.Println(err)
+	//		return nil, err
+	//	}
+	//}
+
+	c.prepared[d.collectionName] = true
+	return nil
+}
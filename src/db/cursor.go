@@ -0,0 +1,151 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/filter"
+)
+
+// Cursor is the position after the last entry of a page. It also carries the
+// sort and the search of the listing, so that following pages stay on the
+// same keyset, and the list and a hash of the filter it was issued for, so
+// that it is not used on another listing.
+type Cursor struct {
+	Sort   string `json:"s,omitempty"`
+	Order  string `json:"o,omitempty"`
+	Query  string `json:"q,omitempty"`
+	List   string `json:"l,omitempty"`
+	Filter string `json:"f,omitempty"`
+	Value  any    `json:"v,omitempty"`
+	ID     string `json:"id"`
+}
+
+// Token encodes the cursor for clients, which must treat it as opaque.
+func (c *Cursor) Token() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseCursor decodes a token returned by Token.
+func ParseCursor(token string) (cursor *Cursor, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", gocb.ErrInvalidArgument)
+	}
+	cursor = &Cursor{}
+	if err = json.Unmarshal(b, cursor); err != nil || cursor.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", gocb.ErrInvalidArgument)
+	}
+	return cursor, nil
+}
+
+// CursorQuery asks for the page after a cursor, or the first page if After is
+// nil. The filter has to be sent with every page; a cursor issued for another
+// filter or list is rejected. The total is only counted when asked for, since
+// it costs a query over the whole listing.
+type CursorQuery struct {
+	Sort         string
+	Order        string
+	Query        string
+	Filter       filter.Expr
+	After        *Cursor
+	Limit        int
+	IncludeTotal bool
+}
+
+// listName names the list of items the bought flag selects in cursors.
+func listName(bought sql.NullBool) string {
+	switch {
+	case !bought.Valid:
+		return "all"
+	case bought.Bool:
+		return "bought"
+	default:
+		return "tobuy"
+	}
+}
+
+func filterHash(expr filter.Expr) string {
+	s := filter.String(expr)
+	if s == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkAfter rejects a cursor issued for another list or filter, whose
+// position would not be one of this listing.
+func (q *CursorQuery) checkAfter(list string) error {
+	if q.After != nil && (q.After.List != list || q.After.Filter != filterHash(q.Filter)) {
+		return fmt.Errorf("%w: the cursor was issued for another list or filter", gocb.ErrInvalidArgument)
+	}
+	return nil
+}
+
+// next returns the cursor of the page that follows the entry.
+func (q *CursorQuery) next(list string, id string, value any) *Cursor {
+	return &Cursor{
+		Sort:   q.Sort,
+		Order:  q.Order,
+		Query:  q.Query,
+		List:   list,
+		Filter: filterHash(q.Filter),
+		Value:  value,
+		ID:     id,
+	}
+}
+
+// sortPath returns the N1QL expression entries are sorted by. Missing and
+// null values count as the zero value of the field, as they do when read into
+// Go by the in-memory backend, so that they are neither skipped by the keyset
+// condition nor sorted apart.
+func sortPath(field string) string {
+	zero := `""`
+	if f, ok := filter.Items[field]; ok {
+		switch f.Kind {
+		case filter.KindNumber, filter.KindTime:
+			zero = "0"
+		case filter.KindBool:
+			zero = "false"
+		}
+	}
+	return fmt.Sprintf("IFMISSINGORNULL(x.%s, %s)", field, zero)
+}
+
+// keyset returns the condition selecting the entries after the cursor and the
+// ORDER BY clause of the listing. Entries are ordered by the sort field and
+// then by ID, which makes the order total, so no entry is returned twice or
+// skipped when entries are added or removed between pages.
+func (d *db) keyset(q *CursorQuery, params map[string]interface{}) (where string, orderBy string, err error) {
+	if q.Sort == "" {
+		orderBy = "\nORDER BY meta(x).id ASC"
+		if q.After != nil {
+			where = "\nAND meta(x).id > $afterId"
+			params["afterId"] = q.After.ID
+		}
+		return
+	}
+
+	order, err := sortOrder(d.fields, q.Sort, q.Order)
+	if err != nil {
+		return
+	}
+	path := sortPath(q.Sort)
+	orderBy = fmt.Sprintf("\nORDER BY %s %s, meta(x).id ASC", path, order)
+	if q.After != nil {
+		op := ">"
+		if order == "DESC" {
+			op = "<"
+		}
+		where = fmt.Sprintf("\nAND (%[1]s %[2]s $afterValue OR (%[1]s = $afterValue AND meta(x).id > $afterId))", path, op)
+		params["afterValue"] = q.After.Value
+		params["afterId"] = q.After.ID
+	}
+	return
+}
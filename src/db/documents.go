@@ -0,0 +1,233 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"sort"
+	"sync"
+)
+
+// DataCollections are the collections holding the data of the users, in the
+// order they are backed up. Idempotency records are left out; they expire
+// anyway.
+var DataCollections = []string{"items", "pantry", "plans", "recipes", "webhooks", "deliveries", "users"}
+
+// DocumentsDB reads and writes the documents of a collection as they are
+// stored, for backups and restores.
+type DocumentsDB interface {
+	// ScanDocuments calls fn with every document of the collection in the
+	// order of their IDs, and stops at the first error fn returns.
+	ScanDocuments(ctx context.Context, fn func(id string, body json.RawMessage) error) (err error)
+	// GetDocument returns gocb.ErrDocumentNotFound if there is no document.
+	GetDocument(ctx context.Context, id string) (body json.RawMessage, err error)
+	// InsertDocument returns gocb.ErrDocumentExists if there is a document.
+	InsertDocument(ctx context.Context, id string, body json.RawMessage) (err error)
+	UpsertDocument(ctx context.Context, id string, body json.RawMessage) (err error)
+}
+
+// NewDocumentsDB returns the documents of one of the DataCollections in the
+// configured backend. The collection is created if it does not exist.
+func NewDocumentsDB(ctx context.Context, collection string) (DocumentsDB, error) {
+	known := false
+	for _, name := range DataCollections {
+		known = known || name == collection
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: unknown collection %q", gocb.ErrInvalidArgument, collection)
+	}
+	if config.Get().Database.Backend == BackendMemory {
+		return NewMemoryDocumentsDB(collection), nil
+	}
+	db := &db{
+		collectionName: collection,
+	}
+	err := db.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (d *db) ScanDocuments(ctx context.Context, fn func(id string, body json.RawMessage) error) (err error) {
+	ctx, end := d.trace(ctx, "ScanDocuments")
+	defer end(&err)
+	query := fmt.Sprintf("SELECT meta(x).id, x AS body FROM `%s` x ORDER BY meta(x).id ASC", d.collectionName)
+	// A backup has to hold the documents written right before it started.
+	queryResult, err := d.query(query, &gocb.QueryOptions{
+		Adhoc:           true,
+		Context:         ctx,
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+	})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	defer func() {
+		_ = queryResult.Close()
+	}()
+	for queryResult.Next() {
+		var row struct {
+			ID   string          `json:"id"`
+			Body json.RawMessage `json:"body"`
+		}
+		if err = queryResult.Row(&row); err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		if err = fn(row.ID, row.Body); err != nil {
+			return
+		}
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+	}
+	return
+}
+
+func (d *db) GetDocument(ctx context.Context, id string) (body json.RawMessage, err error) {
+	ctx, end := d.trace(ctx, "GetDocument")
+	defer end(&err)
+	getResult, err := d.get(id,
+		&gocb.GetOptions{Context: ctx})
+	if err != nil {
+		return
+	}
+	err = getResult.Content(&body)
+	return
+}
+
+func (d *db) InsertDocument(ctx context.Context, id string, body json.RawMessage) (err error) {
+	ctx, end := d.trace(ctx, "InsertDocument")
+	defer end(&err)
+	_, err = d.insert(id, body,
+		&gocb.InsertOptions{Context: ctx})
+	return
+}
+
+func (d *db) UpsertDocument(ctx context.Context, id string, body json.RawMessage) (err error) {
+	ctx, end := d.trace(ctx, "UpsertDocument")
+	defer end(&err)
+	_, err = d.upsert(id, body,
+		&gocb.UpsertOptions{Context: ctx})
+	return
+}
+
+// memoryDocuments holds the collections of the in-memory backend, see
+// memoryCollection. The items are kept in memoryItems, where ItemsDB finds
+// them.
+var memoryDocuments = struct {
+	sync.Mutex
+	collections map[string]map[string]json.RawMessage
+}{collections: map[string]map[string]json.RawMessage{}}
+
+type memoryDocumentsDB struct {
+	memoryCollection
+}
+
+// NewMemoryDocumentsDB returns the documents of the collection in the
+// in-memory backend, such as for tests restoring a backup.
+func NewMemoryDocumentsDB(collection string) DocumentsDB {
+	return &memoryDocumentsDB{memoryCollection{name: collection}}
+}
+
+// snapshot returns the documents of the collection. Items are encoded like
+// Couchbase stores them.
+func (d *memoryDocumentsDB) snapshot() (documents map[string]json.RawMessage, err error) {
+	if d.name != "items" {
+		memoryDocuments.Lock()
+		defer memoryDocuments.Unlock()
+		documents = map[string]json.RawMessage{}
+		for id, body := range memoryDocuments.collections[d.name] {
+			documents[id] = body
+		}
+		return documents, nil
+	}
+	memoryItems.mu.Lock()
+	defer memoryItems.mu.Unlock()
+	documents = map[string]json.RawMessage{}
+	for id, item := range memoryItems.items {
+		if documents[id], err = json.Marshal(item); err != nil {
+			return nil, err
+		}
+	}
+	return documents, nil
+}
+
+func (d *memoryDocumentsDB) ScanDocuments(ctx context.Context, fn func(id string, body json.RawMessage) error) (err error) {
+	defer d.trace(ctx, "ScanDocuments", opQuery)(&err)
+	documents, err := d.snapshot()
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(documents))
+	for id := range documents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err = fn(id, documents[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *memoryDocumentsDB) GetDocument(ctx context.Context, id string) (body json.RawMessage, err error) {
+	defer d.trace(ctx, "GetDocument", opGet)(&err)
+	documents, err := d.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	body, ok := documents[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+	return body, nil
+}
+
+func (d *memoryDocumentsDB) InsertDocument(ctx context.Context, id string, body json.RawMessage) (err error) {
+	defer d.trace(ctx, "InsertDocument", opInsert)(&err)
+	return d.put(id, body, false)
+}
+
+func (d *memoryDocumentsDB) UpsertDocument(ctx context.Context, id string, body json.RawMessage) (err error) {
+	defer d.trace(ctx, "UpsertDocument", opUpsert)(&err)
+	return d.put(id, body, true)
+}
+
+// put stores the document as it is, keeping its times, unlike UpsertItem.
+func (d *memoryDocumentsDB) put(id string, body json.RawMessage, replace bool) error {
+	exists := fmt.Errorf("%w: %s", gocb.ErrDocumentExists, id)
+	if d.name == "items" {
+		var item models.Item
+		if err := json.Unmarshal(body, &item); err != nil {
+			return fmt.Errorf("%w: item %s: %v", gocb.ErrDecodingFailure, id, err)
+		}
+		memoryItems.mu.Lock()
+		defer memoryItems.mu.Unlock()
+		if _, ok := memoryItems.items[id]; ok && !replace {
+			return exists
+		}
+		memoryItems.items[id] = &item
+		memoryItems.changed(id)
+		return nil
+	}
+
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	documents, ok := memoryDocuments.collections[d.name]
+	if !ok {
+		documents = map[string]json.RawMessage{}
+		memoryDocuments.collections[d.name] = documents
+	}
+	if _, ok := documents[id]; ok && !replace {
+		return exists
+	}
+	documents[id] = append(json.RawMessage(nil), body...)
+	return nil
+}
@@ -3,20 +3,14 @@ package db
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/filter"
 	"github.com/shoppinglist/log"
-	"github.com/shoppinglist/models"
-	"os"
-	"time"
+	"strings"
 )
 
-type GenericDB interface {
-	Ping(ctx context.Context) (report string, err error)
-}
-
 type db struct {
 	cluster            *gocb.Cluster
 	collectionManager  *gocb.CollectionManager
@@ -31,130 +25,66 @@ type db struct {
 	bought sql.NullBool
 }
 
-func NewGenericDB(ctx context.Context) (GenericDB, error) {
-	db := &db{
-		fields: []string{"title", "amount", "unit", "bought", "shop"},
-		bought: sql.NullBool{
-			Bool:  false,
-			Valid: false,
-		},
-	}
-	err := db.init(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return db, nil
-}
-
-func (d *db) init(ctx context.Context) error {
+// init points the db at the shared connection, see connect, and prepares its
+// collection on first use.
+func (d *db) init(ctx context.Context) (err error) {
+	ctx, end := d.trace(ctx, "init")
+	defer end(&err)
 
-	// Uncomment following line to enable logging
-	//gocb.SetLogger(gocb.VerboseStdioLogger())
-
-	var err error
-
-	connectionString := os.Getenv("COUCHBASE_CONNECTION_STRING")
-	bucketName := os.Getenv("COUCHBASE_BUCKET")
-	username := os.Getenv("COUCHBASE_USERNAME")
-	password := os.Getenv("COUCHBASE_PASSWORD")
-
-	d.cluster, err = gocb.Connect(connectionString, gocb.ClusterOptions{
-		Authenticator: gocb.PasswordAuthenticator{
-			Username: username,
-			Password: password,
-		},
-	})
+	conn, err := connect(ctx)
 	if err != nil {
-		log.Logger().Err(err)
 		return err
 	}
-
-	d.searchIndexManager = d.cluster.SearchIndexes()
-
-	d.bucket = d.cluster.Bucket(bucketName)
-
-	err = d.bucket.WaitUntilReady(5*time.Second, &gocb.WaitUntilReadyOptions{
-		Context: ctx,
-	})
-	if err != nil {
-		log.Logger().Err(err)
-		return err
+	d.cluster = conn.cluster
+	d.searchIndexManager = conn.cluster.SearchIndexes()
+	d.bucket = conn.bucket
+	d.collectionManager = conn.bucket.Collections()
+	d.scope = conn.scope
+	if d.collectionName == "" {
+		return nil
 	}
+	d.collection = d.scope.Collection(d.collectionName)
+	d.indexManager = d.collection.QueryIndexes()
+	return conn.prepare(ctx, d)
+}
 
-	d.collectionManager = d.bucket.Collections()
-
-	err = d.collectionManager.CreateScope("0",
-		&gocb.CreateScopeOptions{Context: ctx})
-	if err != nil {
-		if !errors.Is(err, gocb.ErrScopeExists) {
-			log.Logger().Err(err)
+// createIndexes creates the primary index and the indexes of the fields of
+// the collection unless they exist.
+func (d *db) createIndexes(ctx context.Context) (err error) {
+	ctx, end := d.trace(ctx, "createIndexes")
+	defer end(&err)
+
+	if err = d.indexManager.CreatePrimaryIndex(&gocb.CreatePrimaryQueryIndexOptions{
+		IgnoreIfExists: false,
+		Deferred:       false,
+		Context:        ctx,
+	}); err != nil {
+		if !errors.Is(err, gocb.ErrIndexExists) {
+			log.Ctx(ctx).Err(err).Msg("Creating an index failed")
 			return err
 		}
 	}
-	d.scope = d.bucket.Scope("0")
-	if d.collectionName != "" {
-		err = d.collectionManager.CreateCollection(gocb.CollectionSpec{
-			Name:      d.collectionName,
-			ScopeName: "0",
-		}, &gocb.CreateCollectionOptions{
-			Context: ctx,
-		})
-		if err != nil {
-			if !errors.Is(err, gocb.ErrCollectionExists) {
-				log.Logger().Err(err)
-				return err
-			}
-		}
-		d.collection = d.scope.Collection(d.collectionName)
-
-		d.indexManager = d.collection.QueryIndexes()
 
-		if err = d.indexManager.CreatePrimaryIndex(&gocb.CreatePrimaryQueryIndexOptions{
-			IgnoreIfExists: false,
-			Deferred:       false,
-			Context:        ctx,
-		}); err != nil {
+	for _, fieldName := range d.fields {
+		if err := d.indexManager.CreateIndex("ix_"+fieldName, []string{fieldName},
+			&gocb.CreateQueryIndexOptions{
+				IgnoreIfExists: false,
+				Deferred:       false,
+				Context:        ctx,
+			}); err != nil {
 			if !errors.Is(err, gocb.ErrIndexExists) {
-				log.Logger().Err(err)
+				log.Ctx(ctx).Err(err).Msg("Creating an index failed")
 				return err
 			}
 		}
-
-		for _, fieldName := range d.fields {
-			if err := d.indexManager.CreateIndex("ix_"+fieldName, []string{fieldName},
-				&gocb.CreateQueryIndexOptions{
-					IgnoreIfExists: false,
-					Deferred:       false,
-					Context:        ctx,
-				}); err != nil {
-				if !errors.Is(err, gocb.ErrIndexExists) {
-					log.Logger().Err(err)
-					return err
-				}
-			}
-		}
-
-		//if err = instance.searchIndexManager.UpsertIndex(gocb.SearchIndex{
-		//	UUID:         "title-index",
-		//	Name:         "title-index",
-		//	SourceName:   d.bucket.Name(),
-		//	Type:         "fulltext-index",
-		//	Params:       nil,
-		//	SourceUUID:   "",
-		//	SourceParams: nil,
-		//	SourceType:   "couchbase",
-		//	PlanParams:   nil,
-		//}, &gocb.UpsertSearchIndexOptions{Context: ctx}); err != nil {
-		//	if !errors.Is(err, gocb.ErrIndexExists) {
-		//		log.Println(err)
-		//		return nil, err
-		//	}
-		//}
 	}
-
 	return nil
 }
 
+// CasRetries bounds how often a read-modify-write is retried when another
+// writer changed the document in between.
+const CasRetries = 5
+
 func Key(prefix string, id string) string {
 	return fmt.Sprintf("%s:%s", prefix, id)
 }
@@ -165,166 +95,61 @@ type PaginationQuery struct {
 	Sort  string
 	Order string
 	Query string
+	// Filter narrows the listing down, where the listing supports it.
+	Filter filter.Expr
 }
 
-func (d *db) Ping(ctx context.Context) (report string, err error) {
-	pings, err := d.bucket.Ping(&gocb.PingOptions{
-		ReportID:     "ping",
-		ServiceTypes: []gocb.ServiceType{gocb.ServiceTypeKeyValue},
-		Context:      ctx,
-	})
-	if err != nil {
-		return "", err
+// sortOrder checks the sort field against the indexed fields, since it ends
+// up in the statement, and returns the order in upper case.
+func sortOrder(fields []string, sort string, order string) (string, error) {
+	indexed := false
+	for _, fieldName := range fields {
+		if fieldName == sort {
+			indexed = true
+			break
+		}
 	}
-
-	b, err := json.Marshal(pings)
-	if err != nil {
-		return "", err
+	if !indexed {
+		return "", fmt.Errorf("%w: cannot sort by %q", gocb.ErrInvalidArgument, sort)
 	}
-
-	for service, pingReports := range pings.Services {
-		if service != gocb.ServiceTypeKeyValue {
-			err = fmt.Errorf("we got a service type that we didn't ask for")
-			return "", err
-		}
-
-		for _, pingReport := range pingReports {
-			if pingReport.State != gocb.PingStateOk {
-				err = fmt.Errorf("we got a service state that is not OK")
-			}
-		}
+	order = strings.ToUpper(order)
+	if order == "" {
+		order = "ASC"
 	}
-
-	return string(b), err
+	if order != "ASC" && order != "DESC" {
+		return "", fmt.Errorf("%w: order must be ASC or DESC", gocb.ErrInvalidArgument)
+	}
+	return order, nil
 }
 
-func InitDB(ctx context.Context) (err error) {
-	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-
-	itemsDB, err := NewItemsDB(ctx, sql.NullBool{
-		Bool:  true,
-		Valid: true,
-	})
-	if err != nil {
-		log.Logger().Error().Err(err)
-		return
-	}
-	items := []*models.Item{
-		{
-			Title:  "Cottage Cheese",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: false,
-			Shop:   "Rewe",
-		},
-		{
-			Title:  "Avocado",
-			Amount: 2,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Banana",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Milk",
-			Amount: 2,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Bread",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Sosages",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Meat",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Creme Fraiche",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Wine",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Napkins",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Tomatoes",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Cucumber",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Ananas",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Plums",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
-		{
-			Title:  "Clementines",
-			Amount: 1,
-			Unit:   "pc",
-			Bought: true,
-			Shop:   "Edeka",
-		},
+func checkRange(q *PaginationQuery) error {
+	if q.Start < 0 || (q.End != 0 && q.End < q.Start) {
+		return fmt.Errorf("%w: invalid range %d-%d", gocb.ErrInvalidArgument, q.Start, q.End)
 	}
+	return nil
+}
 
-	for _, item := range items {
-		_, err = itemsDB.UpsertItem(ctx, Key("item", item.Title), item)
+// paginate returns the ORDER BY, OFFSET and LIMIT clauses for the query.
+// Sort and order are checked here as well, whatever the caller validated
+// already.
+func (d *db) paginate(q *PaginationQuery, orderBy string) (clauses string, err error) {
+	if q.Sort != "" {
+		order, err := sortOrder(d.fields, q.Sort, q.Order)
 		if err != nil {
-			log.Logger().Error().Err(err)
-			return err
+			return "", err
 		}
+		orderBy = fmt.Sprintf("x.%s %s, meta(x).id ASC", q.Sort, order)
+	}
+	if err = checkRange(q); err != nil {
+		return
 	}
 
+	clauses = "\nORDER BY " + orderBy
+	if q.Start != 0 {
+		clauses += fmt.Sprintf("\nOFFSET %d ", q.Start)
+	}
+	if q.End != 0 {
+		clauses += fmt.Sprintf("\nLIMIT %d ", q.End-q.Start)
+	}
 	return
 }
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/health"
+)
+
+// Dependencies returns the readiness checks of the database: the key-value
+// and the query service of the shared connection. The in-memory backend is
+// always ready.
+func Dependencies() []health.Dependency {
+	if config.Get().Database.Backend == BackendMemory {
+		return []health.Dependency{{
+			Name: "memory",
+			Check: func(ctx context.Context) (map[string]string, error) {
+				return nil, nil
+			},
+		}}
+	}
+	return []health.Dependency{
+		{
+			Name: "couchbase.kv",
+			Check: func(ctx context.Context) (map[string]string, error) {
+				return ping(ctx, gocb.ServiceTypeKeyValue)
+			},
+		},
+		{
+			Name: "couchbase.query",
+			Check: func(ctx context.Context) (map[string]string, error) {
+				return ping(ctx, gocb.ServiceTypeQuery)
+			},
+		},
+	}
+}
+
+// ping pings the endpoints of the service. It fails unless all of them
+// answer.
+func ping(ctx context.Context, service gocb.ServiceType) (details map[string]string, err error) {
+	details = map[string]string{"breaker": BreakerState().String()}
+	conn, err := connect(ctx)
+	if err != nil {
+		return details, err
+	}
+	result, err := conn.bucket.Ping(&gocb.PingOptions{
+		ReportID:     "readyz",
+		ServiceTypes: []gocb.ServiceType{service},
+		Context:      ctx,
+	})
+	if err != nil {
+		return details, err
+	}
+
+	reports := result.Services[service]
+	ok := 0
+	for _, report := range reports {
+		if report.State == gocb.PingStateOk {
+			ok++
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("endpoint %s did not answer: %s", report.Remote, report.Error)
+		}
+	}
+	details["endpoints"] = fmt.Sprintf("%d/%d", ok, len(reports))
+	if len(reports) == 0 {
+		err = fmt.Errorf("no endpoints of the service")
+	}
+	return details, err
+}
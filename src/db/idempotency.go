@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"sync"
+	"time"
+)
+
+type IdempotencyDB interface {
+	// ReserveIdempotencyKey stores the pending record of a request under the
+	// key unless the key holds a record already, which is returned instead.
+	// The pending record expires after ttl.
+	ReserveIdempotencyKey(ctx context.Context, key string, record *models.IdempotencyRecord, ttl time.Duration) (existing *models.IdempotencyRecord, err error)
+	// CompleteIdempotencyKey replaces the pending record with the one holding
+	// the response, which expires after ttl.
+	CompleteIdempotencyKey(ctx context.Context, key string, record *models.IdempotencyRecord, ttl time.Duration) (err error)
+	// ReleaseIdempotencyKey removes the record, so that the request can run
+	// again.
+	ReleaseIdempotencyKey(ctx context.Context, key string) (err error)
+}
+
+// NewIdempotencyDB returns the records of the configured backend. Couchbase
+// expires them with the document expiry.
+func NewIdempotencyDB(ctx context.Context) (IdempotencyDB, error) {
+	if config.Get().Database.Backend == BackendMemory {
+		return NewMemoryIdempotencyDB(), nil
+	}
+	db := &db{
+		collectionName: "idempotency",
+	}
+	err := db.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (d *db) ReserveIdempotencyKey(ctx context.Context, key string, record *models.IdempotencyRecord, ttl time.Duration) (existing *models.IdempotencyRecord, err error) {
+	ctx, end := d.trace(ctx, "ReserveIdempotencyKey")
+	defer end(&err)
+	// The record may expire between the insert and the get, so try again
+	// once.
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err = d.insert(key, record,
+			&gocb.InsertOptions{Context: ctx, Expiry: ttl})
+		if !errors.Is(err, gocb.ErrDocumentExists) {
+			if err != nil {
+				log.Ctx(ctx).Err(err).Msg("Inserting a document failed")
+			}
+			return nil, err
+		}
+		var getResult *gocb.GetResult
+		getResult, err = d.get(key,
+			&gocb.GetOptions{Context: ctx})
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Getting a document failed")
+			return nil, err
+		}
+		existing = &models.IdempotencyRecord{}
+		if err = getResult.Content(existing); err != nil {
+			log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+			return nil, err
+		}
+		return existing, nil
+	}
+	return nil, err
+}
+
+func (d *db) CompleteIdempotencyKey(ctx context.Context, key string, record *models.IdempotencyRecord, ttl time.Duration) (err error) {
+	ctx, end := d.trace(ctx, "CompleteIdempotencyKey")
+	defer end(&err)
+	_, err = d.upsert(key, record,
+		&gocb.UpsertOptions{Context: ctx, Expiry: ttl})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Upserting a document failed")
+	}
+	return
+}
+
+func (d *db) ReleaseIdempotencyKey(ctx context.Context, key string) (err error) {
+	ctx, end := d.trace(ctx, "ReleaseIdempotencyKey")
+	defer end(&err)
+	_, err = d.remove(key,
+		&gocb.RemoveOptions{Context: ctx})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Removing a document failed")
+	}
+	return
+}
+
+// memoryRecord is an idempotency record of the in-memory backend.
+type memoryRecord struct {
+	record  models.IdempotencyRecord
+	expires time.Time
+}
+
+// memoryIdempotency holds the records of the in-memory backend, shared by
+// all IdempotencyDB instances of the process.
+var memoryIdempotency = struct {
+	sync.Mutex
+	records map[string]*memoryRecord
+}{records: map[string]*memoryRecord{}}
+
+type memoryIdempotencyDB struct{}
+
+// NewMemoryIdempotencyDB returns the records of the in-memory backend, for
+// local development and tests.
+func NewMemoryIdempotencyDB() IdempotencyDB {
+	return &memoryIdempotencyDB{}
+}
+
+func (d *memoryIdempotencyDB) trace(ctx context.Context, method string, operation string) (end func(err *error)) {
+	start := time.Now()
+	_, span := tracing.Start(ctx, "db."+method, attribute.String(attributeCollection, "idempotency"))
+	return func(err *error) {
+		observe(BackendMemory, "idempotency", operation, start, *err)
+		tracing.End(span, spanError(*err))
+	}
+}
+
+func (d *memoryIdempotencyDB) ReserveIdempotencyKey(ctx context.Context, key string, record *models.IdempotencyRecord, ttl time.Duration) (existing *models.IdempotencyRecord, err error) {
+	defer d.trace(ctx, "ReserveIdempotencyKey", opInsert)(&err)
+	memoryIdempotency.Lock()
+	defer memoryIdempotency.Unlock()
+	now := time.Now()
+	// Expired records are dropped here, as Couchbase would drop them.
+	for k, r := range memoryIdempotency.records {
+		if !now.Before(r.expires) {
+			delete(memoryIdempotency.records, k)
+		}
+	}
+	if r, ok := memoryIdempotency.records[key]; ok {
+		found := r.record
+		return &found, nil
+	}
+	memoryIdempotency.records[key] = &memoryRecord{record: *record, expires: now.Add(ttl)}
+	return nil, nil
+}
+
+func (d *memoryIdempotencyDB) CompleteIdempotencyKey(ctx context.Context, key string, record *models.IdempotencyRecord, ttl time.Duration) (err error) {
+	defer d.trace(ctx, "CompleteIdempotencyKey", opUpsert)(&err)
+	memoryIdempotency.Lock()
+	defer memoryIdempotency.Unlock()
+	memoryIdempotency.records[key] = &memoryRecord{record: *record, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (d *memoryIdempotencyDB) ReleaseIdempotencyKey(ctx context.Context, key string) (err error) {
+	defer d.trace(ctx, "ReleaseIdempotencyKey", opRemove)(&err)
+	memoryIdempotency.Lock()
+	defer memoryIdempotency.Unlock()
+	delete(memoryIdempotency.records, key)
+	return nil
+}
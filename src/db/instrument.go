@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/metrics"
+	"github.com/shoppinglist/resilience"
+	"github.com/shoppinglist/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The operations in the db metrics, see metrics.ObserveDB. Every backend
+// reports its calls under the operation Couchbase would run for them.
+const (
+	opGet      = "get"
+	opInsert   = "insert"
+	opUpsert   = "upsert"
+	opReplace  = "replace"
+	opMutateIn = "mutateIn"
+	opQuery    = "query"
+	opRemove   = "remove"
+)
+
+const backendCouchbase = "couchbase"
+
+// failed tells whether err is a failure. A missing document is an answer
+// rather than a failure and is neither counted as an error nor marks spans.
+func failed(err error) bool {
+	return err != nil && !errors.Is(err, gocb.ErrDocumentNotFound)
+}
+
+func spanError(err error) error {
+	if !failed(err) {
+		return nil
+	}
+	return err
+}
+
+func observe(backend string, collection string, operation string, start time.Time, err error) {
+	metrics.ObserveDB(backend, collection, operation, start, failed(err))
+}
+
+// trace starts the span of a db method, named like db.GetItems. Pass the
+// returned context on, so that the operations become its children, and call
+// end with the error of the method.
+func (d *db) trace(ctx context.Context, method string) (_ context.Context, end func(err *error)) {
+	ctx, span := tracing.Start(ctx, "db."+method,
+		semconv.DBSystemCouchbase,
+		attribute.String(attributeCollection, d.collectionName),
+	)
+	return ctx, func(err *error) {
+		tracing.End(span, spanError(*err))
+	}
+}
+
+const attributeCollection = "db.couchbase.collection"
+
+// operation starts measuring a call into gocb with a span named like
+// couchbase.query, which holds the statement of queries. Call end with the
+// error of the call.
+func (d *db) operation(ctx context.Context, operation string, statement string) (end func(err *error)) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	start := time.Now()
+	attributes := []attribute.KeyValue{
+		semconv.DBSystemCouchbase,
+		semconv.DBOperation(operation),
+		attribute.String(attributeCollection, d.collectionName),
+	}
+	if d.bucket != nil {
+		attributes = append(attributes, semconv.DBName(d.bucket.Name()))
+	}
+	if statement != "" {
+		attributes = append(attributes, semconv.DBStatement(statement))
+	}
+	_, span := tracing.Start(ctx, "couchbase."+operation, attributes...)
+	return func(err *error) {
+		observe(backendCouchbase, d.collectionName, operation, start, *err)
+		tracing.End(span, spanError(*err))
+	}
+}
+
+// breaker guards the calls into Couchbase, shared by all db instances.
+var breaker resilience.Breaker
+var breakerOnce sync.Once
+
+func couchbaseBreaker() resilience.Breaker {
+	breakerOnce.Do(func() {
+		conf := config.Get().Database
+		breaker = resilience.NewBreaker(backendCouchbase, conf.BreakerFailures, conf.BreakerCooldown)
+	})
+	return breaker
+}
+
+// BreakerState reports the circuit breaker of the Couchbase calls.
+func BreakerState() resilience.State {
+	return couchbaseBreaker().State()
+}
+
+// unhealthy tells whether err means that the cluster is unreachable or
+// overloaded, as opposed to an answer such as a missing document or a
+// cancelled request.
+func unhealthy(err error) bool {
+	return errors.Is(err, gocb.ErrTimeout) ||
+		errors.Is(err, gocb.ErrServiceNotAvailable) ||
+		errors.Is(err, gocb.ErrTemporaryFailure) ||
+		errors.Is(err, gocb.ErrOverload)
+}
+
+// call runs the gocb call through the circuit breaker. Idempotent calls are
+// retried after transient failures; every attempt is measured and traced.
+func (d *db) call(ctx context.Context, operation string, statement string, idempotent bool, fn func() error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	conf := config.Get().Database
+	attempts := 1
+	if idempotent {
+		attempts += conf.Retries
+	}
+	return resilience.Retry(ctx, attempts, conf.RetryBackoff, unhealthy, func() (err error) {
+		if err = couchbaseBreaker().Allow(); err != nil {
+			return err
+		}
+		defer d.operation(ctx, operation, statement)(&err)
+		err = fn()
+		couchbaseBreaker().Done(unhealthy(err))
+		return err
+	})
+}
+
+// The methods below are the only calls into gocb collections and scopes, so
+// that every operation is measured, traced, bounded by the configured
+// timeouts and guarded by the breaker. Gets, queries that only read and
+// mutateIn, which sets absolute values such as the bought flag, are retried.
+// A mutateIn that checks a CAS is not: if a timed out attempt did land, the
+// retry would fail with a CAS mismatch and hide that the change was made.
+
+func (d *db) get(id string, opts *gocb.GetOptions) (res *gocb.GetResult, err error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = config.Get().Database.OperationTimeout
+	}
+	err = d.call(opts.Context, opGet, "", true, func() (err error) {
+		res, err = d.collection.Get(id, opts)
+		return err
+	})
+	return
+}
+
+func (d *db) insert(id string, val interface{}, opts *gocb.InsertOptions) (res *gocb.MutationResult, err error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = config.Get().Database.OperationTimeout
+	}
+	err = d.call(opts.Context, opInsert, "", false, func() (err error) {
+		res, err = d.collection.Insert(id, val, opts)
+		return err
+	})
+	return
+}
+
+func (d *db) upsert(id string, val interface{}, opts *gocb.UpsertOptions) (res *gocb.MutationResult, err error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = config.Get().Database.OperationTimeout
+	}
+	err = d.call(opts.Context, opUpsert, "", false, func() (err error) {
+		res, err = d.collection.Upsert(id, val, opts)
+		return err
+	})
+	return
+}
+
+func (d *db) replace(id string, val interface{}, opts *gocb.ReplaceOptions) (res *gocb.MutationResult, err error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = config.Get().Database.OperationTimeout
+	}
+	err = d.call(opts.Context, opReplace, "", false, func() (err error) {
+		res, err = d.collection.Replace(id, val, opts)
+		return err
+	})
+	return
+}
+
+func (d *db) mutateIn(id string, ops []gocb.MutateInSpec, opts *gocb.MutateInOptions) (res *gocb.MutateInResult, err error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = config.Get().Database.OperationTimeout
+	}
+	err = d.call(opts.Context, opMutateIn, "", opts.Cas == 0, func() (err error) {
+		res, err = d.collection.MutateIn(id, ops, opts)
+		return err
+	})
+	return
+}
+
+func (d *db) remove(id string, opts *gocb.RemoveOptions) (res *gocb.MutationResult, err error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = config.Get().Database.OperationTimeout
+	}
+	err = d.call(opts.Context, opRemove, "", false, func() (err error) {
+		res, err = d.collection.Remove(id, opts)
+		return err
+	})
+	return
+}
+
+// query measures the time until the first results. Errors while reading the
+// rows are not counted. The named parameters are left out of the span, since
+// they hold user data.
+func (d *db) query(statement string, opts *gocb.QueryOptions) (res *gocb.QueryResult, err error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = config.Get().Database.QueryTimeout
+	}
+	readOnly := strings.HasPrefix(strings.TrimSpace(strings.ToUpper(statement)), "SELECT")
+	err = d.call(opts.Context, opQuery, statement, readOnly, func() (err error) {
+		res, err = d.scope.Query(statement, opts)
+		return err
+	})
+	return
+}
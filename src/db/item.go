@@ -2,10 +2,15 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/couchbase/gocb/v2"
 	"github.com/rs/xid"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/filter"
 	"github.com/shoppinglist/log"
 	"github.com/shoppinglist/models"
 	"strings"
@@ -15,16 +20,38 @@ import (
 type ItemsDB interface {
 	UpsertItem(ctx context.Context, inId string, item *models.Item) (id string, err error)
 	GetItem(ctx context.Context, id string) (item *models.Item, err error)
+	// GetItemCas is GetItem that also returns the CAS of the item, which
+	// BuyItem checks.
+	GetItemCas(ctx context.Context, id string) (item *models.Item, cas gocb.Cas, err error)
 	GetItems(ctx context.Context, q *PaginationQuery, searchQuery string) (items []*models.ItemWithID, total int, err error)
+	GetItemsAfter(ctx context.Context, q *CursorQuery) (items []*models.ItemWithID, next *Cursor, total int, err error)
 	//SearchItems(ctx context.Context, query string) (items []*models.ItemWithID, err error)
 	DeleteItem(ctx context.Context, id string) (err error)
-	BuyItem(ctx context.Context, id string, bought bool) (err error)
+	BuyItem(ctx context.Context, id string, cas gocb.Cas, bought bool, expires int64) (err error)
+	FindItem(ctx context.Context, title string, unit string) (item *models.ItemWithID, err error)
+	MergeItem(ctx context.Context, item *models.Item) (id string, err error)
+	RemoveItemSources(ctx context.Context, plan string, meal string) (err error)
+	ClearItems(ctx context.Context) (ids []string, err error)
+	GetItemsByID(ctx context.Context, ids []string) (items []*models.ItemWithID, err error)
+	GetItemsByShop(ctx context.Context, shops []string) (items []*models.ItemWithID, err error)
+	GetShops(ctx context.Context) (shops []*models.Shop, err error)
 }
 
+// amountEpsilon absorbs float rounding when scaled amounts are taken back.
+const amountEpsilon = 1e-9
+
+// ItemFields are the indexed item fields, which are also the ones items can be sorted by.
+var ItemFields = []string{"title", "amount", "unit", "bought", "shop"}
+
+// NewItemsDB connects to the items collection, or returns the in-memory
+// backend if the configured database backend is "memory".
 func NewItemsDB(ctx context.Context, bought sql.NullBool) (ItemsDB, error) {
+	if config.Get().Database.Backend == BackendMemory {
+		return NewMemoryItemsDB(bought), nil
+	}
 	db := &db{
 		collectionName: "items",
-		fields:         []string{"title", "amount", "unit", "bought", "shop"},
+		fields:         ItemFields,
 		bought:         bought,
 	}
 	err := db.init(ctx)
@@ -35,6 +62,8 @@ func NewItemsDB(ctx context.Context, bought sql.NullBool) (ItemsDB, error) {
 }
 
 func (d *db) UpsertItem(ctx context.Context, inId string, item *models.Item) (outId string, err error) {
+	ctx, end := d.trace(ctx, "UpsertItem")
+	defer end(&err)
 	outId = inId
 	if outId == "" {
 		outId = xid.New().String()
@@ -47,22 +76,35 @@ func (d *db) UpsertItem(ctx context.Context, inId string, item *models.Item) (ou
 		item.Base.Created = time.Now().UTC().UnixMilli()
 	}
 
-	_, err = d.collection.Upsert(outId, item,
+	_, err = d.upsert(outId, item,
 		&gocb.UpsertOptions{Context: ctx})
 	if err != nil {
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("Upserting a document failed")
 		return
 
 	}
-	log.Logger().Info().Msgf("Item created: %s\n", inId)
+	log.Ctx(ctx).Info().Msgf("Item created: %s\n", inId)
 	return
 }
 
 func (d *db) GetItem(ctx context.Context, id string) (item *models.Item, err error) {
-	getResult, err := d.collection.Get(id,
+	ctx, end := d.trace(ctx, "GetItem")
+	defer end(&err)
+	item, _, err = d.getItem(ctx, id)
+	return
+}
+
+func (d *db) GetItemCas(ctx context.Context, id string) (item *models.Item, cas gocb.Cas, err error) {
+	ctx, end := d.trace(ctx, "GetItemCas")
+	defer end(&err)
+	return d.getItem(ctx, id)
+}
+
+func (d *db) getItem(ctx context.Context, id string) (item *models.Item, cas gocb.Cas, err error) {
+	getResult, err := d.get(id,
 		&gocb.GetOptions{Context: ctx})
 	if err != nil {
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("Getting a document failed")
 		return
 
 	}
@@ -70,35 +112,43 @@ func (d *db) GetItem(ctx context.Context, id string) (item *models.Item, err err
 	item = &models.Item{}
 	err = getResult.Content(item)
 	if err != nil {
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
 		return
 	}
 
 	if d.bought.Valid {
 		if item.Bought != d.bought.Bool {
-			return nil, nil
+			return nil, 0, nil
 		}
 	}
 
-	return
+	return item, getResult.Cas(), nil
 }
 
-func (d *db) BuyItem(ctx context.Context, id string, bought bool) (err error) {
+// BuyItem moves the item between the to-buy and bought lists. The expiry date
+// is only meaningful for bought items and should be zero when restoring. It
+// returns gocb.ErrCasMismatch if the item changed since GetItemCas returned
+// cas, so that an item is not moved twice by concurrent requests.
+func (d *db) BuyItem(ctx context.Context, id string, cas gocb.Cas, bought bool, expires int64) (err error) {
+	ctx, end := d.trace(ctx, "BuyItem")
+	defer end(&err)
 
 	mops := []gocb.MutateInSpec{
 		gocb.ReplaceSpec("bought", bought, &gocb.ReplaceSpecOptions{}),
+		gocb.UpsertSpec("expires", expires, &gocb.UpsertSpecOptions{}),
 	}
 	if d.collection == nil {
 		err = fmt.Errorf("collection is nil")
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("No collection")
 		return
 	}
-	_, err = d.collection.MutateIn(id, mops, &gocb.MutateInOptions{
+	_, err = d.mutateIn(id, mops, &gocb.MutateInOptions{
 		Context: ctx,
+		Cas:     cas,
 		//Timeout: 10050 * time.Millisecond,
 	})
 	if err != nil {
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("Updating a document failed")
 		return
 	}
 
@@ -106,82 +156,419 @@ func (d *db) BuyItem(ctx context.Context, id string, bought bool) (err error) {
 }
 
 func (d *db) GetItems(ctx context.Context, q *PaginationQuery, searchQuery string) (items []*models.ItemWithID, total int, err error) {
+	ctx, end := d.trace(ctx, "GetItems")
+	defer end(&err)
 
 	searchQuery = strings.TrimSpace(searchQuery)
+	params := map[string]interface{}{
+		"searchQuery": searchQuery,
+	}
+	where := d.itemsFilter(searchQuery, q.Filter, params)
+
+	query := "SELECT meta(x).id, x.* FROM items x WHERE 1=1" + where
+
+	clauses, err := d.paginate(q, "meta(x).id ASC")
+	if err != nil {
+		return
+	}
+	query += clauses
+
+	log.Ctx(ctx).Info().Msgf("Query: %s", query)
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	items = []*models.ItemWithID{}
+	for queryResult.Next() {
+		var item models.ItemWithID
+		err = queryResult.Row(&item)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		items = append(items, &item)
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+
+	total, err = d.countItems(ctx, where, params)
+	return
+}
 
-	query := "SELECT meta(x).id, x.* FROM items x WHERE 1=1"
-	queryTotal := "SELECT COUNT(*) as total FROM items x WHERE 1=1"
+// GetItemsAfter returns the page of items after the cursor, and the cursor of
+// the next page, which is nil on the last page. The total is zero unless the
+// query asks for it.
+func (d *db) GetItemsAfter(ctx context.Context, q *CursorQuery) (items []*models.ItemWithID, next *Cursor, total int, err error) {
+	ctx, end := d.trace(ctx, "GetItemsAfter")
+	defer end(&err)
+	list := listName(d.bought)
+	if err = q.checkAfter(list); err != nil {
+		return
+	}
 
+	searchQuery := strings.TrimSpace(q.Query)
+	params := map[string]interface{}{
+		"searchQuery": searchQuery,
+	}
+	where := d.itemsFilter(searchQuery, q.Filter, params)
+
+	after, orderBy, err := d.keyset(q, params)
+	if err != nil {
+		return
+	}
+	query := "SELECT meta(x).id, x.*"
+	if q.Sort != "" {
+		query += fmt.Sprintf(", %s AS cursorValue", sortPath(q.Sort))
+	}
+	// One item more than the page tells whether there is a next page.
+	query += " FROM items x WHERE 1=1" + where + after + orderBy + fmt.Sprintf("\nLIMIT %d", q.Limit+1)
+
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	items = []*models.ItemWithID{}
+	var last any
+	for queryResult.Next() {
+		var row struct {
+			models.ItemWithID
+			CursorValue any `json:"cursorValue"`
+		}
+		err = queryResult.Row(&row)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		if len(items) == q.Limit {
+			next = q.next(list, items[len(items)-1].ID, last)
+			continue
+		}
+		items = append(items, &row.ItemWithID)
+		last = row.CursorValue
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+
+	if q.IncludeTotal {
+		delete(params, "afterValue")
+		delete(params, "afterId")
+		total, err = d.countItems(ctx, where, params)
+	}
+	return
+}
+
+// itemsFilter returns the conditions selecting the items of the list that
+// match the search and the filter expression, adding their values to params.
+func (d *db) itemsFilter(searchQuery string, expr filter.Expr, params map[string]interface{}) (where string) {
 	if d.bought.Valid {
 		if d.bought.Bool {
-			query += fmt.Sprintf("\nAND x.bought = true")
-			queryTotal += fmt.Sprintf("\nAND x.bought = true")
+			where += "\nAND x.bought = true"
 		} else {
-			query += fmt.Sprintf("\nAND x.bought = false")
-			queryTotal += fmt.Sprintf("\nAND x.bought = false")
+			where += "\nAND x.bought = false"
 		}
 	}
-
 	if searchQuery != "" {
-		query += fmt.Sprintf("\nAND SEARCH(x, $searchQuery)")
-		queryTotal += fmt.Sprintf("\nAND SEARCH(x, $searchQuery)")
+		where += "\nAND SEARCH(x, $searchQuery)"
+	}
+	if expr != nil {
+		where += filter.N1QL(expr, params)
 	}
+	return
+}
 
-	if q.Order == "" {
-		q.Order = "ASC"
+func (d *db) countItems(ctx context.Context, where string, params map[string]interface{}) (total int, err error) {
+	queryTotal := "SELECT COUNT(*) as total FROM items x WHERE 1=1" + where
+	queryResultTotal, err := d.query(queryTotal, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
 	}
-	if q.Sort != "" {
-		query += fmt.Sprintf("\nORDER BY x.%s %s, meta(x).id ASC", q.Sort, q.Order)
-	} else {
-		query += fmt.Sprintf("\nORDER BY meta(x).id ASC")
+	var totalResult models.Total
+	err = queryResultTotal.One(&totalResult)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Reading the count failed")
+		return
+	}
+	total = totalResult.Total
+	return
+}
+
+// FindItem returns the item with the same title and unit that is waiting to be
+// bought, or nil if there is none. It sees the items written just before, so
+// that merges find the items of earlier merges.
+func (d *db) FindItem(ctx context.Context, title string, unit string) (item *models.ItemWithID, err error) {
+	ctx, end := d.trace(ctx, "FindItem")
+	defer end(&err)
+	query := "SELECT meta(x).id, x.* FROM items x WHERE x.bought = false" +
+		"\nAND LOWER(x.title) = LOWER($title) AND x.unit = $unit" +
+		"\nORDER BY meta(x).id ASC LIMIT 1"
+	params := map[string]interface{}{
+		"title": strings.TrimSpace(title),
+		"unit":  unit,
+	}
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params,
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
 	}
-	if q.Start != 0 {
-		query += fmt.Sprintf("\nOFFSET %d ", q.Start)
+	for queryResult.Next() {
+		item = &models.ItemWithID{}
+		err = queryResult.Row(item)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
 	}
-	if q.End != 0 {
-		query += fmt.Sprintf("\nLIMIT %d ", q.End-q.Start)
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
 	}
 
-	log.Logger().Info().Msgf("Query: %s", query)
+	return
+}
+
+// MergeItem adds the item to the to-buy list. If an item with the same title
+// and unit is already waiting to be bought, its amount is increased instead.
+// Concurrent merges neither lose amounts nor add the item twice: the existing
+// item is only replaced if it did not change since it was read, and new items
+// get a key derived from the title and unit, see insertMerged.
+func (d *db) MergeItem(ctx context.Context, item *models.Item) (id string, err error) {
+	ctx, end := d.trace(ctx, "MergeItem")
+	defer end(&err)
+	for i := 0; i < CasRetries; i++ {
+		existing, err := d.FindItem(ctx, item.Title, item.Unit)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			id, err = d.insertMerged(ctx, item)
+		} else {
+			id, err = d.addToItem(ctx, existing.ID, item)
+		}
+		if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentExists) {
+			continue
+		}
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Merging an item failed")
+			return "", err
+		}
+		log.Ctx(ctx).Info().Msgf("Item merged: %s\n", id)
+		return id, nil
+	}
+	err = fmt.Errorf("merging item %q: %w", item.Title, gocb.ErrCasMismatch)
+	log.Ctx(ctx).Err(err).Msg("Giving up after concurrent changes")
+	return "", err
+}
+
+// addToItem adds the amount and the sources of item to the stored item. It
+// returns gocb.ErrCasMismatch if the stored item changed since it was found,
+// or is not waiting to be bought any more.
+func (d *db) addToItem(ctx context.Context, id string, item *models.Item) (string, error) {
+	getResult, err := d.get(id, &gocb.GetOptions{Context: ctx})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return "", fmt.Errorf("%w: %s was deleted", gocb.ErrCasMismatch, id)
+	}
+	if err != nil {
+		return "", err
+	}
+	existing := &models.Item{}
+	if err = getResult.Content(existing); err != nil {
+		return "", err
+	}
+	if existing.Bought {
+		return "", fmt.Errorf("%w: %s was bought", gocb.ErrCasMismatch, id)
+	}
+
+	existing.Amount += item.Amount
+	if existing.Shop == "" {
+		existing.Shop = item.Shop
+	}
+	existing.Sources = append(existing.Sources, item.Sources...)
+	existing.Base.Updated = time.Now().UTC().UnixMilli()
+	_, err = d.replace(id, existing, &gocb.ReplaceOptions{Context: ctx, Cas: getResult.Cas()})
+	return id, err
+}
+
+// insertMerged inserts the item under the first of the keys derived from its
+// title and unit, such as "item:<hash>", "item:<hash>-2" and so on, that is
+// not taken by an item bought before. Merges that miss each other's items in
+// FindItem walk the same keys, so only one of them inserts the item and the
+// others get gocb.ErrDocumentExists. The title is hashed, since the IDs end
+// up in URLs.
+func (d *db) insertMerged(ctx context.Context, item *models.Item) (id string, err error) {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(item.Title)) + "|" + item.Unit))
+	key := Key("item", hex.EncodeToString(hash[:10]))
+	for n := 1; ; n++ {
+		id = key
+		if n > 1 {
+			id = fmt.Sprintf("%s-%d", key, n)
+		}
+		getResult, err := d.get(id, &gocb.GetOptions{Context: ctx})
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		var stored models.Item
+		if err = getResult.Content(&stored); err != nil {
+			return "", err
+		}
+		if !stored.Bought {
+			return "", fmt.Errorf("%w: %s", gocb.ErrDocumentExists, id)
+		}
+	}
+
+	item.Bought = false
+	item.Base.Updated = time.Now().UTC().UnixMilli()
+	if item.Base.Created == 0 {
+		item.Base.Created = item.Base.Updated
+	}
+	_, err = d.insert(id, item, &gocb.InsertOptions{Context: ctx})
+	return id, err
+}
+
+// RemoveItemSources takes back the amounts that were generated for the plan
+// from the to-buy list. If meal is not empty, only that meal is taken back.
+// Items left with nothing to buy are deleted.
+func (d *db) RemoveItemSources(ctx context.Context, plan string, meal string) (err error) {
+	ctx, end := d.trace(ctx, "RemoveItemSources")
+	defer end(&err)
+	query := "SELECT meta(x).id, x.* FROM items x WHERE x.bought = false" +
+		"\nAND ANY s IN x.sources SATISFIES s.plan = $plan AND ($meal = \"\" OR s.meal = $meal) END"
 	params := map[string]interface{}{
-		"searchQuery": searchQuery,
+		"plan": plan,
+		"meal": meal,
 	}
-	queryResult, err := d.scope.Query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
 	if err != nil {
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("Query failed")
 		return
 	}
-	items = []*models.ItemWithID{}
+	var items []*models.ItemWithID
 	for queryResult.Next() {
 		var item models.ItemWithID
 		err = queryResult.Row(&item)
 		if err != nil {
-			log.Logger().Err(err)
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
 			return
 		}
 		items = append(items, &item)
 	}
 	if err = queryResult.Err(); err != nil {
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("Query failed")
 		return
 	}
 
-	paramsTotal := map[string]interface{}{
-		"searchQuery": searchQuery,
+	for _, item := range items {
+		sources := make([]*models.ItemSource, 0, len(item.Sources))
+		for _, source := range item.Sources {
+			if source.Plan == plan && (meal == "" || source.Meal == meal) {
+				item.Amount -= source.Amount
+				continue
+			}
+			sources = append(sources, source)
+		}
+		item.Sources = sources
+
+		if item.Amount <= amountEpsilon {
+			err = d.DeleteItem(ctx, item.ID)
+		} else {
+			_, err = d.UpsertItem(ctx, item.ID, &item.Item)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// GetItemsByID returns the items of the list with the given IDs in one query.
+// IDs that do not exist or are on the other list are left out.
+func (d *db) GetItemsByID(ctx context.Context, ids []string) (items []*models.ItemWithID, err error) {
+	ctx, end := d.trace(ctx, "GetItemsByID")
+	defer end(&err)
+	params := map[string]interface{}{
+		"ids": ids,
+	}
+	query := "SELECT meta(x).id, x.* FROM items x USE KEYS $ids WHERE 1=1" + d.itemsFilter("", nil, params)
+	return d.queryItems(ctx, query, params)
+}
+
+// GetItemsByShop returns the items of the list bought at any of the shops,
+// sorted by title. The empty name selects the items without a shop.
+func (d *db) GetItemsByShop(ctx context.Context, shops []string) (items []*models.ItemWithID, err error) {
+	ctx, end := d.trace(ctx, "GetItemsByShop")
+	defer end(&err)
+	params := map[string]interface{}{
+		"shops": shops,
 	}
-	queryResultTotal, err := d.scope.Query(queryTotal, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: paramsTotal})
+	query := "SELECT meta(x).id, x.* FROM items x WHERE IFMISSINGORNULL(x.shop, \"\") IN $shops" +
+		d.itemsFilter("", nil, params) +
+		"\nORDER BY x.title ASC, meta(x).id ASC"
+	return d.queryItems(ctx, query, params)
+}
+
+// GetShops counts the items of the list per shop, sorted by shop name.
+func (d *db) GetShops(ctx context.Context) (shops []*models.Shop, err error) {
+	ctx, end := d.trace(ctx, "GetShops")
+	defer end(&err)
+	params := map[string]interface{}{}
+	query := "SELECT IFMISSINGORNULL(x.shop, \"\") AS name, COUNT(*) AS items," +
+		"\nSUM(CASE WHEN x.bought = true THEN 1 ELSE 0 END) AS bought" +
+		"\nFROM items x WHERE 1=1" + d.itemsFilter("", nil, params) +
+		"\nGROUP BY IFMISSINGORNULL(x.shop, \"\")" +
+		"\nORDER BY name ASC"
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
 	if err != nil {
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("Query failed")
 		return
 	}
-	var totalResult models.Total
-	err = queryResultTotal.One(&totalResult)
-	if err != nil {
-		log.Logger().Err(err)
+	shops = []*models.Shop{}
+	for queryResult.Next() {
+		var shop models.Shop
+		err = queryResult.Row(&shop)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		shops = append(shops, &shop)
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
 		return
 	}
-	total = totalResult.Total
+	return
+}
 
+func (d *db) queryItems(ctx context.Context, query string, params map[string]interface{}) (items []*models.ItemWithID, err error) {
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	items = []*models.ItemWithID{}
+	for queryResult.Next() {
+		var item models.ItemWithID
+		err = queryResult.Row(&item)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		items = append(items, &item)
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
 	return
 }
 
@@ -210,7 +597,7 @@ func (d *db) GetItems(ctx context.Context, q *PaginationQuery, searchQuery strin
 //		row := matchResult.Row()
 //		err = row.Fields(&itemSearchResult)
 //		if err != nil {
-//			log.Logger().Err(err)
+//			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
 //			return
 //		}
 //		itemSearchResult.ID = row.ID
@@ -218,7 +605,7 @@ func (d *db) GetItems(ctx context.Context, q *PaginationQuery, searchQuery strin
 //		itemSearchResults = append(itemSearchResults, &itemSearchResult)
 //	}
 //	if err = matchResult.Err(); err != nil {
-//		log.Logger().Err(err)
+//		log.Ctx(ctx).Err(err).Msg("Query failed")
 //		return
 //	}
 //
@@ -244,13 +631,52 @@ func (d *db) GetItems(ctx context.Context, q *PaginationQuery, searchQuery strin
 //
 //}
 
+// ClearItems deletes all items on the list and returns their IDs.
+func (d *db) ClearItems(ctx context.Context) (ids []string, err error) {
+	ctx, end := d.trace(ctx, "ClearItems")
+	defer end(&err)
+	query := "DELETE FROM items x WHERE 1=1"
+	if d.bought.Valid {
+		if d.bought.Bool {
+			query += "\nAND x.bought = true"
+		} else {
+			query += "\nAND x.bought = false"
+		}
+	}
+	query += "\nRETURNING meta(x).id"
+
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	ids = []string{}
+	for queryResult.Next() {
+		var id models.ID
+		err = queryResult.Row(&id)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		ids = append(ids, id.ID)
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Items cleared: %d\n", len(ids))
+	return
+}
+
 func (d *db) DeleteItem(ctx context.Context, id string) (err error) {
-	_, err = d.collection.Remove(id,
+	ctx, end := d.trace(ctx, "DeleteItem")
+	defer end(&err)
+	_, err = d.remove(id,
 		&gocb.RemoveOptions{Context: ctx})
 	if err != nil {
-		log.Logger().Err(err)
+		log.Ctx(ctx).Err(err).Msg("Removing a document failed")
 		return
 	}
-	log.Logger().Info().Msgf("Item deleted: %s\n", id)
+	log.Ctx(ctx).Info().Msgf("Item deleted: %s\n", id)
 	return
 }
@@ -0,0 +1,438 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/filter"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendMemory keeps the data in the process instead of Couchbase: the items
+// here, the other collections in memoryCollection. It is meant for local
+// development and tests and is chosen with the database.backend setting.
+const BackendMemory = "memory"
+
+// memoryStore holds the items of the in-memory backend. Like a collection it
+// is shared by all ItemsDB instances of the process.
+type memoryStore struct {
+	mu    sync.Mutex
+	items map[string]*models.Item
+	// cas holds the CAS of every item, which changes with every write like
+	// in Couchbase. The values come from counting the writes.
+	cas    map[string]gocb.Cas
+	writes gocb.Cas
+}
+
+var memoryItems = &memoryStore{items: map[string]*models.Item{}, cas: map[string]gocb.Cas{}}
+
+// changed gives the item a new CAS after a write.
+func (s *memoryStore) changed(id string) {
+	s.writes++
+	s.cas[id] = s.writes
+}
+
+type memoryItemsDB struct {
+	store  *memoryStore
+	bought sql.NullBool
+}
+
+func NewMemoryItemsDB(bought sql.NullBool) ItemsDB {
+	return &memoryItemsDB{
+		store:  memoryItems,
+		bought: bought,
+	}
+}
+
+// copyItem keeps callers from changing stored items in place.
+func copyItem(item *models.Item) *models.Item {
+	c := *item
+	c.Sources = make([]*models.ItemSource, 0, len(item.Sources))
+	for _, source := range item.Sources {
+		s := *source
+		c.Sources = append(c.Sources, &s)
+	}
+	if len(c.Sources) == 0 {
+		c.Sources = nil
+	}
+	return &c
+}
+
+func (d *memoryItemsDB) onList(item *models.Item) bool {
+	return !d.bought.Valid || item.Bought == d.bought.Bool
+}
+
+// trace starts the span of a method, named like the Couchbase backend's, and
+// measures the call under the operation Couchbase runs for it, so that both
+// backends report the same metrics. Call end with the error of the method.
+func (d *memoryItemsDB) trace(ctx context.Context, method string, operation string) (end func(err *error)) {
+	start := time.Now()
+	_, span := tracing.Start(ctx, "db."+method, attribute.String(attributeCollection, "items"))
+	return func(err *error) {
+		observe(BackendMemory, "items", operation, start, *err)
+		tracing.End(span, spanError(*err))
+	}
+}
+
+func notFound(id string) error {
+	return fmt.Errorf("%w: %s", gocb.ErrDocumentNotFound, id)
+}
+
+func (d *memoryItemsDB) UpsertItem(ctx context.Context, inId string, item *models.Item) (outId string, err error) {
+	defer d.trace(ctx, "UpsertItem", opUpsert)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	return d.upsert(ctx, inId, item), nil
+}
+
+func (d *memoryItemsDB) upsert(ctx context.Context, inId string, item *models.Item) (outId string) {
+	outId = inId
+	if outId == "" {
+		outId = xid.New().String()
+	}
+	if item == nil {
+		item = &models.Item{Base: models.Base{}}
+	}
+	item.Base.Updated = time.Now().UTC().UnixMilli()
+	if item.Base.Created == 0 {
+		item.Base.Created = time.Now().UTC().UnixMilli()
+	}
+	d.store.items[outId] = copyItem(item)
+	d.store.changed(outId)
+	log.Ctx(ctx).Info().Msgf("Item created: %s\n", inId)
+	return
+}
+
+func (d *memoryItemsDB) GetItem(ctx context.Context, id string) (item *models.Item, err error) {
+	defer d.trace(ctx, "GetItem", opGet)(&err)
+	item, _, err = d.get(id)
+	return
+}
+
+func (d *memoryItemsDB) GetItemCas(ctx context.Context, id string) (item *models.Item, cas gocb.Cas, err error) {
+	defer d.trace(ctx, "GetItemCas", opGet)(&err)
+	return d.get(id)
+}
+
+func (d *memoryItemsDB) get(id string) (item *models.Item, cas gocb.Cas, err error) {
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	stored, ok := d.store.items[id]
+	if !ok {
+		return nil, 0, notFound(id)
+	}
+	if !d.onList(stored) {
+		return nil, 0, nil
+	}
+	return copyItem(stored), d.store.cas[id], nil
+}
+
+// list returns the items of the list that match the search and the filter,
+// ordered by the sort field and then by ID like the N1QL queries.
+func (d *memoryItemsDB) list(searchQuery string, expr filter.Expr, sortField string, order string) (items []*models.ItemWithID, err error) {
+	if sortField != "" {
+		if order, err = sortOrder(ItemFields, sortField, order); err != nil {
+			return
+		}
+	}
+	match := func(item *models.Item) bool { return true }
+	if expr != nil {
+		match = filter.Predicate(expr)
+	}
+	searchQuery = strings.ToLower(strings.TrimSpace(searchQuery))
+
+	items = []*models.ItemWithID{}
+	for id, item := range d.store.items {
+		if !d.onList(item) || !match(item) || !search(item, searchQuery) {
+			continue
+		}
+		items = append(items, &models.ItemWithID{Item: *copyItem(item), ID: id})
+	}
+
+	var value func(item *models.Item) any
+	if sortField != "" {
+		value = filter.Items[sortField].Value
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if value != nil {
+			c := filter.Compare(value(&items[i].Item), value(&items[j].Item))
+			if order == "DESC" {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return items[i].ID < items[j].ID
+	})
+	return
+}
+
+// search approximates the full text search of Couchbase by looking for the
+// query in the text fields.
+func search(item *models.Item, searchQuery string) bool {
+	return searchText(searchQuery, item.Title, item.Unit, item.Shop, item.Category)
+}
+
+func (d *memoryItemsDB) GetItems(ctx context.Context, q *PaginationQuery, searchQuery string) (items []*models.ItemWithID, total int, err error) {
+	defer d.trace(ctx, "GetItems", opQuery)(&err)
+	if err = checkRange(q); err != nil {
+		return
+	}
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	items, err = d.list(searchQuery, q.Filter, q.Sort, q.Order)
+	if err != nil {
+		return
+	}
+	total = len(items)
+	start, end := q.Start, q.End
+	if start > total {
+		start = total
+	}
+	if end == 0 || end > total {
+		end = total
+	}
+	return items[start:end], total, nil
+}
+
+func (d *memoryItemsDB) GetItemsAfter(ctx context.Context, q *CursorQuery) (items []*models.ItemWithID, next *Cursor, total int, err error) {
+	defer d.trace(ctx, "GetItemsAfter", opQuery)(&err)
+	list := listName(d.bought)
+	if err = q.checkAfter(list); err != nil {
+		return
+	}
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	all, err := d.list(q.Query, q.Filter, q.Sort, q.Order)
+	if err != nil {
+		return
+	}
+	var value func(item *models.Item) any
+	if q.Sort != "" {
+		value = filter.Items[q.Sort].Value
+	}
+	descending := strings.ToUpper(q.Order) == "DESC"
+
+	items = []*models.ItemWithID{}
+	for _, item := range all {
+		if q.After != nil {
+			c := 0
+			if value != nil {
+				c = filter.Compare(value(&item.Item), q.After.Value)
+				if descending {
+					c = -c
+				}
+			}
+			if c < 0 || (c == 0 && item.ID <= q.After.ID) {
+				continue
+			}
+		}
+		if len(items) == q.Limit {
+			last := items[len(items)-1]
+			next = q.next(list, last.ID, nil)
+			if value != nil {
+				next.Value = value(&last.Item)
+			}
+			break
+		}
+		items = append(items, item)
+	}
+	if q.IncludeTotal {
+		total = len(all)
+	}
+	return
+}
+
+func (d *memoryItemsDB) DeleteItem(ctx context.Context, id string) (err error) {
+	defer d.trace(ctx, "DeleteItem", opRemove)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	if _, ok := d.store.items[id]; !ok {
+		return notFound(id)
+	}
+	delete(d.store.items, id)
+	log.Ctx(ctx).Info().Msgf("Item deleted: %s\n", id)
+	return
+}
+
+func (d *memoryItemsDB) BuyItem(ctx context.Context, id string, cas gocb.Cas, bought bool, expires int64) (err error) {
+	defer d.trace(ctx, "BuyItem", opMutateIn)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	item, ok := d.store.items[id]
+	if !ok {
+		return notFound(id)
+	}
+	if cas != 0 && cas != d.store.cas[id] {
+		return fmt.Errorf("%w: %s", gocb.ErrCasMismatch, id)
+	}
+	item.Bought = bought
+	item.Expires = expires
+	d.store.changed(id)
+	return
+}
+
+func (d *memoryItemsDB) FindItem(ctx context.Context, title string, unit string) (item *models.ItemWithID, err error) {
+	defer d.trace(ctx, "FindItem", opQuery)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	return d.find(title, unit), nil
+}
+
+func (d *memoryItemsDB) find(title string, unit string) (item *models.ItemWithID) {
+	title = strings.TrimSpace(title)
+	for id, stored := range d.store.items {
+		if stored.Bought || stored.Unit != unit || !strings.EqualFold(stored.Title, title) {
+			continue
+		}
+		if item == nil || id < item.ID {
+			item = &models.ItemWithID{Item: *copyItem(stored), ID: id}
+		}
+	}
+	return
+}
+
+func (d *memoryItemsDB) MergeItem(ctx context.Context, item *models.Item) (id string, err error) {
+	defer d.trace(ctx, "MergeItem", opUpsert)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	existing := d.find(item.Title, item.Unit)
+	if existing == nil {
+		item.Bought = false
+		return d.upsert(ctx, "", item), nil
+	}
+
+	existing.Amount += item.Amount
+	if existing.Shop == "" {
+		existing.Shop = item.Shop
+	}
+	existing.Sources = append(existing.Sources, item.Sources...)
+	return d.upsert(ctx, existing.ID, &existing.Item), nil
+}
+
+func (d *memoryItemsDB) RemoveItemSources(ctx context.Context, plan string, meal string) (err error) {
+	defer d.trace(ctx, "RemoveItemSources", opQuery)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	for id, item := range d.store.items {
+		if item.Bought {
+			continue
+		}
+		sources := make([]*models.ItemSource, 0, len(item.Sources))
+		for _, source := range item.Sources {
+			if source.Plan == plan && (meal == "" || source.Meal == meal) {
+				item.Amount -= source.Amount
+				continue
+			}
+			sources = append(sources, source)
+		}
+		if len(sources) == len(item.Sources) {
+			continue
+		}
+		item.Sources = sources
+
+		if item.Amount <= amountEpsilon {
+			delete(d.store.items, id)
+		} else {
+			d.upsert(ctx, id, item)
+		}
+	}
+	return
+}
+
+func (d *memoryItemsDB) ClearItems(ctx context.Context) (ids []string, err error) {
+	defer d.trace(ctx, "ClearItems", opQuery)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	ids = []string{}
+	for id, item := range d.store.items {
+		if d.onList(item) {
+			ids = append(ids, id)
+			delete(d.store.items, id)
+		}
+	}
+	sort.Strings(ids)
+	log.Ctx(ctx).Info().Msgf("Items cleared: %d\n", len(ids))
+	return
+}
+
+func (d *memoryItemsDB) GetItemsByID(ctx context.Context, ids []string) (items []*models.ItemWithID, err error) {
+	defer d.trace(ctx, "GetItemsByID", opQuery)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	items = []*models.ItemWithID{}
+	for _, id := range ids {
+		if item, ok := d.store.items[id]; ok && d.onList(item) {
+			items = append(items, &models.ItemWithID{Item: *copyItem(item), ID: id})
+		}
+	}
+	return
+}
+
+func (d *memoryItemsDB) GetItemsByShop(ctx context.Context, shops []string) (items []*models.ItemWithID, err error) {
+	defer d.trace(ctx, "GetItemsByShop", opQuery)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	wanted := map[string]bool{}
+	for _, shop := range shops {
+		wanted[shop] = true
+	}
+	items = []*models.ItemWithID{}
+	for id, item := range d.store.items {
+		if d.onList(item) && wanted[item.Shop] {
+			items = append(items, &models.ItemWithID{Item: *copyItem(item), ID: id})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Title != items[j].Title {
+			return items[i].Title < items[j].Title
+		}
+		return items[i].ID < items[j].ID
+	})
+	return
+}
+
+func (d *memoryItemsDB) GetShops(ctx context.Context) (shops []*models.Shop, err error) {
+	defer d.trace(ctx, "GetShops", opQuery)(&err)
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	byName := map[string]*models.Shop{}
+	shops = []*models.Shop{}
+	for _, item := range d.store.items {
+		if !d.onList(item) {
+			continue
+		}
+		shop, ok := byName[item.Shop]
+		if !ok {
+			shop = &models.Shop{Name: item.Shop}
+			byName[item.Shop] = shop
+			shops = append(shops, shop)
+		}
+		shop.Items++
+		if item.Bought {
+			shop.Bought++
+		}
+	}
+	sort.Slice(shops, func(i, j int) bool {
+		return shops[i].Name < shops[j].Name
+	})
+	return
+}
@@ -0,0 +1,633 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/filter"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memoryCollection is a collection of the in-memory backend other than the
+// items. Its documents are kept in memoryDocuments as JSON, the way Couchbase
+// stores them, so that backups and restores see them as well. The methods
+// other than trace expect memoryDocuments to be locked.
+type memoryCollection struct {
+	name string
+	// fields are the ones the documents can be sorted by.
+	fields []string
+	// private holds the documents instead of memoryDocuments if it is set,
+	// for tests that must not see the documents of other tests.
+	private map[string]json.RawMessage
+}
+
+func (c *memoryCollection) trace(ctx context.Context, method string, operation string) (end func(err *error)) {
+	start := time.Now()
+	_, span := tracing.Start(ctx, "db."+method, attribute.String(attributeCollection, c.name))
+	return func(err *error) {
+		observe(BackendMemory, c.name, operation, start, *err)
+		tracing.End(span, spanError(*err))
+	}
+}
+
+func (c *memoryCollection) documents() map[string]json.RawMessage {
+	if c.private != nil {
+		return c.private
+	}
+	documents, ok := memoryDocuments.collections[c.name]
+	if !ok {
+		documents = map[string]json.RawMessage{}
+		memoryDocuments.collections[c.name] = documents
+	}
+	return documents
+}
+
+// get decodes the document into doc.
+func (c *memoryCollection) get(id string, doc any) error {
+	body, ok := c.documents()[id]
+	if !ok {
+		return notFound(id)
+	}
+	if err := json.Unmarshal(body, doc); err != nil {
+		return fmt.Errorf("%w: %s: %v", gocb.ErrDecodingFailure, id, err)
+	}
+	return nil
+}
+
+func (c *memoryCollection) put(id string, doc any) error {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", gocb.ErrEncodingFailure, id, err)
+	}
+	c.documents()[id] = body
+	return nil
+}
+
+func (c *memoryCollection) remove(id string) error {
+	if _, ok := c.documents()[id]; !ok {
+		return notFound(id)
+	}
+	delete(c.documents(), id)
+	return nil
+}
+
+// ids returns the IDs of the documents for which match returns true, in
+// ascending order.
+func (c *memoryCollection) ids(match func(body json.RawMessage) bool) (ids []string) {
+	ids = []string{}
+	for id, body := range c.documents() {
+		if match == nil || match(body) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return
+}
+
+// page returns the IDs of the documents that match on the page of the query,
+// ordered by the sort field and then by ID like the N1QL queries, and how
+// many match in all.
+func (c *memoryCollection) page(q *PaginationQuery, match func(body json.RawMessage) bool) (ids []string, total int, err error) {
+	order := ""
+	if q.Sort != "" {
+		if order, err = sortOrder(c.fields, q.Sort, q.Order); err != nil {
+			return
+		}
+	}
+	if err = checkRange(q); err != nil {
+		return
+	}
+	ids = c.ids(match)
+	if q.Sort != "" {
+		values := make(map[string]any, len(ids))
+		for _, id := range ids {
+			var fields map[string]any
+			if err = json.Unmarshal(c.documents()[id], &fields); err != nil {
+				return nil, 0, fmt.Errorf("%w: %s: %v", gocb.ErrDecodingFailure, id, err)
+			}
+			values[id] = fields[q.Sort]
+		}
+		sort.SliceStable(ids, func(i, j int) bool {
+			c := filter.Compare(values[ids[i]], values[ids[j]])
+			if order == "DESC" {
+				c = -c
+			}
+			return c < 0
+		})
+	}
+	total = len(ids)
+	start, end := q.Start, q.End
+	if start > total {
+		start = total
+	}
+	if end == 0 || end > total {
+		end = total
+	}
+	return ids[start:end], total, nil
+}
+
+// searchText approximates the full text search of Couchbase by looking for
+// the query in the texts.
+func searchText(searchQuery string, texts ...string) bool {
+	searchQuery = strings.ToLower(strings.TrimSpace(searchQuery))
+	if searchQuery == "" {
+		return true
+	}
+	for _, text := range texts {
+		if strings.Contains(strings.ToLower(text), searchQuery) {
+			return true
+		}
+	}
+	return false
+}
+
+// touch sets the times of a document that is written.
+func touch(base *models.Base) {
+	base.Updated = time.Now().UTC().UnixMilli()
+	if base.Created == 0 {
+		base.Created = base.Updated
+	}
+}
+
+type memoryPantryDB struct {
+	memoryCollection
+}
+
+// NewMemoryPantryDB returns the pantry of the in-memory backend.
+func NewMemoryPantryDB() PantryDB {
+	return &memoryPantryDB{memoryCollection{name: "pantry", fields: PantryFields}}
+}
+
+// update applies update to the stored pantry item. If create is true, a
+// missing item is created from an empty one.
+func (d *memoryPantryDB) update(id string, create bool, update func(item *models.PantryItem)) (item *models.PantryItem, err error) {
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	item = &models.PantryItem{}
+	if err = d.get(id, item); err != nil && !(create && errors.Is(err, gocb.ErrDocumentNotFound)) {
+		return nil, err
+	}
+	update(item)
+	touch(&item.Base)
+	if err = d.put(id, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (d *memoryPantryDB) StockItem(ctx context.Context, item *models.Item) (id string, err error) {
+	defer d.trace(ctx, "StockItem", opReplace)(&err)
+	id = PantryKey(item.Title, item.Unit)
+	_, err = d.update(id, true, func(pantryItem *models.PantryItem) {
+		if pantryItem.Title == "" {
+			pantryItem.Title = strings.TrimSpace(item.Title)
+			pantryItem.Unit = item.Unit
+		}
+		if item.Category != "" {
+			pantryItem.Category = item.Category
+		}
+		if pantryItem.Amount <= 0 || pantryItem.Expires == 0 ||
+			(item.Expires != 0 && item.Expires < pantryItem.Expires) {
+			pantryItem.Expires = item.Expires
+		}
+		pantryItem.Amount += item.Amount
+		if item.Shop != "" {
+			pantryItem.Shop = item.Shop
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Ctx(ctx).Info().Msgf("Pantry item stocked: %s\n", id)
+	return
+}
+
+func (d *memoryPantryDB) UnstockItem(ctx context.Context, item *models.Item) (err error) {
+	defer d.trace(ctx, "UnstockItem", opReplace)(&err)
+	id := PantryKey(item.Title, item.Unit)
+	_, err = d.update(id, false, func(pantryItem *models.PantryItem) {
+		takeStock(pantryItem, item.Amount)
+	})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+	return
+}
+
+func (d *memoryPantryDB) UpsertPantryItem(ctx context.Context, id string, item *models.PantryItem) (err error) {
+	defer d.trace(ctx, "UpsertPantryItem", opUpsert)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	touch(&item.Base)
+	return d.put(id, item)
+}
+
+func (d *memoryPantryDB) GetPantryItem(ctx context.Context, id string) (item *models.PantryItem, err error) {
+	defer d.trace(ctx, "GetPantryItem", opGet)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	item = &models.PantryItem{}
+	if err = d.get(id, item); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (d *memoryPantryDB) GetPantryItems(ctx context.Context, q *PaginationQuery, searchQuery string) (items []*models.PantryItemWithID, total int, err error) {
+	defer d.trace(ctx, "GetPantryItems", opQuery)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	ids, total, err := d.page(q, func(body json.RawMessage) bool {
+		var item models.PantryItem
+		return json.Unmarshal(body, &item) == nil &&
+			searchText(searchQuery, item.Title, item.Unit, item.Shop, item.Category)
+	})
+	if err != nil {
+		return
+	}
+	items, err = d.items(ids)
+	return
+}
+
+func (d *memoryPantryDB) GetLowStockItems(ctx context.Context) (items []*models.PantryItemWithID, err error) {
+	defer d.trace(ctx, "GetLowStockItems", opQuery)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	return d.items(d.ids(func(body json.RawMessage) bool {
+		var item models.PantryItem
+		return json.Unmarshal(body, &item) == nil && item.Threshold > 0 && item.Amount < item.Threshold
+	}))
+}
+
+func (d *memoryPantryDB) GetExpiringPantryItems(ctx context.Context, before int64) (items []*models.PantryItemWithID, err error) {
+	defer d.trace(ctx, "GetExpiringPantryItems", opQuery)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	items, err = d.items(d.ids(func(body json.RawMessage) bool {
+		var item models.PantryItem
+		return json.Unmarshal(body, &item) == nil && item.Amount > 0 && item.Expires > 0 && item.Expires <= before
+	}))
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Expires < items[j].Expires
+	})
+	return
+}
+
+func (d *memoryPantryDB) MarkPantryItemNotified(ctx context.Context, id string, expires int64) (err error) {
+	defer d.trace(ctx, "MarkPantryItemNotified", opReplace)(&err)
+	_, err = d.update(id, false, func(item *models.PantryItem) {
+		if item.Expires == expires {
+			item.Notified = expires
+		}
+	})
+	return
+}
+
+func (d *memoryPantryDB) items(ids []string) (items []*models.PantryItemWithID, err error) {
+	items = make([]*models.PantryItemWithID, 0, len(ids))
+	for _, id := range ids {
+		item := &models.PantryItemWithID{ID: id}
+		if err = d.get(id, &item.PantryItem); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return
+}
+
+func (d *memoryPantryDB) ConsumePantryItem(ctx context.Context, id string, amount float64) (item *models.PantryItem, err error) {
+	defer d.trace(ctx, "ConsumePantryItem", opReplace)(&err)
+	return d.update(id, false, func(item *models.PantryItem) {
+		item.Consumed += takeStock(item, amount)
+	})
+}
+
+func (d *memoryPantryDB) DiscardPantryItem(ctx context.Context, id string, amount float64) (item *models.PantryItem, err error) {
+	defer d.trace(ctx, "DiscardPantryItem", opReplace)(&err)
+	return d.update(id, false, func(item *models.PantryItem) {
+		if amount == 0 {
+			amount = item.Amount
+		}
+		item.Discarded += takeStock(item, amount)
+	})
+}
+
+func (d *memoryPantryDB) DeletePantryItem(ctx context.Context, id string) (err error) {
+	defer d.trace(ctx, "DeletePantryItem", opRemove)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	return d.remove(id)
+}
+
+type memoryPlansDB struct {
+	memoryCollection
+}
+
+// NewMemoryPlansDB returns the plans of the in-memory backend.
+func NewMemoryPlansDB() PlansDB {
+	return &memoryPlansDB{memoryCollection{name: "plans"}}
+}
+
+func (d *memoryPlansDB) UpsertPlan(ctx context.Context, plan *models.Plan) (err error) {
+	defer d.trace(ctx, "UpsertPlan", opUpsert)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	touch(&plan.Base)
+	return d.put(plan.Week, plan)
+}
+
+func (d *memoryPlansDB) GetPlan(ctx context.Context, week string) (plan *models.Plan, err error) {
+	defer d.trace(ctx, "GetPlan", opGet)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	plan = &models.Plan{}
+	err = d.get(week, plan)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return &models.Plan{Week: week, Meals: []*models.Meal{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (d *memoryPlansDB) DeletePlan(ctx context.Context, week string) (err error) {
+	defer d.trace(ctx, "DeletePlan", opRemove)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	return d.remove(week)
+}
+
+type memoryRecipesDB struct {
+	memoryCollection
+}
+
+// NewMemoryRecipesDB returns the recipes of the in-memory backend.
+func NewMemoryRecipesDB() RecipesDB {
+	return &memoryRecipesDB{memoryCollection{name: "recipes", fields: RecipeFields}}
+}
+
+func (d *memoryRecipesDB) UpsertRecipe(ctx context.Context, inId string, recipe *models.Recipe) (outId string, err error) {
+	defer d.trace(ctx, "UpsertRecipe", opUpsert)(&err)
+	outId = inId
+	if outId == "" {
+		outId = xid.New().String()
+	}
+	if recipe == nil {
+		recipe = &models.Recipe{Base: models.Base{}}
+	}
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	touch(&recipe.Base)
+	return outId, d.put(outId, recipe)
+}
+
+func (d *memoryRecipesDB) GetRecipe(ctx context.Context, id string) (recipe *models.Recipe, err error) {
+	defer d.trace(ctx, "GetRecipe", opGet)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	recipe = &models.Recipe{}
+	if err = d.get(id, recipe); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (d *memoryRecipesDB) GetRecipes(ctx context.Context, q *PaginationQuery, searchQuery string) (recipes []*models.RecipeWithID, total int, err error) {
+	defer d.trace(ctx, "GetRecipes", opQuery)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	ids, total, err := d.page(q, func(body json.RawMessage) bool {
+		var recipe models.Recipe
+		if json.Unmarshal(body, &recipe) != nil {
+			return false
+		}
+		texts := []string{recipe.Title}
+		for _, ingredient := range recipe.Ingredients {
+			texts = append(texts, ingredient.Title)
+		}
+		return searchText(searchQuery, texts...)
+	})
+	if err != nil {
+		return
+	}
+	recipes = make([]*models.RecipeWithID, 0, len(ids))
+	for _, id := range ids {
+		recipe := &models.RecipeWithID{ID: id}
+		if err = d.get(id, &recipe.Recipe); err != nil {
+			return nil, 0, err
+		}
+		recipes = append(recipes, recipe)
+	}
+	return
+}
+
+func (d *memoryRecipesDB) DeleteRecipe(ctx context.Context, id string) (err error) {
+	defer d.trace(ctx, "DeleteRecipe", opRemove)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	return d.remove(id)
+}
+
+type memoryWebhooksDB struct {
+	memoryCollection
+}
+
+// NewMemoryWebhooksDB returns the webhooks of the in-memory backend.
+func NewMemoryWebhooksDB() WebhooksDB {
+	return &memoryWebhooksDB{memoryCollection{name: "webhooks"}}
+}
+
+// NewPrivateMemoryWebhooksDB returns in-memory webhooks of their own, which
+// are neither shared with other instances nor backed up.
+func NewPrivateMemoryWebhooksDB() WebhooksDB {
+	return &memoryWebhooksDB{memoryCollection{name: "webhooks", private: map[string]json.RawMessage{}}}
+}
+
+func (d *memoryWebhooksDB) UpsertWebhook(ctx context.Context, inId string, webhook *models.Webhook) (outId string, err error) {
+	defer d.trace(ctx, "UpsertWebhook", opUpsert)(&err)
+	outId = inId
+	if outId == "" {
+		outId = xid.New().String()
+	}
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	touch(&webhook.Base)
+	return outId, d.put(outId, webhook)
+}
+
+func (d *memoryWebhooksDB) GetWebhook(ctx context.Context, id string) (webhook *models.Webhook, err error) {
+	defer d.trace(ctx, "GetWebhook", opGet)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	webhook = &models.Webhook{}
+	if err = d.get(id, webhook); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (d *memoryWebhooksDB) GetWebhooks(ctx context.Context, list string) (webhooks []*models.WebhookWithID, err error) {
+	defer d.trace(ctx, "GetWebhooks", opQuery)(&err)
+	return d.webhooks(func(webhook *models.Webhook) bool {
+		return webhook.List == list
+	})
+}
+
+func (d *memoryWebhooksDB) GetSubscribedWebhooks(ctx context.Context, list string, eventType string) (webhooks []*models.WebhookWithID, err error) {
+	defer d.trace(ctx, "GetSubscribedWebhooks", opQuery)(&err)
+	return d.webhooks(func(webhook *models.Webhook) bool {
+		if webhook.List != list {
+			return false
+		}
+		for _, event := range webhook.Events {
+			if event == eventType {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// webhooks returns the webhooks that match in the order of their IDs.
+func (d *memoryWebhooksDB) webhooks(match func(webhook *models.Webhook) bool) (webhooks []*models.WebhookWithID, err error) {
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	webhooks = []*models.WebhookWithID{}
+	for _, id := range d.ids(nil) {
+		webhook := &models.WebhookWithID{ID: id}
+		if err = d.get(id, &webhook.Webhook); err != nil {
+			return nil, err
+		}
+		if match(&webhook.Webhook) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return
+}
+
+func (d *memoryWebhooksDB) DeleteWebhook(ctx context.Context, id string) (err error) {
+	defer d.trace(ctx, "DeleteWebhook", opRemove)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	return d.remove(id)
+}
+
+type memoryDeliveriesDB struct {
+	memoryCollection
+}
+
+// NewMemoryDeliveriesDB returns the webhook deliveries of the in-memory
+// backend.
+func NewMemoryDeliveriesDB() DeliveriesDB {
+	return &memoryDeliveriesDB{memoryCollection{name: "deliveries"}}
+}
+
+// NewPrivateMemoryDeliveriesDB returns in-memory webhook deliveries of their
+// own, which are neither shared with other instances nor backed up.
+func NewPrivateMemoryDeliveriesDB() DeliveriesDB {
+	return &memoryDeliveriesDB{memoryCollection{name: "deliveries", private: map[string]json.RawMessage{}}}
+}
+
+func (d *memoryDeliveriesDB) UpsertDelivery(ctx context.Context, inId string, delivery *models.Delivery) (outId string, err error) {
+	defer d.trace(ctx, "UpsertDelivery", opUpsert)(&err)
+	outId = inId
+	if outId == "" {
+		outId = xid.New().String()
+	}
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	touch(&delivery.Base)
+	return outId, d.put(outId, delivery)
+}
+
+func (d *memoryDeliveriesDB) GetDelivery(ctx context.Context, id string) (delivery *models.Delivery, err error) {
+	defer d.trace(ctx, "GetDelivery", opGet)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	delivery = &models.Delivery{}
+	if err = d.get(id, delivery); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (d *memoryDeliveriesDB) GetDeliveries(ctx context.Context, q *PaginationQuery, filter *DeliveryFilter) (deliveries []*models.DeliveryWithID, total int, err error) {
+	defer d.trace(ctx, "GetDeliveries", opQuery)(&err)
+	if err = checkRange(q); err != nil {
+		return
+	}
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	deliveries, err = d.deliveries(func(delivery *models.Delivery) bool {
+		return (filter.List == "" || delivery.List == filter.List) &&
+			(filter.Webhook == "" || delivery.Webhook == filter.Webhook) &&
+			(filter.Status == "" || delivery.Status == filter.Status)
+	})
+	if err != nil {
+		return
+	}
+	// Newest first, like the N1QL query.
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].Created > deliveries[j].Created
+	})
+	total = len(deliveries)
+	start, end := q.Start, q.End
+	if start > total {
+		start = total
+	}
+	if end == 0 || end > total {
+		end = total
+	}
+	return deliveries[start:end], total, nil
+}
+
+func (d *memoryDeliveriesDB) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) (deliveries []*models.DeliveryWithID, err error) {
+	defer d.trace(ctx, "ClaimDueDeliveries", opQuery)(&err)
+	memoryDocuments.Lock()
+	defer memoryDocuments.Unlock()
+	nowMs := now.UTC().UnixMilli()
+	deliveries, err = d.deliveries(func(delivery *models.Delivery) bool {
+		return delivery.Status == models.DeliveryPending && delivery.NextAttempt <= nowMs && delivery.LockedUntil <= nowMs
+	})
+	if err != nil {
+		return
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttempt < deliveries[j].NextAttempt
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	for _, delivery := range deliveries {
+		delivery.LockedUntil = now.Add(lease).UTC().UnixMilli()
+		if err = d.put(delivery.ID, &delivery.Delivery); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// deliveries returns the deliveries that match in the order of their IDs.
+func (d *memoryDeliveriesDB) deliveries(match func(delivery *models.Delivery) bool) (deliveries []*models.DeliveryWithID, err error) {
+	deliveries = []*models.DeliveryWithID{}
+	for _, id := range d.ids(nil) {
+		delivery := &models.DeliveryWithID{ID: id}
+		if err = d.get(id, &delivery.Delivery); err != nil {
+			return nil, err
+		}
+		if match(&delivery.Delivery) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/models"
+)
+
+// migrations open every collection of the services, which creates it and
+// its indexes, see connection.prepare.
+var migrations = []struct {
+	collection string
+	open       func(ctx context.Context) error
+}{
+	{"items", func(ctx context.Context) (err error) { _, err = NewItemsDB(ctx, sql.NullBool{}); return }},
+	{"pantry", func(ctx context.Context) (err error) { _, err = NewPantryDB(ctx); return }},
+	{"plans", func(ctx context.Context) (err error) { _, err = NewPlansDB(ctx); return }},
+	{"recipes", func(ctx context.Context) (err error) { _, err = NewRecipesDB(ctx); return }},
+	{"webhooks", func(ctx context.Context) (err error) { _, err = NewWebhooksDB(ctx); return }},
+	{"deliveries", func(ctx context.Context) (err error) { _, err = NewDeliveriesDB(ctx); return }},
+	{"users", func(ctx context.Context) (err error) { _, err = NewDocumentsDB(ctx, "users"); return }},
+	{"idempotency", func(ctx context.Context) (err error) { _, err = NewIdempotencyDB(ctx); return }},
+}
+
+// Migrate creates the collections and indexes again, such as after they were
+// dropped, instead of once per process. It goes on after a collection fails
+// and reports every one; err is the first failure.
+func Migrate(ctx context.Context) (migrated []*models.Migration, err error) {
+	memory := config.Get().Database.Backend == BackendMemory
+	migrated = make([]*models.Migration, 0, len(migrations))
+	for _, m := range migrations {
+		result := &models.Migration{Collection: m.collection}
+		migrated = append(migrated, result)
+		if memory {
+			continue
+		}
+		forget(m.collection)
+		if openErr := m.open(ctx); openErr != nil {
+			result.Error = openErr.Error()
+			if err == nil {
+				err = openErr
+			}
+			continue
+		}
+		result.Migrated = true
+	}
+	return
+}
+
+// forget makes the next db of the collection prepare it again.
+func forget(collection string) {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.conn != nil {
+		delete(shared.conn.prepared, collection)
+	}
+}
@@ -0,0 +1,358 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"strings"
+	"time"
+)
+
+type PantryDB interface {
+	StockItem(ctx context.Context, item *models.Item) (id string, err error)
+	UnstockItem(ctx context.Context, item *models.Item) (err error)
+	UpsertPantryItem(ctx context.Context, id string, item *models.PantryItem) (err error)
+	GetPantryItem(ctx context.Context, id string) (item *models.PantryItem, err error)
+	GetPantryItems(ctx context.Context, q *PaginationQuery, searchQuery string) (items []*models.PantryItemWithID, total int, err error)
+	GetLowStockItems(ctx context.Context) (items []*models.PantryItemWithID, err error)
+	GetExpiringPantryItems(ctx context.Context, before int64) (items []*models.PantryItemWithID, err error)
+	MarkPantryItemNotified(ctx context.Context, id string, expires int64) (err error)
+	ConsumePantryItem(ctx context.Context, id string, amount float64) (item *models.PantryItem, err error)
+	DiscardPantryItem(ctx context.Context, id string, amount float64) (item *models.PantryItem, err error)
+	DeletePantryItem(ctx context.Context, id string) (err error)
+}
+
+// PantryFields are the indexed pantry item fields, which are also the ones pantry items can be sorted by.
+var PantryFields = []string{"title", "amount", "unit", "expires", "threshold"}
+
+func NewPantryDB(ctx context.Context) (PantryDB, error) {
+	if config.Get().Database.Backend == BackendMemory {
+		return NewMemoryPantryDB(), nil
+	}
+	db := &db{
+		collectionName: "pantry",
+		fields:         PantryFields,
+	}
+	err := db.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// PantryKey returns the pantry document ID for the title and unit, so buying
+// the same thing again adds to the existing stock.
+func PantryKey(title string, unit string) string {
+	return Key("pantry", strings.ToLower(strings.TrimSpace(title))+"|"+unit)
+}
+
+// updatePantryItem applies update to the stored pantry item using optimistic
+// locking. If create is true, a missing item is created from an empty one.
+func (d *db) updatePantryItem(ctx context.Context, id string, create bool, update func(item *models.PantryItem) error) (item *models.PantryItem, err error) {
+	for i := 0; i < CasRetries; i++ {
+		var cas gocb.Cas
+		item = &models.PantryItem{}
+		getResult, err := d.get(id, &gocb.GetOptions{Context: ctx})
+		switch {
+		case err == nil:
+			cas = getResult.Cas()
+			if err = getResult.Content(item); err != nil {
+				log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+				return nil, err
+			}
+		case create && errors.Is(err, gocb.ErrDocumentNotFound):
+		default:
+			log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+			return nil, err
+		}
+
+		if err = update(item); err != nil {
+			return nil, err
+		}
+		item.Base.Updated = time.Now().UTC().UnixMilli()
+		if item.Base.Created == 0 {
+			item.Base.Created = item.Base.Updated
+		}
+
+		if cas == 0 {
+			_, err = d.insert(id, item, &gocb.InsertOptions{Context: ctx})
+		} else {
+			_, err = d.replace(id, item, &gocb.ReplaceOptions{Context: ctx, Cas: cas})
+		}
+		if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentExists) {
+			continue
+		}
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Writing a document failed")
+			return nil, err
+		}
+		return item, nil
+	}
+	err = fmt.Errorf("updating pantry item %s: %w", id, gocb.ErrCasMismatch)
+	log.Ctx(ctx).Err(err).Msg("Giving up after concurrent changes")
+	return nil, err
+}
+
+// StockItem adds a bought item to the pantry.
+func (d *db) StockItem(ctx context.Context, item *models.Item) (id string, err error) {
+	ctx, end := d.trace(ctx, "StockItem")
+	defer end(&err)
+	id = PantryKey(item.Title, item.Unit)
+	_, err = d.updatePantryItem(ctx, id, true, func(pantryItem *models.PantryItem) error {
+		if pantryItem.Title == "" {
+			pantryItem.Title = strings.TrimSpace(item.Title)
+			pantryItem.Unit = item.Unit
+		}
+		if item.Category != "" {
+			pantryItem.Category = item.Category
+		}
+		// The oldest stock goes off first, so the earliest expiry date wins
+		// unless the pantry ran empty before.
+		if pantryItem.Amount <= 0 || pantryItem.Expires == 0 ||
+			(item.Expires != 0 && item.Expires < pantryItem.Expires) {
+			pantryItem.Expires = item.Expires
+		}
+		pantryItem.Amount += item.Amount
+		if item.Shop != "" {
+			pantryItem.Shop = item.Shop
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Ctx(ctx).Info().Msgf("Pantry item stocked: %s\n", id)
+	return
+}
+
+// UnstockItem takes a bought item back out of the pantry when its purchase is
+// undone. Items that never reached the pantry are ignored.
+func (d *db) UnstockItem(ctx context.Context, item *models.Item) (err error) {
+	ctx, end := d.trace(ctx, "UnstockItem")
+	defer end(&err)
+	id := PantryKey(item.Title, item.Unit)
+	_, err = d.updatePantryItem(ctx, id, false, func(pantryItem *models.PantryItem) error {
+		takeStock(pantryItem, item.Amount)
+		return nil
+	})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Pantry item unstocked: %s\n", id)
+	return
+}
+
+func (d *db) UpsertPantryItem(ctx context.Context, id string, item *models.PantryItem) (err error) {
+	ctx, end := d.trace(ctx, "UpsertPantryItem")
+	defer end(&err)
+	item.Base.Updated = time.Now().UTC().UnixMilli()
+	if item.Base.Created == 0 {
+		item.Base.Created = time.Now().UTC().UnixMilli()
+	}
+
+	_, err = d.upsert(id, item,
+		&gocb.UpsertOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Upserting a document failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Pantry item upserted: %s\n", id)
+	return
+}
+
+func (d *db) GetPantryItem(ctx context.Context, id string) (item *models.PantryItem, err error) {
+	ctx, end := d.trace(ctx, "GetPantryItem")
+	defer end(&err)
+	getResult, err := d.get(id,
+		&gocb.GetOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Getting a document failed")
+		return
+	}
+
+	item = &models.PantryItem{}
+	err = getResult.Content(item)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+		return
+	}
+
+	return
+}
+
+func (d *db) GetPantryItems(ctx context.Context, q *PaginationQuery, searchQuery string) (items []*models.PantryItemWithID, total int, err error) {
+	ctx, end := d.trace(ctx, "GetPantryItems")
+	defer end(&err)
+
+	searchQuery = strings.TrimSpace(searchQuery)
+
+	query := "SELECT meta(x).id, x.* FROM pantry x WHERE 1=1"
+	queryTotal := "SELECT COUNT(*) as total FROM pantry x WHERE 1=1"
+
+	if searchQuery != "" {
+		query += "\nAND SEARCH(x, $searchQuery)"
+		queryTotal += "\nAND SEARCH(x, $searchQuery)"
+	}
+
+	clauses, err := d.paginate(q, "meta(x).id ASC")
+	if err != nil {
+		return
+	}
+	query += clauses
+
+	params := map[string]interface{}{
+		"searchQuery": searchQuery,
+	}
+	items, err = d.queryPantryItems(ctx, query, params)
+	if err != nil {
+		return
+	}
+
+	queryResultTotal, err := d.query(queryTotal, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	var totalResult models.Total
+	err = queryResultTotal.One(&totalResult)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Reading the count failed")
+		return
+	}
+	total = totalResult.Total
+
+	return
+}
+
+// GetLowStockItems returns the pantry items whose amount dropped below their
+// threshold. Items without a threshold are never low on stock.
+func (d *db) GetLowStockItems(ctx context.Context) (items []*models.PantryItemWithID, err error) {
+	ctx, end := d.trace(ctx, "GetLowStockItems")
+	defer end(&err)
+	query := "SELECT meta(x).id, x.* FROM pantry x WHERE x.threshold > 0 AND x.amount < x.threshold" +
+		"\nORDER BY meta(x).id ASC"
+	return d.queryPantryItems(ctx, query, nil)
+}
+
+// GetExpiringPantryItems returns the pantry items in stock that expire before
+// the given time in Unix milliseconds.
+func (d *db) GetExpiringPantryItems(ctx context.Context, before int64) (items []*models.PantryItemWithID, err error) {
+	ctx, end := d.trace(ctx, "GetExpiringPantryItems")
+	defer end(&err)
+	query := "SELECT meta(x).id, x.* FROM pantry x WHERE x.amount > 0" +
+		"\nAND x.expires > 0 AND x.expires <= $before" +
+		"\nORDER BY x.expires ASC, meta(x).id ASC"
+	params := map[string]interface{}{
+		"before": before,
+	}
+	return d.queryPantryItems(ctx, query, params)
+}
+
+// MarkPantryItemNotified records that a reminder was sent for the item
+// expiring at expires. If the expiry date changed in between, the item is left
+// alone so that the new date is reminded of.
+func (d *db) MarkPantryItemNotified(ctx context.Context, id string, expires int64) (err error) {
+	ctx, end := d.trace(ctx, "MarkPantryItemNotified")
+	defer end(&err)
+	_, err = d.updatePantryItem(ctx, id, false, func(item *models.PantryItem) error {
+		if item.Expires == expires {
+			item.Notified = expires
+		}
+		return nil
+	})
+	return
+}
+
+func (d *db) queryPantryItems(ctx context.Context, query string, params map[string]interface{}) (items []*models.PantryItemWithID, err error) {
+	log.Ctx(ctx).Info().Msgf("Query: %s", query)
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	items = []*models.PantryItemWithID{}
+	for queryResult.Next() {
+		var item models.PantryItemWithID
+		err = queryResult.Row(&item)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		items = append(items, &item)
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	return
+}
+
+// ConsumePantryItem takes the amount out of stock. The stock never drops
+// below zero, so the entry and its threshold are kept for restocking.
+func (d *db) ConsumePantryItem(ctx context.Context, id string, amount float64) (item *models.PantryItem, err error) {
+	ctx, end := d.trace(ctx, "ConsumePantryItem")
+	defer end(&err)
+	item, err = d.updatePantryItem(ctx, id, false, func(item *models.PantryItem) error {
+		amount = takeStock(item, amount)
+		item.Consumed += amount
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Pantry item consumed: %s\n", id)
+	return
+}
+
+// DiscardPantryItem throws the amount away, or the whole stock if amount is
+// zero.
+func (d *db) DiscardPantryItem(ctx context.Context, id string, amount float64) (item *models.PantryItem, err error) {
+	ctx, end := d.trace(ctx, "DiscardPantryItem")
+	defer end(&err)
+	item, err = d.updatePantryItem(ctx, id, false, func(item *models.PantryItem) error {
+		if amount == 0 {
+			amount = item.Amount
+		}
+		amount = takeStock(item, amount)
+		item.Discarded += amount
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Pantry item discarded: %s\n", id)
+	return
+}
+
+// takeStock decreases the stock by at most the amount available and returns
+// the amount actually taken.
+func takeStock(item *models.PantryItem, amount float64) float64 {
+	if amount > item.Amount {
+		amount = item.Amount
+	}
+	item.Amount -= amount
+	if item.Amount <= amountEpsilon {
+		item.Amount = 0
+	}
+	return amount
+}
+
+func (d *db) DeletePantryItem(ctx context.Context, id string) (err error) {
+	ctx, end := d.trace(ctx, "DeletePantryItem")
+	defer end(&err)
+	_, err = d.remove(id,
+		&gocb.RemoveOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Removing a document failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Pantry item deleted: %s\n", id)
+	return
+}
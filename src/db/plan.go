@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"time"
+)
+
+type PlansDB interface {
+	UpsertPlan(ctx context.Context, plan *models.Plan) (err error)
+	GetPlan(ctx context.Context, week string) (plan *models.Plan, err error)
+	DeletePlan(ctx context.Context, week string) (err error)
+}
+
+func NewPlansDB(ctx context.Context) (PlansDB, error) {
+	if config.Get().Database.Backend == BackendMemory {
+		return NewMemoryPlansDB(), nil
+	}
+	db := &db{
+		collectionName: "plans",
+		fields:         []string{"week"},
+	}
+	err := db.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// UpsertPlan stores the plan under its week key, e.g. "2024-W05".
+func (d *db) UpsertPlan(ctx context.Context, plan *models.Plan) (err error) {
+	ctx, end := d.trace(ctx, "UpsertPlan")
+	defer end(&err)
+	plan.Base.Updated = time.Now().UTC().UnixMilli()
+	if plan.Base.Created == 0 {
+		plan.Base.Created = time.Now().UTC().UnixMilli()
+	}
+
+	_, err = d.upsert(plan.Week, plan,
+		&gocb.UpsertOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Upserting a document failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Plan upserted: %s\n", plan.Week)
+	return
+}
+
+// GetPlan returns the plan for the week. A week that has not been planned yet
+// yields an empty plan rather than an error.
+func (d *db) GetPlan(ctx context.Context, week string) (plan *models.Plan, err error) {
+	ctx, end := d.trace(ctx, "GetPlan")
+	defer end(&err)
+	getResult, err := d.get(week,
+		&gocb.GetOptions{Context: ctx})
+	if err != nil {
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			return &models.Plan{Week: week, Meals: []*models.Meal{}}, nil
+		}
+		log.Ctx(ctx).Err(err).Msg("Getting a document failed")
+		return
+	}
+
+	plan = &models.Plan{}
+	err = getResult.Content(plan)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+		return
+	}
+
+	return
+}
+
+func (d *db) DeletePlan(ctx context.Context, week string) (err error) {
+	ctx, end := d.trace(ctx, "DeletePlan")
+	defer end(&err)
+	_, err = d.remove(week,
+		&gocb.RemoveOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Removing a document failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Plan deleted: %s\n", week)
+	return
+}
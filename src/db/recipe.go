@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"github.com/couchbase/gocb/v2"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"strings"
+	"time"
+)
+
+type RecipesDB interface {
+	UpsertRecipe(ctx context.Context, inId string, recipe *models.Recipe) (id string, err error)
+	GetRecipe(ctx context.Context, id string) (recipe *models.Recipe, err error)
+	GetRecipes(ctx context.Context, q *PaginationQuery, searchQuery string) (recipes []*models.RecipeWithID, total int, err error)
+	DeleteRecipe(ctx context.Context, id string) (err error)
+}
+
+// RecipeFields are the indexed recipe fields, which are also the ones recipes can be sorted by.
+var RecipeFields = []string{"title", "servings"}
+
+func NewRecipesDB(ctx context.Context) (RecipesDB, error) {
+	if config.Get().Database.Backend == BackendMemory {
+		return NewMemoryRecipesDB(), nil
+	}
+	db := &db{
+		collectionName: "recipes",
+		fields:         RecipeFields,
+	}
+	err := db.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (d *db) UpsertRecipe(ctx context.Context, inId string, recipe *models.Recipe) (outId string, err error) {
+	ctx, end := d.trace(ctx, "UpsertRecipe")
+	defer end(&err)
+	outId = inId
+	if outId == "" {
+		outId = xid.New().String()
+	}
+	if recipe == nil {
+		recipe = &models.Recipe{Base: models.Base{}}
+	}
+	recipe.Base.Updated = time.Now().UTC().UnixMilli()
+	if recipe.Base.Created == 0 {
+		recipe.Base.Created = time.Now().UTC().UnixMilli()
+	}
+
+	_, err = d.upsert(outId, recipe,
+		&gocb.UpsertOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Upserting a document failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Recipe upserted: %s\n", outId)
+	return
+}
+
+func (d *db) GetRecipe(ctx context.Context, id string) (recipe *models.Recipe, err error) {
+	ctx, end := d.trace(ctx, "GetRecipe")
+	defer end(&err)
+	getResult, err := d.get(id,
+		&gocb.GetOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Getting a document failed")
+		return
+	}
+
+	recipe = &models.Recipe{}
+	err = getResult.Content(recipe)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+		return
+	}
+
+	return
+}
+
+func (d *db) GetRecipes(ctx context.Context, q *PaginationQuery, searchQuery string) (recipes []*models.RecipeWithID, total int, err error) {
+	ctx, end := d.trace(ctx, "GetRecipes")
+	defer end(&err)
+
+	searchQuery = strings.TrimSpace(searchQuery)
+
+	query := "SELECT meta(x).id, x.* FROM recipes x WHERE 1=1"
+	queryTotal := "SELECT COUNT(*) as total FROM recipes x WHERE 1=1"
+
+	if searchQuery != "" {
+		query += "\nAND SEARCH(x, $searchQuery)"
+		queryTotal += "\nAND SEARCH(x, $searchQuery)"
+	}
+
+	clauses, err := d.paginate(q, "meta(x).id ASC")
+	if err != nil {
+		return
+	}
+	query += clauses
+
+	log.Ctx(ctx).Info().Msgf("Query: %s", query)
+	params := map[string]interface{}{
+		"searchQuery": searchQuery,
+	}
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	recipes = []*models.RecipeWithID{}
+	for queryResult.Next() {
+		var recipe models.RecipeWithID
+		err = queryResult.Row(&recipe)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		recipes = append(recipes, &recipe)
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+
+	queryResultTotal, err := d.query(queryTotal, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	var totalResult models.Total
+	err = queryResultTotal.One(&totalResult)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Reading the count failed")
+		return
+	}
+	total = totalResult.Total
+
+	return
+}
+
+func (d *db) DeleteRecipe(ctx context.Context, id string) (err error) {
+	ctx, end := d.trace(ctx, "DeleteRecipe")
+	defer end(&err)
+	_, err = d.remove(id,
+		&gocb.RemoveOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Removing a document failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Recipe deleted: %s\n", id)
+	return
+}
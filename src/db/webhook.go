@@ -0,0 +1,336 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"time"
+)
+
+type WebhooksDB interface {
+	UpsertWebhook(ctx context.Context, inId string, webhook *models.Webhook) (id string, err error)
+	GetWebhook(ctx context.Context, id string) (webhook *models.Webhook, err error)
+	GetWebhooks(ctx context.Context, list string) (webhooks []*models.WebhookWithID, err error)
+	GetSubscribedWebhooks(ctx context.Context, list string, eventType string) (webhooks []*models.WebhookWithID, err error)
+	DeleteWebhook(ctx context.Context, id string) (err error)
+}
+
+func NewWebhooksDB(ctx context.Context) (WebhooksDB, error) {
+	if config.Get().Database.Backend == BackendMemory {
+		return NewMemoryWebhooksDB(), nil
+	}
+	db := &db{
+		collectionName: "webhooks",
+		fields:         []string{"list"},
+	}
+	err := db.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (d *db) UpsertWebhook(ctx context.Context, inId string, webhook *models.Webhook) (outId string, err error) {
+	ctx, end := d.trace(ctx, "UpsertWebhook")
+	defer end(&err)
+	outId = inId
+	if outId == "" {
+		outId = xid.New().String()
+	}
+	webhook.Base.Updated = time.Now().UTC().UnixMilli()
+	if webhook.Base.Created == 0 {
+		webhook.Base.Created = time.Now().UTC().UnixMilli()
+	}
+
+	_, err = d.upsert(outId, webhook,
+		&gocb.UpsertOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Upserting a document failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Webhook upserted: %s\n", outId)
+	return
+}
+
+func (d *db) GetWebhook(ctx context.Context, id string) (webhook *models.Webhook, err error) {
+	ctx, end := d.trace(ctx, "GetWebhook")
+	defer end(&err)
+	getResult, err := d.get(id,
+		&gocb.GetOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Getting a document failed")
+		return
+	}
+
+	webhook = &models.Webhook{}
+	err = getResult.Content(webhook)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+		return
+	}
+
+	return
+}
+
+func (d *db) GetWebhooks(ctx context.Context, list string) (webhooks []*models.WebhookWithID, err error) {
+	ctx, end := d.trace(ctx, "GetWebhooks")
+	defer end(&err)
+	query := "SELECT meta(x).id, x.* FROM webhooks x WHERE x.list = $list" +
+		"\nORDER BY meta(x).id ASC"
+	params := map[string]interface{}{
+		"list": list,
+	}
+	return d.queryWebhooks(ctx, query, params)
+}
+
+// GetSubscribedWebhooks returns the webhooks of the list that subscribed to
+// the event type.
+func (d *db) GetSubscribedWebhooks(ctx context.Context, list string, eventType string) (webhooks []*models.WebhookWithID, err error) {
+	ctx, end := d.trace(ctx, "GetSubscribedWebhooks")
+	defer end(&err)
+	query := "SELECT meta(x).id, x.* FROM webhooks x WHERE x.list = $list" +
+		"\nAND ANY e IN x.events SATISFIES e = $event END" +
+		"\nORDER BY meta(x).id ASC"
+	params := map[string]interface{}{
+		"list":  list,
+		"event": eventType,
+	}
+	return d.queryWebhooks(ctx, query, params)
+}
+
+func (d *db) queryWebhooks(ctx context.Context, query string, params map[string]interface{}) (webhooks []*models.WebhookWithID, err error) {
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	webhooks = []*models.WebhookWithID{}
+	for queryResult.Next() {
+		var webhook models.WebhookWithID
+		err = queryResult.Row(&webhook)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	return
+}
+
+func (d *db) DeleteWebhook(ctx context.Context, id string) (err error) {
+	ctx, end := d.trace(ctx, "DeleteWebhook")
+	defer end(&err)
+	_, err = d.remove(id,
+		&gocb.RemoveOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Removing a document failed")
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("Webhook deleted: %s\n", id)
+	return
+}
+
+type DeliveriesDB interface {
+	UpsertDelivery(ctx context.Context, inId string, delivery *models.Delivery) (id string, err error)
+	GetDelivery(ctx context.Context, id string) (delivery *models.Delivery, err error)
+	GetDeliveries(ctx context.Context, q *PaginationQuery, filter *DeliveryFilter) (deliveries []*models.DeliveryWithID, total int, err error)
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) (deliveries []*models.DeliveryWithID, err error)
+}
+
+// DeliveryFilter narrows down GetDeliveries. Empty fields match everything.
+type DeliveryFilter struct {
+	List    string
+	Webhook string
+	Status  string
+}
+
+func NewDeliveriesDB(ctx context.Context) (DeliveriesDB, error) {
+	if config.Get().Database.Backend == BackendMemory {
+		return NewMemoryDeliveriesDB(), nil
+	}
+	db := &db{
+		collectionName: "deliveries",
+		fields:         []string{"webhook", "list", "status", "nextAttempt"},
+	}
+	err := db.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (d *db) UpsertDelivery(ctx context.Context, inId string, delivery *models.Delivery) (outId string, err error) {
+	ctx, end := d.trace(ctx, "UpsertDelivery")
+	defer end(&err)
+	outId = inId
+	if outId == "" {
+		outId = xid.New().String()
+	}
+	delivery.Base.Updated = time.Now().UTC().UnixMilli()
+	if delivery.Base.Created == 0 {
+		delivery.Base.Created = time.Now().UTC().UnixMilli()
+	}
+
+	_, err = d.upsert(outId, delivery,
+		&gocb.UpsertOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Upserting a document failed")
+		return
+	}
+	return
+}
+
+func (d *db) GetDelivery(ctx context.Context, id string) (delivery *models.Delivery, err error) {
+	ctx, end := d.trace(ctx, "GetDelivery")
+	defer end(&err)
+	getResult, err := d.get(id,
+		&gocb.GetOptions{Context: ctx})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Getting a document failed")
+		return
+	}
+
+	delivery = &models.Delivery{}
+	err = getResult.Content(delivery)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+		return
+	}
+
+	return
+}
+
+func (d *db) GetDeliveries(ctx context.Context, q *PaginationQuery, filter *DeliveryFilter) (deliveries []*models.DeliveryWithID, total int, err error) {
+	ctx, end := d.trace(ctx, "GetDeliveries")
+	defer end(&err)
+	query := "SELECT meta(x).id, x.* FROM deliveries x WHERE 1=1"
+	queryTotal := "SELECT COUNT(*) as total FROM deliveries x WHERE 1=1"
+
+	params := map[string]interface{}{}
+	if filter.List != "" {
+		query += "\nAND x.list = $list"
+		queryTotal += "\nAND x.list = $list"
+		params["list"] = filter.List
+	}
+	if filter.Webhook != "" {
+		query += "\nAND x.webhook = $webhook"
+		queryTotal += "\nAND x.webhook = $webhook"
+		params["webhook"] = filter.Webhook
+	}
+	if filter.Status != "" {
+		query += "\nAND x.status = $status"
+		queryTotal += "\nAND x.status = $status"
+		params["status"] = filter.Status
+	}
+
+	// Deliveries are listed newest first and cannot be sorted otherwise.
+	clauses, err := d.paginate(&PaginationQuery{Start: q.Start, End: q.End}, "x.created DESC, meta(x).id ASC")
+	if err != nil {
+		return
+	}
+	query += clauses
+
+	deliveries, err = d.queryDeliveries(ctx, query, params)
+	if err != nil {
+		return
+	}
+
+	queryResultTotal, err := d.query(queryTotal, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	var totalResult models.Total
+	err = queryResultTotal.One(&totalResult)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Reading the count failed")
+		return
+	}
+	total = totalResult.Total
+
+	return
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries whose next attempt
+// is due, locking each one for the lease so that other replicas skip it.
+// Deliveries that another replica claimed in the meantime are left out.
+func (d *db) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) (deliveries []*models.DeliveryWithID, err error) {
+	ctx, end := d.trace(ctx, "ClaimDueDeliveries")
+	defer end(&err)
+	query := "SELECT meta(x).id, x.* FROM deliveries x WHERE x.status = $status" +
+		"\nAND x.nextAttempt <= $now AND x.lockedUntil <= $now" +
+		"\nORDER BY x.nextAttempt ASC" +
+		fmt.Sprintf("\nLIMIT %d", limit)
+	params := map[string]interface{}{
+		"status": models.DeliveryPending,
+		"now":    now.UTC().UnixMilli(),
+	}
+	due, err := d.queryDeliveries(ctx, query, params)
+	if err != nil {
+		return
+	}
+
+	deliveries = make([]*models.DeliveryWithID, 0, len(due))
+	for _, candidate := range due {
+		getResult, err := d.get(candidate.ID, &gocb.GetOptions{Context: ctx})
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Getting a document failed")
+			continue
+		}
+		delivery := models.DeliveryWithID{ID: candidate.ID}
+		if err = getResult.Content(&delivery.Delivery); err != nil {
+			log.Ctx(ctx).Err(err).Msg("Decoding a document failed")
+			continue
+		}
+		if delivery.Status != models.DeliveryPending || delivery.LockedUntil > now.UTC().UnixMilli() {
+			continue
+		}
+
+		delivery.LockedUntil = now.Add(lease).UTC().UnixMilli()
+		_, err = d.replace(delivery.ID, &delivery.Delivery, &gocb.ReplaceOptions{
+			Context: ctx,
+			Cas:     getResult.Cas(),
+		})
+		if errors.Is(err, gocb.ErrCasMismatch) {
+			continue
+		}
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Writing a document failed")
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, nil
+}
+
+func (d *db) queryDeliveries(ctx context.Context, query string, params map[string]interface{}) (deliveries []*models.DeliveryWithID, err error) {
+	queryResult, err := d.query(query, &gocb.QueryOptions{Adhoc: true, Context: ctx, NamedParameters: params})
+	if err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	deliveries = []*models.DeliveryWithID{}
+	for queryResult.Next() {
+		var delivery models.DeliveryWithID
+		err = queryResult.Row(&delivery)
+		if err != nil {
+			log.Ctx(ctx).Err(err).Msg("Reading a query row failed")
+			return
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = queryResult.Err(); err != nil {
+		log.Ctx(ctx).Err(err).Msg("Query failed")
+		return
+	}
+	return
+}
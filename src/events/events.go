@@ -0,0 +1,87 @@
+// Package events publishes the changes of the shopping lists. Every event is
+// queued for the webhooks of the list and sent to the watchers in this process,
+// such as the WatchItems streams of the gRPC API.
+package events
+
+import (
+	"context"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/webhook"
+	"sync"
+	"time"
+)
+
+// bufferSize is how many events a watcher may fall behind before it is
+// dropped.
+const bufferSize = 64
+
+type hub struct {
+	mu       sync.Mutex
+	watchers map[string]map[chan *models.Event]struct{}
+}
+
+var watchers = &hub{watchers: map[string]map[chan *models.Event]struct{}{}}
+
+// Publish sends the event to the watchers of the list and queues it for its
+// webhooks. Failing to queue it is logged and does not fail the caller.
+func Publish(ctx context.Context, list string, eventType string, data any) {
+	event := &models.Event{
+		ID:   xid.New().String(),
+		Type: eventType,
+		List: list,
+		Time: time.Now().UTC().UnixMilli(),
+		Data: data,
+	}
+	watchers.send(ctx, event)
+	if err := webhook.Queue(ctx, event); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msgf("Error publishing %s", eventType)
+	}
+}
+
+// Subscribe returns the events of the list that are published in this process
+// from now on. Changes made by other replicas or services are not seen. The
+// channel is closed when cancel is called or when the watcher fell too far
+// behind, in which case it should reload the list and subscribe again.
+func Subscribe(list string) (events <-chan *models.Event, cancel func()) {
+	ch := make(chan *models.Event, bufferSize)
+	watchers.mu.Lock()
+	if watchers.watchers[list] == nil {
+		watchers.watchers[list] = map[chan *models.Event]struct{}{}
+	}
+	watchers.watchers[list][ch] = struct{}{}
+	watchers.mu.Unlock()
+
+	return ch, func() {
+		watchers.mu.Lock()
+		defer watchers.mu.Unlock()
+		watchers.remove(list, ch)
+	}
+}
+
+func (h *hub) send(ctx context.Context, event *models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.watchers[event.List] {
+		select {
+		case ch <- event:
+		default:
+			log.Ctx(ctx).Warn().Msgf("Dropping a watcher of list %s that fell behind", event.List)
+			h.remove(event.List, ch)
+		}
+	}
+}
+
+// remove closes the channel unless it was removed already. The caller holds
+// the lock.
+func (h *hub) remove(list string, ch chan *models.Event) {
+	if _, ok := h.watchers[list][ch]; !ok {
+		return
+	}
+	delete(h.watchers[list], ch)
+	close(ch)
+	if len(h.watchers[list]) == 0 {
+		delete(h.watchers, list)
+	}
+}
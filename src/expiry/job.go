@@ -0,0 +1,87 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/jobs"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"time"
+)
+
+// Find returns the pantry items that expire within the given duration from
+// now, soonest first. Items that already expired are included. Bought items
+// are stocked in the pantry, so they are not reported separately.
+func Find(ctx context.Context, within time.Duration) (items []*models.ExpiringItem, err error) {
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pantryItems, err := pantryDB.GetExpiringPantryItems(ctx, time.Now().Add(within).UTC().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	items = make([]*models.ExpiringItem, 0, len(pantryItems))
+	for _, item := range pantryItems {
+		items = append(items, expiring(item))
+	}
+	return items, nil
+}
+
+func expiring(item *models.PantryItemWithID) *models.ExpiringItem {
+	return &models.ExpiringItem{
+		ID:       item.ID,
+		Source:   models.ExpiringSourcePantry,
+		Title:    item.Title,
+		Amount:   item.Amount,
+		Unit:     item.Unit,
+		Category: item.Category,
+		Expires:  item.Expires,
+	}
+}
+
+// Schedule checks for expiring items every interval and hands them to the
+// notifier until the context is cancelled. It blocks, so run it in its own
+// goroutine. The runs are reported as the expiry job, see jobs.Status.
+func Schedule(ctx context.Context, interval time.Duration, within time.Duration, notifier Notifier) {
+	jobs.Run(ctx, "expiry", interval, func(ctx context.Context) error {
+		return check(ctx, within, notifier)
+	})
+}
+
+// check notifies about the expiring items that were not notified about for
+// their current expiry date yet, and marks them afterwards, so that every run
+// only reports what is new.
+func check(ctx context.Context, within time.Duration, notifier Notifier) error {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		return fmt.Errorf("getting db: %w", err)
+	}
+	pantryItems, err := pantryDB.GetExpiringPantryItems(ctx, time.Now().Add(within).UTC().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("finding expiring items: %w", err)
+	}
+	items := make([]*models.ExpiringItem, 0, len(pantryItems))
+	for _, item := range pantryItems {
+		if item.Notified != item.Expires {
+			items = append(items, expiring(item))
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	if err = notifier.Notify(ctx, items); err != nil {
+		return fmt.Errorf("notifying about expiring items: %w", err)
+	}
+	for _, item := range items {
+		if err = pantryDB.MarkPantryItemNotified(ctx, item.ID, item.Expires); err != nil {
+			return fmt.Errorf("marking %s as notified: %w", item.ID, err)
+		}
+	}
+	log.Ctx(ctx).Info().Msgf("Notified about %d expiring items", len(items))
+	return nil
+}
@@ -0,0 +1,94 @@
+package expiry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"net/http"
+	"time"
+)
+
+// Notifier delivers reminders about items that are about to expire.
+type Notifier interface {
+	Notify(ctx context.Context, items []*models.ExpiringItem) error
+}
+
+type logNotifier struct {
+}
+
+// NewLogNotifier returns a notifier that writes the reminders to the log.
+func NewLogNotifier() Notifier {
+	return &logNotifier{}
+}
+
+func (n *logNotifier) Notify(ctx context.Context, items []*models.ExpiringItem) error {
+	for _, item := range items {
+		log.Ctx(ctx).Info().
+			Str("source", item.Source).
+			Str("id", item.ID).
+			Str("expires", time.UnixMilli(item.Expires).UTC().Format(time.RFC3339)).
+			Msgf("Expiring: %v %s %s", item.Amount, item.Unit, item.Title)
+	}
+	return nil
+}
+
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier that posts the reminders as JSON to
+// the URL. A nil client falls back to one with a 10 second timeout.
+func NewWebhookNotifier(url string, client *http.Client) Notifier {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &webhookNotifier{
+		url:    url,
+		client: client,
+	}
+}
+
+type webhookPayload struct {
+	Items []*models.ExpiringItem `json:"items"`
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, items []*models.ExpiringItem) error {
+	body, err := json.Marshal(webhookPayload{Items: items})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded with %s", n.url, res.Status)
+	}
+	return nil
+}
+
+// NewNotifier returns the notifier of the given kind, "log" or "webhook".
+func NewNotifier(kind string, url string) (Notifier, error) {
+	switch kind {
+	case "", "log":
+		return NewLogNotifier(), nil
+	case "webhook":
+		if url == "" {
+			return nil, fmt.Errorf("webhook notifier needs a URL")
+		}
+		return NewWebhookNotifier(url, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", kind)
+	}
+}
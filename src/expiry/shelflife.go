@@ -0,0 +1,43 @@
+package expiry
+
+import (
+	"strings"
+	"time"
+)
+
+// shelfLives holds the default shelf life in days per item category.
+var shelfLives = map[string]int{
+	"fish":       2,
+	"meat":       3,
+	"bakery":     4,
+	"dairy":      7,
+	"produce":    7,
+	"fruit":      7,
+	"vegetables": 7,
+	"eggs":       21,
+	"frozen":     90,
+	"beverages":  180,
+	"canned":     365,
+	"dry":        365,
+}
+
+// ShelfLife returns the shelf life of an item. An override greater than zero
+// takes precedence over the category default. Items of unknown categories
+// have no shelf life.
+func ShelfLife(category string, override int) time.Duration {
+	days := override
+	if days <= 0 {
+		days = shelfLives[strings.ToLower(strings.TrimSpace(category))]
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Expires returns the expiry date in Unix milliseconds of an item bought at
+// the given time, or zero if the item does not expire.
+func Expires(bought time.Time, category string, override int) int64 {
+	shelfLife := ShelfLife(category, override)
+	if shelfLife == 0 {
+		return 0
+	}
+	return bought.Add(shelfLife).UTC().UnixMilli()
+}
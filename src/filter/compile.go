@@ -0,0 +1,177 @@
+package filter
+
+import (
+	"fmt"
+	"github.com/shoppinglist/models"
+	"strings"
+)
+
+// N1QL compiles the expression into conditions on the document alias x, each
+// on its own line starting with AND, so that it can be appended to a WHERE
+// clause. The values are added to params as $f0, $f1 and so on; only field
+// paths from the schema end up in the statement.
+func N1QL(expr Expr, params map[string]interface{}) string {
+	var b strings.Builder
+	compileN1QL(expr, params, &b)
+	return b.String()
+}
+
+func compileN1QL(expr Expr, params map[string]interface{}, b *strings.Builder) {
+	switch e := expr.(type) {
+	case *And:
+		for _, sub := range e.Exprs {
+			compileN1QL(sub, params, b)
+		}
+	case *Cond:
+		name := fmt.Sprintf("f%d", len(params))
+		path := e.Field.Path
+		var cond string
+		switch e.Op {
+		case OpEq:
+			cond = fmt.Sprintf("%s = $%s", path, name)
+		case OpNe:
+			cond = fmt.Sprintf("%s != $%s", path, name)
+		case OpGt:
+			cond = fmt.Sprintf("%s > $%s", path, name)
+		case OpGte:
+			cond = fmt.Sprintf("%s >= $%s", path, name)
+		case OpLt:
+			cond = fmt.Sprintf("%s < $%s", path, name)
+		case OpLte:
+			cond = fmt.Sprintf("%s <= $%s", path, name)
+		case OpIn:
+			cond = fmt.Sprintf("%s IN $%s", path, name)
+		case OpNin:
+			cond = fmt.Sprintf("NOT (%s IN $%s)", path, name)
+		case OpLike:
+			cond = fmt.Sprintf("CONTAINS(LOWER(%s), $%s)", path, name)
+		}
+		switch e.Op {
+		case OpIn, OpNin:
+			params[name] = e.Values
+		case OpLike:
+			params[name] = strings.ToLower(e.Values[0].(string))
+		default:
+			params[name] = e.Values[0]
+		}
+		b.WriteString("\nAND ")
+		b.WriteString(cond)
+	}
+}
+
+// Predicate compiles the expression into a function that tells whether an
+// item matches. It gives the same results as the N1QL compilation.
+func Predicate(expr Expr) func(item *models.Item) bool {
+	switch e := expr.(type) {
+	case *And:
+		preds := make([]func(item *models.Item) bool, 0, len(e.Exprs))
+		for _, sub := range e.Exprs {
+			preds = append(preds, Predicate(sub))
+		}
+		return func(item *models.Item) bool {
+			for _, pred := range preds {
+				if !pred(item) {
+					return false
+				}
+			}
+			return true
+		}
+	case *Cond:
+		return func(item *models.Item) bool {
+			return e.match(e.Field.Value(item))
+		}
+	default:
+		return func(item *models.Item) bool { return true }
+	}
+}
+
+func (e *Cond) match(v any) bool {
+	switch e.Op {
+	case OpEq:
+		return Compare(v, e.Values[0]) == 0
+	case OpNe:
+		return Compare(v, e.Values[0]) != 0
+	case OpGt:
+		return Compare(v, e.Values[0]) > 0
+	case OpGte:
+		return Compare(v, e.Values[0]) >= 0
+	case OpLt:
+		return Compare(v, e.Values[0]) < 0
+	case OpLte:
+		return Compare(v, e.Values[0]) <= 0
+	case OpIn, OpNin:
+		in := false
+		for _, value := range e.Values {
+			if Compare(v, value) == 0 {
+				in = true
+				break
+			}
+		}
+		return in == (e.Op == OpIn)
+	case OpLike:
+		s, _ := v.(string)
+		return strings.Contains(strings.ToLower(s), strings.ToLower(e.Values[0].(string)))
+	}
+	return false
+}
+
+// Compare orders two field values the way N1QL does: booleans before
+// numbers before strings, false before true, numbers by value whatever their
+// Go type, and strings bytewise.
+func Compare(a any, b any) int {
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch x := a.(type) {
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		default:
+			return 1
+		}
+	case string:
+		return strings.Compare(x, b.(string))
+	default:
+		fx, fy := number(a), number(b)
+		switch {
+		case fx < fy:
+			return -1
+		case fx > fy:
+			return 1
+		default:
+			return 0
+		}
+	}
+}
+
+func rank(v any) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return 3
+	default:
+		return 2
+	}
+}
+
+func number(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	}
+	return 0
+}
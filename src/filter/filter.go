@@ -0,0 +1,217 @@
+package filter
+
+import (
+	"fmt"
+	"github.com/shoppinglist/apierror"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Op is a comparison operator of a condition.
+type Op string
+
+const (
+	OpEq   Op = "eq"
+	OpNe   Op = "ne"
+	OpGt   Op = "gt"
+	OpGte  Op = "gte"
+	OpLt   Op = "lt"
+	OpLte  Op = "lte"
+	OpIn   Op = "in"
+	OpNin  Op = "nin"
+	OpLike Op = "like"
+	// OpAfter and OpBefore read better on timestamps. They are parsed into
+	// OpGt and OpLt.
+	OpAfter  Op = "after"
+	OpBefore Op = "before"
+)
+
+// Expr is a node of a parsed filter.
+type Expr interface {
+	expr()
+}
+
+// And matches if all of its expressions match. An empty And matches
+// everything.
+type And struct {
+	Exprs []Expr
+}
+
+// Cond compares a field with values. Only OpIn and OpNin have more than one
+// value. Values have the type of the field kind: string, float64, bool, or
+// int64 Unix milliseconds for time fields.
+type Cond struct {
+	Field  *Field
+	Op     Op
+	Values []any
+}
+
+func (*And) expr()  {}
+func (*Cond) expr() {}
+
+// String writes the expression as query parameters such as
+// amount_gte=2&shop_in=Rewe,Edeka, which are the same for equal filters
+// parsed by Parse. A nil expression is empty.
+func String(expr Expr) string {
+	switch e := expr.(type) {
+	case *And:
+		if e == nil {
+			return ""
+		}
+		parts := make([]string, 0, len(e.Exprs))
+		for _, child := range e.Exprs {
+			parts = append(parts, String(child))
+		}
+		return strings.Join(parts, "&")
+	case *Cond:
+		values := make([]string, 0, len(e.Values))
+		for _, v := range e.Values {
+			values = append(values, url.QueryEscape(fmt.Sprint(v)))
+		}
+		return e.Field.Name + "_" + string(e.Op) + "=" + strings.Join(values, ",")
+	}
+	return ""
+}
+
+// ops are the operators a parameter name can end in.
+var ops = map[Op]bool{
+	OpEq: true, OpNe: true, OpGt: true, OpGte: true, OpLt: true, OpLte: true,
+	OpIn: true, OpNin: true, OpLike: true, OpAfter: true, OpBefore: true,
+}
+
+// maxValues bounds the values of an in or nin condition.
+const maxValues = 50
+
+// Parse reads the filter from query parameters of the form field=value or
+// field_op=value, such as amount_gte=2, shop_in=Rewe,Edeka or
+// updated_after=2024-01-31T00:00:00Z. All conditions must hold. Parameters
+// that do not name a field of the schema and an operator, such as those of
+// pagination and search, an id or a cache buster, are not filters and are
+// ignored. Operators that do not apply to the field and values of the wrong
+// type are reported per parameter.
+func Parse(values url.Values, schema Schema) (expr *And, err error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	expr = &And{}
+	var fields []apierror.FieldError
+	for _, key := range keys {
+		for _, value := range values[key] {
+			cond, fieldErr := parseCond(key, value, schema)
+			if fieldErr != nil {
+				fields = append(fields, *fieldErr)
+				continue
+			}
+			if cond != nil {
+				expr.Exprs = append(expr.Exprs, cond)
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return nil, apierror.Invalid(fields...)
+	}
+	return expr, nil
+}
+
+// parseCond returns nil and no error if the key is not a filter.
+func parseCond(key string, value string, schema Schema) (*Cond, *apierror.FieldError) {
+	invalid := func(rule string, format string, a ...any) *apierror.FieldError {
+		return &apierror.FieldError{Field: key, Rule: rule, Message: fmt.Sprintf(format, a...)}
+	}
+
+	name, op := key, OpEq
+	if i := strings.LastIndex(key, "_"); i > 0 {
+		name, op = key[:i], Op(key[i+1:])
+	}
+	field, ok := schema[name]
+	if !ok || !ops[op] {
+		return nil, nil
+	}
+	switch op {
+	case OpAfter:
+		op = OpGt
+	case OpBefore:
+		op = OpLt
+	}
+	if !field.Kind.allows(op) {
+		return nil, invalid("operator", "%s cannot be filtered with %s", name, op)
+	}
+
+	raw := []string{value}
+	if op == OpIn || op == OpNin {
+		raw = strings.Split(value, ",")
+		if len(raw) > maxValues {
+			return nil, invalid("max", "must have at most %d values", maxValues)
+		}
+	}
+	cond := &Cond{Field: field, Op: op, Values: make([]any, 0, len(raw))}
+	for _, r := range raw {
+		v, err := field.Kind.parse(strings.TrimSpace(r))
+		if err != nil {
+			return nil, invalid("type", "%v", err)
+		}
+		cond.Values = append(cond.Values, v)
+	}
+	return cond, nil
+}
+
+// Kind is the type of a filterable field.
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindNumber
+	KindBool
+	KindTime
+)
+
+func (k Kind) allows(op Op) bool {
+	switch k {
+	case KindString:
+		return op == OpEq || op == OpNe || op == OpIn || op == OpNin || op == OpLike
+	case KindNumber:
+		return op != OpLike
+	case KindBool:
+		return op == OpEq || op == OpNe
+	case KindTime:
+		return op == OpEq || op == OpNe || op == OpGt || op == OpGte || op == OpLt || op == OpLte
+	}
+	return false
+}
+
+func (k Kind) parse(s string) (any, error) {
+	switch k {
+	case KindNumber:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return f, nil
+	case KindBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	case KindTime:
+		if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return ms, nil
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("must be an RFC 3339 time or Unix milliseconds")
+		}
+		return t.UnixMilli(), nil
+	default:
+		if len(s) > 200 {
+			return nil, fmt.Errorf("must have at most 200 characters")
+		}
+		return s, nil
+	}
+}
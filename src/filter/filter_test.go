@@ -0,0 +1,192 @@
+package filter_test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/filter"
+	"github.com/shoppinglist/models"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var nov15 = time.Date(2023, 11, 15, 12, 0, 0, 0, time.UTC).UnixMilli()
+
+// items are the items the filters select from, by name.
+var items = map[string]*models.Item{
+	"milk":   {Title: "Milk", Amount: 2, Unit: "l", Shop: "Edeka", Category: "Dairy"},
+	"eggs":   {Title: "Eggs", Amount: 10, Unit: "pc", Shop: "Edeka", Category: "Dairy"},
+	"bread":  {Title: "Bread", Amount: 1, Unit: "pc", Shop: "Rewe", Bought: true, Expires: nov15},
+	"apples": {Title: "Apples", Amount: 1.5, Unit: "kg", Shop: "Rewe", Category: "Fruit", Bought: true, Expires: nov15 + 5*24*3600*1000},
+	"soap":   {Title: "Soap", Amount: 1, Unit: "pc", Category: "Household"},
+}
+
+var cases = []struct {
+	name  string
+	query string
+	want  []string
+}{
+	{"eq", "shop=Edeka", []string{"eggs", "milk"}},
+	{"ne", "shop_ne=Edeka", []string{"apples", "bread", "soap"}},
+	{"empty string", "shop=", []string{"soap"}},
+	{"in", "shop_in=Rewe,Lidl", []string{"apples", "bread"}},
+	{"nin", "unit_nin=pc,l", []string{"apples"}},
+	{"like ignores case", "title_like=EG", []string{"eggs"}},
+	{"gt", "amount_gt=1.5", []string{"eggs", "milk"}},
+	{"gte", "amount_gte=1.5", []string{"apples", "eggs", "milk"}},
+	{"lte", "amount_lte=1", []string{"bread", "soap"}},
+	{"number eq", "amount=10", []string{"eggs"}},
+	{"bool", "bought=true", []string{"apples", "bread"}},
+	{"bool ne", "bought_ne=true", []string{"eggs", "milk", "soap"}},
+	{"missing category", "category=", []string{"bread"}},
+	{"missing expiry is zero", "expires_before=2023-11-16T00:00:00Z", []string{"bread", "eggs", "milk", "soap"}},
+	{"after", "expires_after=2023-11-16T00:00:00Z", []string{"apples"}},
+	{"unix milliseconds", "expires_gte=1700049600000", []string{"apples", "bread"}},
+	{"all conditions", "shop=Rewe&bought=true&amount_lt=1.2", []string{"bread"}},
+	{"same field twice", "amount_gt=1&amount_lt=5", []string{"apples", "milk"}},
+	{"nothing", "title=Butter", []string{}},
+}
+
+// seed stores the items under IDs of their own and returns the names by ID.
+func seed(t *testing.T, itemsDB db.ItemsDB) map[string]string {
+	ctx := context.Background()
+	prefix := "filter-test-" + xid.New().String() + "-"
+	names := map[string]string{}
+	for name, item := range items {
+		item := *item
+		id, err := itemsDB.UpsertItem(ctx, prefix+name, &item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[id] = name
+	}
+	t.Cleanup(func() {
+		for id := range names {
+			_ = itemsDB.DeleteItem(ctx, id)
+		}
+	})
+	return names
+}
+
+// selected returns the sorted names of the seeded items that the filter
+// selects. Other items in the collection are ignored.
+func selected(t *testing.T, itemsDB db.ItemsDB, names map[string]string, query string) []string {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := filter.Parse(values, filter.Items)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	found, _, err := itemsDB.GetItems(context.Background(), &db.PaginationQuery{Filter: expr}, "")
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	got := []string{}
+	for _, item := range found {
+		if name, ok := names[item.ID]; ok {
+			got = append(got, name)
+		}
+	}
+	sort.Strings(got)
+	return got
+}
+
+// TestBackendsAgree runs every filter through filter.Predicate in the
+// in-memory backend and, if Couchbase is configured, through filter.N1QL.
+// Both must select the same items.
+func TestBackendsAgree(t *testing.T) {
+	backends := map[string]db.ItemsDB{
+		db.BackendMemory: db.NewMemoryItemsDB(sql.NullBool{}),
+	}
+	// The filters run through N1QL as well if a Couchbase cluster is
+	// configured with COUCHBASE_CONNECTION_STRING and the other variables.
+	if os.Getenv("COUCHBASE_CONNECTION_STRING") != "" && os.Getenv("DB_BACKEND") != db.BackendMemory {
+		itemsDB, err := db.NewItemsDB(context.Background(), sql.NullBool{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		backends["couchbase"] = itemsDB
+	} else {
+		t.Log("Couchbase is not configured, only the in-memory backend is checked")
+	}
+
+	for backend, itemsDB := range backends {
+		names := seed(t, itemsDB)
+		// Queries may not see the latest writes right away.
+		deadline := time.Now().Add(10 * time.Second)
+		for len(selected(t, itemsDB, names, "")) < len(items) && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		for _, c := range cases {
+			got := selected(t, itemsDB, names, c.query)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s: %s: %s selects %s, want %s", backend, c.name, c.query,
+					strings.Join(got, ","), strings.Join(c.want, ","))
+			}
+		}
+	}
+}
+
+// TestN1QL checks the statement and parameters compiled for a filter, which
+// TestBackendsAgree only runs against a cluster.
+func TestN1QL(t *testing.T) {
+	values, _ := url.ParseQuery("shop_in=Rewe,Lidl&title_like=EG&expires_lt=5")
+	expr, err := filter.Parse(values, filter.Items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]interface{}{}
+	got := filter.N1QL(expr, params)
+	want := "\nAND IFMISSINGORNULL(x.expires, 0) < $f0" +
+		"\nAND x.shop IN $f1" +
+		"\nAND CONTAINS(LOWER(x.title), $f2)"
+	if got != want {
+		t.Errorf("N1QL is %q, want %q", got, want)
+	}
+	wantParams := map[string]interface{}{"f0": int64(5), "f1": []any{"Rewe", "Lidl"}, "f2": "eg"}
+	if !reflect.DeepEqual(params, wantParams) {
+		t.Errorf("params are %v, want %v", params, wantParams)
+	}
+}
+
+func TestString(t *testing.T) {
+	for query, want := range map[string]string{
+		"":                                "",
+		"shop_in=Rewe, Lidl&amount=2":     "amount_eq=2&shop_in=Rewe,Lidl",
+		"title=a,b":                       "title_eq=a%2Cb",
+		"updated_after=1706659200000":     "updated_gt=1706659200000",
+		"updated_gt=2024-01-31T00:00:00Z": "updated_gt=1706659200000",
+	} {
+		values, _ := url.ParseQuery(query)
+		expr, err := filter.Parse(values, filter.Items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filter.String(expr); got != want {
+			t.Errorf("String of %q is %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestParseIgnoresOtherParameters(t *testing.T) {
+	values, _ := url.ParseQuery("id=3&_=1700000000&_sort=title&q=milk&cursor=x&amount_most=2&shop=Rewe")
+	expr, err := filter.Parse(values, filter.Items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filter.String(expr); got != "shop_eq=Rewe" {
+		t.Errorf("filter is %q, want only shop_eq=Rewe", got)
+	}
+	if _, err = filter.Parse(url.Values{"title_gt": {"a"}}, filter.Items); err == nil {
+		t.Errorf("title_gt parsed, want an error for the operator")
+	}
+}
@@ -0,0 +1,42 @@
+package filter
+
+import (
+	"github.com/shoppinglist/models"
+)
+
+// Field is a filterable field of a document.
+type Field struct {
+	Name string
+	Kind Kind
+	// Path is the N1QL expression of the field on the document alias x.
+	// Fields that may be missing from a document default to their zero value,
+	// as they do when read into Go.
+	Path string
+	// Value reads the field from an item.
+	Value func(item *models.Item) any
+}
+
+// Schema maps the filter names to the fields.
+type Schema map[string]*Field
+
+// Items is the filter schema of shopping list items.
+var Items = Schema{
+	"title": {Name: "title", Kind: KindString, Path: "x.title",
+		Value: func(item *models.Item) any { return item.Title }},
+	"amount": {Name: "amount", Kind: KindNumber, Path: "x.amount",
+		Value: func(item *models.Item) any { return item.Amount }},
+	"unit": {Name: "unit", Kind: KindString, Path: "x.unit",
+		Value: func(item *models.Item) any { return item.Unit }},
+	"bought": {Name: "bought", Kind: KindBool, Path: "x.bought",
+		Value: func(item *models.Item) any { return item.Bought }},
+	"shop": {Name: "shop", Kind: KindString, Path: "x.shop",
+		Value: func(item *models.Item) any { return item.Shop }},
+	"category": {Name: "category", Kind: KindString, Path: "IFMISSINGORNULL(x.category, \"\")",
+		Value: func(item *models.Item) any { return item.Category }},
+	"created": {Name: "created", Kind: KindTime, Path: "x.created",
+		Value: func(item *models.Item) any { return item.Created }},
+	"updated": {Name: "updated", Kind: KindTime, Path: "x.updated",
+		Value: func(item *models.Item) any { return item.Updated }},
+	"expires": {Name: "expires", Kind: KindTime, Path: "IFMISSINGORNULL(x.expires, 0)",
+		Value: func(item *models.Item) any { return item.Expires }},
+}
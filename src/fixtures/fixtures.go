@@ -0,0 +1,212 @@
+// Package fixtures loads named datasets of items into the list, such as the
+// demo list or the items of a load test. The datasets are YAML or JSON files;
+// the built-in ones are embedded, more can be put into config.Fixtures.Dir.
+//
+// Loading is disabled unless config.Fixtures.Enabled is set, so that a
+// production database is not filled with them by accident.
+package fixtures
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/events"
+	"github.com/shoppinglist/itemfile"
+	"github.com/shoppinglist/items"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrDisabled is returned while config.Fixtures.Enabled is not set.
+	ErrDisabled = errors.New("fixtures are disabled")
+	// ErrUnknownDataset is returned for names without a dataset.
+	ErrUnknownDataset = errors.New("unknown dataset")
+	// ErrTooLarge is returned for datasets of more than MaxItems items.
+	ErrTooLarge = errors.New("dataset too large")
+)
+
+// MaxItems bounds the items a dataset loads, repeats included. Loading runs
+// in the request that asks for it, so a bigger load would outlast the
+// timeouts of clients and proxies.
+const MaxItems = 1000
+
+//go:embed datasets
+var builtIn embed.FS
+
+// Dataset is the content of a dataset file.
+type Dataset struct {
+	Description string `json:"description"`
+	// Repeat loads the items this many times, numbering their titles.
+	Repeat int            `json:"repeat"`
+	Items  []*models.Item `json:"items"`
+}
+
+// count is the number of items the dataset loads.
+func (d *Dataset) count() int {
+	if d.Repeat > 1 {
+		return d.Repeat * len(d.Items)
+	}
+	return len(d.Items)
+}
+
+// List returns the available datasets by name.
+func List() (datasets []*models.FixtureDataset, err error) {
+	files, err := datasetFiles()
+	if err != nil {
+		return nil, err
+	}
+	datasets = []*models.FixtureDataset{}
+	for _, name := range names(files) {
+		dataset, err := read(files[name], name)
+		if err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, &models.FixtureDataset{Name: name, Description: dataset.Description, Items: dataset.count()})
+	}
+	return
+}
+
+// Load upserts the items of the dataset like the API does, so they get new
+// IDs and their events are published. With replace the items already on the
+// list are deleted first. The dataset is validated before anything changes.
+func Load(ctx context.Context, name string, replace bool) (report *models.FixtureReport, err error) {
+	if !config.Get().Fixtures.Enabled {
+		return nil, ErrDisabled
+	}
+	files, err := datasetFiles()
+	if err != nil {
+		return nil, err
+	}
+	file, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, there are %s", ErrUnknownDataset, name, strings.Join(names(files), ", "))
+	}
+	dataset, err := read(file, name)
+	if err != nil {
+		return nil, err
+	}
+	if dataset.count() > MaxItems {
+		return nil, fmt.Errorf("%w: %s loads %d items, at most %d are allowed", ErrTooLarge, name, dataset.count(), MaxItems)
+	}
+	for i, item := range dataset.Items {
+		if err = itemfile.Check(item); err != nil {
+			return nil, fmt.Errorf("dataset %s: item %d: %w", name, i+1, err)
+		}
+	}
+
+	report = &models.FixtureReport{Dataset: name}
+	if replace {
+		itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{})
+		if err != nil {
+			return nil, fmt.Errorf("getting db: %w", err)
+		}
+		ids, err := itemsDB.ClearItems(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("clearing the list: %w", err)
+		}
+		report.Deleted = len(ids)
+		events.Publish(ctx, models.DefaultList, models.EventListCleared, models.ClearedList{IDs: ids})
+	}
+
+	repeat := dataset.Repeat
+	if repeat < 1 {
+		repeat = 1
+	}
+	for n := 1; n <= repeat; n++ {
+		for _, item := range dataset.Items {
+			item := *item
+			if dataset.Repeat > 1 {
+				item.Title = fmt.Sprintf("%s %d", item.Title, n)
+			}
+			if _, err = items.Upsert(ctx, "", &item); err != nil {
+				return report, fmt.Errorf("loading %q: %w", item.Title, err)
+			}
+			report.Loaded++
+		}
+	}
+	log.Ctx(ctx).Info().Str("dataset", name).Int("deleted", report.Deleted).Int("loaded", report.Loaded).Msg("Fixtures loaded")
+	return
+}
+
+// file is where a dataset is read from.
+type file struct {
+	fsys fs.FS
+	path string
+}
+
+// datasetFiles returns the dataset files by name: the built-in ones and those
+// of config.Fixtures.Dir, which replace built-in ones of the same name.
+func datasetFiles() (files map[string]file, err error) {
+	files = map[string]file{}
+	sub, err := fs.Sub(builtIn, "datasets")
+	if err != nil {
+		return nil, err
+	}
+	if err = addFiles(files, sub); err != nil {
+		return nil, err
+	}
+	if dir := config.Get().Fixtures.Dir; dir != "" {
+		if err = addFiles(files, os.DirFS(dir)); err != nil {
+			return nil, fmt.Errorf("reading the fixtures directory: %w", err)
+		}
+	}
+	return
+}
+
+func addFiles(files map[string]file, fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		files[strings.TrimSuffix(entry.Name(), ext)] = file{fsys: fsys, path: entry.Name()}
+	}
+	return nil
+}
+
+func names(files map[string]file) (names []string) {
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// read parses a dataset file. YAML is converted to JSON first, so that the
+// JSON names of the item fields apply to both formats.
+func read(f file, name string) (dataset *Dataset, err error) {
+	content, err := fs.ReadFile(f.fsys, f.path)
+	if err != nil {
+		return nil, fmt.Errorf("reading dataset %s: %w", name, err)
+	}
+	if path.Ext(f.path) != ".json" {
+		var doc any
+		if err = yaml.Unmarshal(content, &doc); err != nil {
+			return nil, fmt.Errorf("parsing dataset %s: %w", name, err)
+		}
+		if content, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("parsing dataset %s: %w", name, err)
+		}
+	}
+	dataset = &Dataset{}
+	if err = json.Unmarshal(content, dataset); err != nil {
+		return nil, fmt.Errorf("parsing dataset %s: %w", name, err)
+	}
+	return
+}
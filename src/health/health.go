@@ -0,0 +1,206 @@
+// Package health serves the Kubernetes probes of a service: /livez tells that
+// the process is running, /startupz that it finished starting, and /readyz
+// that it can serve requests, with a report per dependency.
+package health
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Dependency is something the service needs to serve requests. Check returns
+// details for the report, such as the endpoints it reached, and an error if
+// the dependency is unavailable.
+type Dependency struct {
+	Name  string
+	Check func(ctx context.Context) (details map[string]string, err error)
+}
+
+// maxStartupWait caps the wait between startup attempts.
+const maxStartupWait = 30 * time.Second
+
+type Probes interface {
+	// Live, Startup and Ready are the handlers of /livez, /startupz and
+	// /readyz. They respond with a models.HealthReport and 503 while the
+	// probe fails.
+	Live(c *gin.Context)
+	Startup(c *gin.Context)
+	Ready(c *gin.Context)
+	// Start calls startup until it succeeds and then marks the service as
+	// started, after which readiness depends on the dependencies. It waits
+	// between the attempts and gives up when the context is done.
+	Start(ctx context.Context, startup func(ctx context.Context) error)
+	// Drain fails readiness from now on, when the service shuts down.
+	Drain()
+}
+
+type probes struct {
+	dependencies []Dependency
+
+	mu       sync.Mutex
+	started  bool
+	draining bool
+	checks   []*models.HealthCheck
+	// failures counts the failed checks in a row per dependency.
+	failures map[string]int
+	checked  time.Time
+}
+
+func NewProbes(dependencies ...Dependency) Probes {
+	return &probes{
+		dependencies: dependencies,
+		failures:     map[string]int{},
+	}
+}
+
+func (p *probes) Start(ctx context.Context, startup func(ctx context.Context) error) {
+	wait := time.Second
+	for {
+		err := startup(ctx)
+		if err == nil {
+			break
+		}
+		log.Logger().Warn().Err(err).Msgf("Startup failed, retrying in %s", wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > maxStartupWait {
+			wait = maxStartupWait
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = true
+	log.Logger().Info().Msg("Started")
+}
+
+func (p *probes) Drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draining = true
+}
+
+func (p *probes) Live(c *gin.Context) {
+	respond(c, report(models.HealthUp, nil))
+}
+
+func (p *probes) Startup(c *gin.Context) {
+	p.mu.Lock()
+	started := p.started
+	p.mu.Unlock()
+	if !started {
+		respond(c, report(models.HealthStarting, nil))
+		return
+	}
+	respond(c, report(models.HealthUp, nil))
+}
+
+func (p *probes) Ready(c *gin.Context) {
+	respond(c, p.ready(c.Request.Context()))
+}
+
+// ready checks the dependencies unless the last checks are recent enough.
+func (p *probes) ready(ctx context.Context) *models.HealthReport {
+	conf := config.Get().Health
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.draining:
+		return report(models.HealthDraining, p.checks)
+	case !p.started:
+		return report(models.HealthStarting, p.checks)
+	}
+
+	if p.checks == nil || time.Since(p.checked) >= conf.CacheTTL {
+		p.checks = p.check(ctx, conf)
+		p.checked = time.Now()
+	}
+	status := models.HealthUp
+	for _, check := range p.checks {
+		switch check.Status {
+		case models.HealthDown:
+			status = models.HealthDown
+		case models.HealthDegraded:
+			if status == models.HealthUp {
+				status = models.HealthDegraded
+			}
+		}
+	}
+	return report(status, p.checks)
+}
+
+// check runs the checks of the dependencies concurrently. The caller holds
+// the lock.
+func (p *probes) check(ctx context.Context, conf config.Health) []*models.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, conf.Timeout)
+	defer cancel()
+
+	checks := make([]*models.HealthCheck, len(p.dependencies))
+	var wg sync.WaitGroup
+	for i, dependency := range p.dependencies {
+		wg.Add(1)
+		go func(i int, dependency Dependency) {
+			defer wg.Done()
+			start := time.Now()
+			details, err := dependency.Check(ctx)
+			latency := time.Since(start)
+			checks[i] = &models.HealthCheck{
+				Name:      dependency.Name,
+				Status:    models.HealthUp,
+				LatencyMs: float64(latency.Microseconds()) / 1000,
+				Checked:   start.UTC().UnixMilli(),
+				Details:   details,
+			}
+			if err != nil {
+				checks[i].Error = err.Error()
+			} else if latency > conf.DegradedLatency {
+				checks[i].Status = models.HealthDegraded
+			}
+		}(i, dependency)
+	}
+	wg.Wait()
+
+	for _, check := range checks {
+		if check.Error == "" {
+			p.failures[check.Name] = 0
+		} else {
+			p.failures[check.Name]++
+			check.Status = models.HealthDegraded
+			if p.failures[check.Name] >= conf.FailureThreshold {
+				check.Status = models.HealthDown
+			}
+		}
+		check.ConsecutiveFailures = p.failures[check.Name]
+	}
+	return checks
+}
+
+func report(status string, checks []*models.HealthCheck) *models.HealthReport {
+	service := config.Get().Service
+	return &models.HealthReport{
+		Status:  status,
+		Service: service.Name,
+		Version: service.Version,
+		Host:    service.HostName,
+		Checks:  checks,
+	}
+}
+
+// respond sends the report, with 503 unless the service is up or degraded.
+func respond(c *gin.Context, r *models.HealthReport) {
+	status := http.StatusOK
+	if r.Status != models.HealthUp && r.Status != models.HealthDegraded {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, r)
+}
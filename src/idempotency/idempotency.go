@@ -0,0 +1,204 @@
+// Package idempotency makes retried requests safe. A client sends the same
+// Idempotency-Key header with every attempt of a mutating request; the first
+// attempt runs and its response is stored, and the retries get that response
+// replayed instead of running again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/auth"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// Header is the request header holding the key.
+	Header = "Idempotency-Key"
+	// HeaderReplayed is set on replayed responses.
+	HeaderReplayed = "Idempotent-Replayed"
+)
+
+// maxKeyLength bounds the keys clients may choose, such as UUIDs.
+const maxKeyLength = 255
+
+// Middleware runs POST, PUT, PATCH and DELETE requests with an
+// Idempotency-Key once per key and replays the response to repeats. Keys
+// are scoped to the caller. A key sent with another request is rejected
+// with 422, and while the first request runs repeats are rejected with 409.
+// Server errors are not stored, so the next retry runs the request again.
+// It goes after authentication; open returns the store of the records, such
+// as db.NewIdempotencyDB.
+func Middleware(open func(ctx context.Context) (db.IdempotencyDB, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" || !mutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			_ = c.Error(apierror.BadRequest("%s must be at most %d characters", Header, maxKeyLength))
+			c.Abort()
+			return
+		}
+
+		ctx := c.Request.Context()
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			_ = c.Error(apierror.BadRequest("reading the request body: %v", err))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		store, err := open(ctx)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		conf := config.Get().Idempotency
+		id := db.Key("idempotency", scoped(ctx, key))
+		pending := &models.IdempotencyRecord{
+			Fingerprint: fingerprint(c.Request, body),
+			Pending:     true,
+			Created:     time.Now().UTC().UnixMilli(),
+		}
+		existing, err := store.ReserveIdempotencyKey(ctx, id, pending, conf.LockTimeout)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if existing != nil {
+			replay(c, existing, pending.Fingerprint)
+			return
+		}
+
+		recorder := &recorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		stored := false
+		// A panicking handler must not hold the key until the lock times
+		// out.
+		defer func() {
+			if !stored {
+				release(ctx, store, id)
+			}
+		}()
+		c.Next()
+
+		// apierror.Middleware only writes the problem of a failed request
+		// after this returns, so it is written here to be stored.
+		if len(c.Errors) > 0 && !c.Writer.Written() {
+			apierror.Write(c, c.Errors.Last().Err)
+		}
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		record := &models.IdempotencyRecord{
+			Fingerprint: pending.Fingerprint,
+			Status:      status,
+			Header:      c.Writer.Header().Clone(),
+			Body:        recorder.body.Bytes(),
+			Created:     pending.Created,
+		}
+		// The request ran; a failure to store its response only costs the
+		// replay.
+		if err = store.CompleteIdempotencyKey(ctx, id, record, conf.TTL); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Storing the response of an idempotent request")
+			return
+		}
+		stored = true
+	}
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// scoped ties the key to the caller, so that callers cannot see each other's
+// responses. The hash bounds the length of the document key.
+func scoped(ctx context.Context, key string) string {
+	user := auth.Anonymous.UserID
+	if principal := auth.FromContext(ctx); principal != nil {
+		user = principal.UserID
+	}
+	sum := sha256.Sum256([]byte(user + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint hashes what makes a request the same request.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay answers a repeat of a request with the stored response. The headers
+// this request got from the middlewares so far, such as its request ID, are
+// kept.
+func replay(c *gin.Context, record *models.IdempotencyRecord, fingerprint string) {
+	switch {
+	case record.Fingerprint != fingerprint:
+		_ = c.Error(apierror.New(apierror.CodeIdempotencyKeyReused, http.StatusUnprocessableEntity,
+			"the "+Header+" was used for a different request"))
+		c.Abort()
+		return
+	case record.Pending:
+		_ = c.Error(apierror.Conflict("a request with this %s is still in progress, retry later", Header))
+		c.Abort()
+		return
+	}
+	header := c.Writer.Header()
+	for name, values := range record.Header {
+		if header.Get(name) == "" {
+			header[name] = values
+		}
+	}
+	header.Set(HeaderReplayed, strconv.FormatBool(true))
+	c.Status(record.Status)
+	_, _ = c.Writer.Write(record.Body)
+	c.Abort()
+}
+
+func release(ctx context.Context, store db.IdempotencyDB, id string) {
+	// The request may have been cancelled; the key must be freed anyway.
+	releaseCtx, cancel := context.WithTimeout(context.Background(), config.Get().Database.OperationTimeout)
+	defer cancel()
+	if err := store.ReleaseIdempotencyKey(releaseCtx, id); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Releasing the key of an idempotent request")
+	}
+}
+
+// recorder keeps a copy of the response body.
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
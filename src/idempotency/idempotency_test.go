@@ -0,0 +1,195 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	config.MustInit([]string{"-database.backend=memory"})
+	os.Exit(m.Run())
+}
+
+// server counts the calls of its handlers. /slow blocks until release is
+// closed, after signalling entered. The in-memory records are shared by the
+// process, so the keys get a prefix of their own for every server, which
+// keeps reruns with -count from replaying the records of earlier runs.
+type server struct {
+	router  *gin.Engine
+	prefix  string
+	calls   atomic.Int32
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newServer(t *testing.T) *server {
+	s := &server{prefix: t.Name() + ":" + xid.New().String() + ":", entered: make(chan struct{}), release: make(chan struct{})}
+	store := db.NewMemoryIdempotencyDB()
+	s.router = gin.New()
+	s.router.Use(apierror.Middleware())
+	keyed := s.router.Group("", Middleware(func(ctx context.Context) (db.IdempotencyDB, error) {
+		return store, nil
+	}))
+	keyed.POST("/items", func(c *gin.Context) {
+		n := s.calls.Add(1)
+		c.String(http.StatusCreated, "item %d", n)
+	})
+	keyed.POST("/missing", func(c *gin.Context) {
+		s.calls.Add(1)
+		_ = c.Error(apierror.NotFound("item %d not found", s.calls.Load()))
+		c.Abort()
+	})
+	keyed.POST("/unavailable", func(c *gin.Context) {
+		s.calls.Add(1)
+		_ = c.Error(apierror.New(apierror.CodeUnavailable, http.StatusServiceUnavailable, "try again"))
+		c.Abort()
+	})
+	keyed.POST("/slow", func(c *gin.Context) {
+		s.calls.Add(1)
+		close(s.entered)
+		<-s.release
+		c.Status(http.StatusNoContent)
+	})
+	return s
+}
+
+func (s *server) do(path string, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, s.prefix+key)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestReplay(t *testing.T) {
+	s := newServer(t)
+	first := s.do("/items", "k1", `{"title":"Milk"}`)
+	if first.Code != http.StatusCreated || first.Body.String() != "item 1" {
+		t.Fatalf("first call: got %d %q", first.Code, first.Body.String())
+	}
+	if first.Header().Get(HeaderReplayed) != "" {
+		t.Errorf("first call: %s is set", HeaderReplayed)
+	}
+
+	again := s.do("/items", "k1", `{"title":"Milk"}`)
+	if again.Code != http.StatusCreated || again.Body.String() != "item 1" {
+		t.Errorf("replay: got %d %q, want 201 \"item 1\"", again.Code, again.Body.String())
+	}
+	if again.Header().Get(HeaderReplayed) != strconv.FormatBool(true) {
+		t.Errorf("replay: %s is %q", HeaderReplayed, again.Header().Get(HeaderReplayed))
+	}
+
+	other := s.do("/items", "k2", `{"title":"Milk"}`)
+	if other.Body.String() != "item 2" {
+		t.Errorf("another key: got %q, want \"item 2\"", other.Body.String())
+	}
+	unkeyed := s.do("/items", "", `{"title":"Milk"}`)
+	if unkeyed.Body.String() != "item 3" {
+		t.Errorf("no key: got %q, want \"item 3\"", unkeyed.Body.String())
+	}
+	if n := s.calls.Load(); n != 3 {
+		t.Errorf("handler ran %d times, want 3", n)
+	}
+}
+
+func TestReusedKey(t *testing.T) {
+	s := newServer(t)
+	s.do("/items", "k1", `{"title":"Milk"}`)
+	for name, path := range map[string]string{"body": "/items", "path": "/missing"} {
+		body := `{"title":"Milk"}`
+		if name == "body" {
+			body = `{"title":"Bread"}`
+		}
+		w := s.do(path, "k1", body)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("other %s: got %d, want 422", name, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), string(apierror.CodeIdempotencyKeyReused)) {
+			t.Errorf("other %s: body %s lacks the code", name, w.Body.String())
+		}
+	}
+	if n := s.calls.Load(); n != 1 {
+		t.Errorf("handler ran %d times, want 1", n)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	s := newServer(t)
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- s.do("/slow", "k1", "")
+	}()
+	select {
+	case <-s.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first call did not start")
+	}
+
+	w := s.do("/slow", "k1", "")
+	if w.Code != http.StatusConflict {
+		t.Errorf("while running: got %d, want 409", w.Code)
+	}
+	close(s.release)
+	select {
+	case first := <-done:
+		if first.Code != http.StatusNoContent {
+			t.Errorf("first call: got %d, want 204", first.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first call did not finish")
+	}
+
+	w = s.do("/slow", "k1", "")
+	if w.Code != http.StatusNoContent || w.Header().Get(HeaderReplayed) == "" {
+		t.Errorf("after it ran: got %d, replayed %q", w.Code, w.Header().Get(HeaderReplayed))
+	}
+	if n := s.calls.Load(); n != 1 {
+		t.Errorf("handler ran %d times, want 1", n)
+	}
+}
+
+func TestErrorReplay(t *testing.T) {
+	s := newServer(t)
+	first := s.do("/missing", "k1", "")
+	again := s.do("/missing", "k1", "")
+	if first.Code != http.StatusNotFound || again.Code != http.StatusNotFound {
+		t.Fatalf("got %d and %d, want 404 twice", first.Code, again.Code)
+	}
+	if again.Body.String() != first.Body.String() || !strings.Contains(again.Body.String(), "item 1 not found") {
+		t.Errorf("replayed body %s, want %s", again.Body.String(), first.Body.String())
+	}
+	if ct := again.Header().Get("Content-Type"); ct != apierror.ContentType {
+		t.Errorf("replayed Content-Type %q, want %q", ct, apierror.ContentType)
+	}
+	if n := s.calls.Load(); n != 1 {
+		t.Errorf("handler ran %d times, want 1", n)
+	}
+}
+
+func TestServerErrorReleasesKey(t *testing.T) {
+	s := newServer(t)
+	for i := 1; i <= 2; i++ {
+		w := s.do("/unavailable", "k1", "")
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get(HeaderReplayed) != "" {
+			t.Errorf("call %d: got %d, replayed %q", i, w.Code, w.Header().Get(HeaderReplayed))
+		}
+	}
+	if n := s.calls.Load(); n != 2 {
+		t.Errorf("handler ran %d times, want 2", n)
+	}
+}
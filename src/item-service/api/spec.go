@@ -0,0 +1,398 @@
+package api
+
+import (
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/itemfile"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/openapi"
+	"github.com/shoppinglist/validation"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Spec describes the item-service routes. main refuses to start if it does
+// not match the routes registered with gin. The client package is generated
+// from it with go generate.
+func Spec(version string) *openapi.Document {
+	d := openapi.New("item-service", version)
+	d.Info.Description = "Shopping list items, the pantry, expiry reminders and webhooks."
+	d.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+		"bearer": {
+			Type:        "http",
+			Scheme:      "bearer",
+			Description: "One of the AUTH_TOKENS of the service, if any are configured",
+		},
+	}
+	d.Security = []openapi.SecurityRequirement{{"bearer": {}}}
+	d.Rules["event"] = func(s *openapi.Schema, param string) {
+		for _, eventType := range models.EventTypes {
+			s.Enum = append(s.Enum, eventType)
+		}
+	}
+
+	d.Add(http.MethodGet, "/openapi.json", &openapi.Operation{
+		OperationID: "getOpenAPI",
+		Summary:     "This document",
+		Tags:        []string{"service"},
+		Response:    map[string]any{},
+		Public:      true,
+	})
+	d.Add(http.MethodGet, "/livez", &openapi.Operation{
+		OperationID: "getLiveness",
+		Summary:     "Whether the process is running",
+		Tags:        []string{"service"},
+		Response:    models.HealthReport{},
+		Public:      true,
+	})
+	d.Add(http.MethodGet, "/startupz", &openapi.Operation{
+		OperationID: "getStartup",
+		Summary:     "Whether the service finished starting, 503 until then",
+		Tags:        []string{"service"},
+		Response:    models.HealthReport{},
+		Public:      true,
+	})
+	d.Add(http.MethodGet, "/readyz", &openapi.Operation{
+		OperationID: "getReadiness",
+		Summary:     "Whether the service can serve requests, with the state of its dependencies; 503 while it cannot",
+		Tags:        []string{"service"},
+		Response:    models.HealthReport{},
+		Public:      true,
+	})
+	d.Add(http.MethodGet, "/metrics", &openapi.Operation{
+		OperationID: "getMetrics",
+		Summary:     "Prometheus metrics of the requests and database calls",
+		Tags:        []string{"service"},
+		Response:    "",
+		ContentType: "text/plain",
+		Public:      true,
+	})
+
+	for _, list := range []struct {
+		path    string
+		name    string
+		summary string
+	}{
+		{"/tobuy", "ToBuy", "items to buy"},
+		{"/bought", "Bought", "bought items"},
+	} {
+		d.Add(http.MethodGet, list.path, &openapi.Operation{
+			OperationID: "get" + list.name + "Items",
+			Summary: "List the " + list.summary + ", either by _start and _end or by cursor and limit. " +
+				"Filters are given as field=value or field_op=value, such as amount_gte=2, shop_in=Rewe,Edeka " +
+				"or updated_after=2024-01-31T00:00:00Z; other parameters are ignored.",
+			Tags:       []string{"items"},
+			Parameters: append(pagination(db.ItemFields), cursorPagination()...),
+			Response:   []*models.ItemWithID{},
+			Headers:    listHeaders(),
+			Filter:     true,
+		})
+		d.Add(http.MethodGet, list.path+"/:id", &openapi.Operation{
+			OperationID: "get" + list.name + "Item",
+			Summary:     "Get one of the " + list.summary,
+			Tags:        []string{"items"},
+			Response:    models.Item{},
+		})
+	}
+	d.Add(http.MethodDelete, "/tobuy", &openapi.Operation{
+		OperationID: "clearToBuyItems",
+		Summary:     "Delete all items to buy",
+		Tags:        []string{"items"},
+		Response:    models.ClearedList{},
+	})
+	d.Add(http.MethodDelete, "/tobuy/:id", &openapi.Operation{
+		OperationID: "buyItem",
+		Summary:     "Buy an item, which moves it to the bought items and stocks the pantry",
+		Tags:        []string{"items"},
+		Response:    models.ID{},
+	})
+	d.Add(http.MethodDelete, "/bought/:id", &openapi.Operation{
+		OperationID: "restoreItem",
+		Summary:     "Put a bought item back on the list to buy",
+		Tags:        []string{"items"},
+		Response:    models.ID{},
+	})
+
+	d.Add(http.MethodGet, "/pantry", &openapi.Operation{
+		OperationID: "getPantryItems",
+		Summary:     "List the pantry",
+		Tags:        []string{"pantry"},
+		Parameters:  pagination(db.PantryFields),
+		Response:    []*models.PantryItemWithID{},
+		Headers:     map[string]*openapi.Header{"X-Total-Count": totalCount()},
+	})
+	d.Add(http.MethodPost, "/pantry/restock", &openapi.Operation{
+		OperationID: "restockPantry",
+		Summary:     "Put the pantry items that ran low on the list to buy",
+		Tags:        []string{"pantry"},
+		Response:    []models.ID{},
+	})
+	d.Add(http.MethodGet, "/pantry/:id", &openapi.Operation{
+		OperationID: "getPantryItem",
+		Summary:     "Get a pantry item",
+		Tags:        []string{"pantry"},
+		Response:    models.PantryItem{},
+	})
+	d.Add(http.MethodPut, "/pantry/:id", &openapi.Operation{
+		OperationID: "updatePantryItem",
+		Summary:     "Change the stock, expiry date or low-stock threshold of a pantry item",
+		Tags:        []string{"pantry"},
+		Request:     models.PantryItem{},
+		Response:    models.ID{},
+	})
+	d.Add(http.MethodDelete, "/pantry/:id", &openapi.Operation{
+		OperationID: "deletePantryItem",
+		Summary:     "Delete a pantry item",
+		Tags:        []string{"pantry"},
+		Response:    models.ID{},
+	})
+	d.Add(http.MethodPost, "/pantry/:id/consume", &openapi.Operation{
+		OperationID: "consumePantryItem",
+		Summary:     "Take an amount of a pantry item as used",
+		Tags:        []string{"pantry"},
+		Request:     models.StockRequest{},
+		Response:    models.PantryItemWithID{},
+	})
+	d.Add(http.MethodPost, "/pantry/:id/discard", &openapi.Operation{
+		OperationID: "discardPantryItem",
+		Summary:     "Throw away an amount of a pantry item, or all of it",
+		Tags:        []string{"pantry"},
+		Request:     models.StockRequest{},
+		Response:    models.PantryItemWithID{},
+	})
+
+	d.Add(http.MethodGet, "/expiring", &openapi.Operation{
+		OperationID: "getExpiring",
+		Summary:     "Pantry items about to expire",
+		Tags:        []string{"pantry"},
+		Parameters: []*openapi.Parameter{
+			openapi.Query("days", integer(0, 365), "Days ahead to look, the configured default if not given"),
+		},
+		Response: []*models.ExpiringItem{},
+	})
+
+	d.Add(http.MethodPost, "/graphql", &openapi.Operation{
+		OperationID: "graphQL",
+		Summary:     "Run a GraphQL query or mutation on lists, items and shops",
+		Tags:        []string{"items"},
+		Request:     models.GraphQLRequest{},
+		Response:    models.GraphQLResponse{},
+	})
+
+	export := &openapi.Operation{
+		OperationID: "exportList",
+		Summary:     "Download the items to buy and the bought items as CSV, JSON or a Markdown checklist",
+		Tags:        []string{"lists"},
+		Parameters: []*openapi.Parameter{
+			openapi.Query("format", enum(itemfile.ExportFormats...), "File format, csv if not given"),
+		},
+		Response:    "",
+		ContentType: "text/csv",
+	}
+	d.Add(http.MethodGet, "/lists/:list/export", export)
+	for _, format := range itemfile.ExportFormats[1:] {
+		export.Responses["200"].Content[contentType(format)] = &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+	}
+	imports := &openapi.Operation{
+		OperationID: "importList",
+		Summary:     "Add the items of a CSV, JSON or text file, such as lines like \"2 pc Avocado @Edeka\", and report every line",
+		Tags:        []string{"lists"},
+		Parameters: []*openapi.Parameter{
+			openapi.Query("format", enum(itemfile.ImportFormats...), "File format, told by the Content-Type if not given"),
+			openapi.Query("dry_run", &openapi.Schema{Type: "boolean"}, "Report what would be imported without importing it"),
+		},
+		Request:  []*models.Item{},
+		Response: models.ImportReport{},
+	}
+	d.Add(http.MethodPost, "/lists/:list/import", imports)
+	for _, format := range []string{itemfile.FormatCSV, itemfile.FormatMarkdown, itemfile.FormatText} {
+		imports.RequestBody.Content[contentType(format)] = &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+	}
+
+	d.Add(http.MethodGet, "/lists/:list/webhooks", &openapi.Operation{
+		OperationID: "getWebhooks",
+		Summary:     "List the webhooks of a list",
+		Tags:        []string{"webhooks"},
+		Response:    []*models.WebhookWithID{},
+		Headers:     map[string]*openapi.Header{"X-Total-Count": totalCount()},
+	})
+	d.Add(http.MethodPost, "/lists/:list/webhooks", &openapi.Operation{
+		OperationID: "createWebhook",
+		Summary:     "Register a webhook. The response holds the signing secret, which is not shown again.",
+		Tags:        []string{"webhooks"},
+		Request:     models.Webhook{},
+		Response:    models.WebhookWithID{},
+		Status:      http.StatusCreated,
+	})
+	d.Add(http.MethodGet, "/lists/:list/webhooks/:id", &openapi.Operation{
+		OperationID: "getWebhook",
+		Summary:     "Get a webhook",
+		Tags:        []string{"webhooks"},
+		Response:    models.WebhookWithID{},
+	})
+	d.Add(http.MethodDelete, "/lists/:list/webhooks/:id", &openapi.Operation{
+		OperationID: "deleteWebhook",
+		Summary:     "Delete a webhook",
+		Tags:        []string{"webhooks"},
+		Response:    models.ID{},
+	})
+	deliveries := append(pagination(nil)[:2], openapi.Query("status", enum(models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead), ""))
+	d.Add(http.MethodGet, "/lists/:list/webhooks/:id/deliveries", &openapi.Operation{
+		OperationID: "getWebhookDeliveries",
+		Summary:     "List the deliveries of a webhook, newest first",
+		Tags:        []string{"webhooks"},
+		Parameters:  deliveries,
+		Response:    []*models.DeliveryWithID{},
+		Headers:     map[string]*openapi.Header{"X-Total-Count": totalCount()},
+	})
+	d.Add(http.MethodGet, "/lists/:list/deliveries/dead", &openapi.Operation{
+		OperationID: "getDeadDeliveries",
+		Summary:     "List the deliveries that ran out of attempts",
+		Tags:        []string{"webhooks"},
+		Parameters:  pagination(nil)[:2],
+		Response:    []*models.DeliveryWithID{},
+		Headers:     map[string]*openapi.Header{"X-Total-Count": totalCount()},
+	})
+	d.Add(http.MethodPost, "/lists/:list/deliveries/:id/retry", &openapi.Operation{
+		OperationID: "retryDelivery",
+		Summary:     "Queue a dead delivery again",
+		Tags:        []string{"webhooks"},
+		Response:    models.ID{},
+	})
+
+	// The admin endpoints need the admin role, see policy.Roles.
+	d.Add(http.MethodGet, "/admin/users", &openapi.Operation{
+		OperationID: "getUsers",
+		Summary:     "List the users with a token or a role and their roles",
+		Tags:        []string{"admin"},
+		Response:    []*models.AdminUser{},
+	})
+	d.Add(http.MethodGet, "/admin/lists", &openapi.Operation{
+		OperationID: "getListCounts",
+		Summary:     "List the lists with the number of items to buy and bought items",
+		Tags:        []string{"admin"},
+		Response:    []*models.AdminList{},
+	})
+	d.Add(http.MethodDelete, "/admin/items/:id", &openapi.Operation{
+		OperationID: "forceDeleteItem",
+		Summary:     "Delete an item from either list",
+		Tags:        []string{"admin"},
+		Response:    models.ID{},
+	})
+	d.Add(http.MethodPost, "/admin/items/:id/restore", &openapi.Operation{
+		OperationID: "forceRestoreItem",
+		Summary:     "Put a bought item back on the list to buy",
+		Tags:        []string{"admin"},
+		Response:    models.ItemWithID{},
+	})
+	d.Add(http.MethodPost, "/admin/migrations", &openapi.Operation{
+		OperationID: "runMigrations",
+		Summary:     "Create the collections and indexes of the database again",
+		Tags:        []string{"admin"},
+		Response:    []*models.Migration{},
+	})
+	d.Add(http.MethodGet, "/admin/jobs", &openapi.Operation{
+		OperationID: "getJobs",
+		Summary:     "The state of the background jobs of the replica that answers",
+		Tags:        []string{"admin"},
+		Response:    []*models.JobStatus{},
+	})
+	d.Add(http.MethodGet, "/admin/fixtures", &openapi.Operation{
+		OperationID: "getFixtures",
+		Summary:     "List the datasets that can be loaded",
+		Tags:        []string{"admin"},
+		Response:    []*models.FixtureDataset{},
+	})
+	d.Add(http.MethodPost, "/admin/fixtures/:name", &openapi.Operation{
+		OperationID: "loadFixture",
+		Summary:     "Load a dataset into the list",
+		Tags:        []string{"admin"},
+		Parameters: []*openapi.Parameter{
+			openapi.Query("replace", &openapi.Schema{Type: "boolean"}, "Delete the items on the list first"),
+		},
+		Response: models.FixtureReport{},
+	})
+
+	// See idempotency.Middleware.
+	for _, route := range d.Operations() {
+		switch route.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			route.Operation.Parameters = append(route.Operation.Parameters, &openapi.Parameter{
+				Name:        "Idempotency-Key",
+				In:          "header",
+				Description: "Unique key of the request, such as a UUID, to send with every retry; repeats get the first response replayed",
+				Schema:      &openapi.Schema{Type: "string", MaxLength: intPtr(255)},
+			})
+		}
+	}
+	return d
+}
+
+// pagination returns the react-admin list parameters. The first two are the
+// range, the others the sort and the search.
+func pagination(sortable []string) []*openapi.Parameter {
+	sort := &openapi.Schema{Type: "string"}
+	for _, field := range sortable {
+		sort.Enum = append(sort.Enum, field)
+	}
+	return []*openapi.Parameter{
+		openapi.Query("_start", integer(0, -1), "Index of the first entry"),
+		openapi.Query("_end", integer(0, -1), "Index after the last entry, at most _start + "+strconv.Itoa(validation.MaxPageSize)+"; required unless paging by cursor"),
+		openapi.Query("_sort", sort, "Field to sort by"),
+		openapi.Query("_order", enum("ASC", "DESC"), "Sort order"),
+		openapi.Query("q", &openapi.Schema{Type: "string", MaxLength: intPtr(200)}, "Full text search"),
+	}
+}
+
+func cursorPagination() []*openapi.Parameter {
+	return []*openapi.Parameter{
+		openapi.Query("cursor", &openapi.Schema{Type: "string"}, "X-Next-Cursor of the previous page; keeps its sort and search and needs the same filter"),
+		openapi.Query("limit", integer(0, validation.MaxPageSize), "Page size for cursor pagination"),
+		openapi.Query("include_total", &openapi.Schema{Type: "boolean"}, "Count the entries into X-Total-Count when paging by cursor"),
+	}
+}
+
+func listHeaders() map[string]*openapi.Header {
+	return map[string]*openapi.Header{
+		"X-Total-Count": totalCount(),
+		"X-Next-Cursor": {
+			Description: "Cursor of the next page, absent on the last page",
+			Schema:      &openapi.Schema{Type: "string"},
+		},
+	}
+}
+
+func totalCount() *openapi.Header {
+	return &openapi.Header{
+		Description: "Number of entries across all pages",
+		Schema:      &openapi.Schema{Type: "integer"},
+	}
+}
+
+// integer returns an integer schema with the bounds, where a negative
+// maximum means none.
+func integer(minimum float64, maximum float64) *openapi.Schema {
+	s := &openapi.Schema{Type: "integer", Minimum: &minimum}
+	if maximum >= 0 {
+		s.Maximum = &maximum
+	}
+	return s
+}
+
+// contentType is the media type of the file format without parameters.
+func contentType(format string) string {
+	mediaType, _, _ := strings.Cut(itemfile.ContentType(format), ";")
+	return mediaType
+}
+
+func enum(values ...string) *openapi.Schema {
+	s := &openapi.Schema{Type: "string"}
+	for _, value := range values {
+		s.Enum = append(s.Enum, value)
+	}
+	return s
+}
+
+func intPtr(n int) *int {
+	return &n
+}
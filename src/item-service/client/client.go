@@ -0,0 +1,147 @@
+// Package client is a typed client of the item-service API. The operations in
+// client_gen.go are generated from api.Spec; run go generate after changing
+// the routes.
+package client
+
+//go:generate go run ./gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/shoppinglist/apierror"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+// New returns a client of the service at baseURL, such as
+// http://item-service:8080. A nil httpClient means http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// WithToken returns a copy of the client that authenticates with the bearer
+// token.
+func (c *Client) WithToken(token string) *Client {
+	copied := *c
+	copied.token = token
+	return &copied
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context that sends the key as the
+// Idempotency-Key header of mutating requests. Pass the same key to every
+// retry of a request, so that the service runs it only once.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int
+	Problem    apierror.Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Problem.Code, e.Problem.Detail)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Page holds the paging headers of a list response.
+type Page struct {
+	// Total is the number of entries across all pages, or -1 if the response
+	// did not count them.
+	Total int
+	// NextCursor is the cursor of the next page, empty on the last page.
+	NextCursor string
+}
+
+func page(res *http.Response) *Page {
+	p := &Page{
+		Total:      -1,
+		NextCursor: res.Header.Get("X-Next-Cursor"),
+	}
+	if total, err := strconv.Atoi(res.Header.Get("X-Total-Count")); err == nil {
+		p.Total = total
+	}
+	return p
+}
+
+// do sends the request and decodes the response into out, which is either a
+// pointer to the JSON type or a *string for text responses.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, out any) (res *http.Response, err error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok && method != http.MethodGet {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	res, err = c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		apiErr := &Error{StatusCode: res.StatusCode}
+		_ = json.Unmarshal(b, &apiErr.Problem)
+		return nil, apiErr
+	}
+	if s, ok := out.(*string); ok {
+		*s = string(b)
+		return res, nil
+	}
+	if err = json.Unmarshal(b, out); err != nil {
+		return nil, fmt.Errorf("decoding %s %s: %w", method, path, err)
+	}
+	return res, nil
+}
+
+// escape escapes a path parameter.
+func escape(s string) string {
+	return url.PathEscape(s)
+}
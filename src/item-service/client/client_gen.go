@@ -0,0 +1,716 @@
+// Code generated by go generate; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"github.com/shoppinglist/models"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetFixtures sends GET /admin/fixtures. List the datasets that can be loaded.
+func (c *Client) GetFixtures(ctx context.Context) ([]*models.FixtureDataset, error) {
+	var out []*models.FixtureDataset
+	_, err := c.do(ctx, http.MethodGet, "/admin/fixtures", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoadFixtureParams are the query parameters of LoadFixture. Unset fields are
+// not sent.
+type LoadFixtureParams struct {
+	// Delete the items on the list first.
+	Replace bool
+}
+
+func (p *LoadFixtureParams) values() url.Values {
+	v := url.Values{}
+	if p.Replace {
+		v.Set("replace", "true")
+	}
+	return v
+}
+
+// LoadFixture sends POST /admin/fixtures/{name}. Load a dataset into the list.
+func (c *Client) LoadFixture(ctx context.Context, name string, params *LoadFixtureParams) (*models.FixtureReport, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out models.FixtureReport
+	_, err := c.do(ctx, http.MethodPost, "/admin/fixtures/"+escape(name), query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ForceDeleteItem sends DELETE /admin/items/{id}. Delete an item from either
+// list.
+func (c *Client) ForceDeleteItem(ctx context.Context, id string) (*models.ID, error) {
+	var out models.ID
+	_, err := c.do(ctx, http.MethodDelete, "/admin/items/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ForceRestoreItem sends POST /admin/items/{id}/restore. Put a bought item back
+// on the list to buy.
+func (c *Client) ForceRestoreItem(ctx context.Context, id string) (*models.ItemWithID, error) {
+	var out models.ItemWithID
+	_, err := c.do(ctx, http.MethodPost, "/admin/items/"+escape(id)+"/restore", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetJobs sends GET /admin/jobs. The state of the background jobs of the
+// replica that answers.
+func (c *Client) GetJobs(ctx context.Context) ([]*models.JobStatus, error) {
+	var out []*models.JobStatus
+	_, err := c.do(ctx, http.MethodGet, "/admin/jobs", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetListCounts sends GET /admin/lists. List the lists with the number of items
+// to buy and bought items.
+func (c *Client) GetListCounts(ctx context.Context) ([]*models.AdminList, error) {
+	var out []*models.AdminList
+	_, err := c.do(ctx, http.MethodGet, "/admin/lists", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RunMigrations sends POST /admin/migrations. Create the collections and
+// indexes of the database again.
+func (c *Client) RunMigrations(ctx context.Context) ([]*models.Migration, error) {
+	var out []*models.Migration
+	_, err := c.do(ctx, http.MethodPost, "/admin/migrations", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetUsers sends GET /admin/users. List the users with a token or a role and
+// their roles.
+func (c *Client) GetUsers(ctx context.Context) ([]*models.AdminUser, error) {
+	var out []*models.AdminUser
+	_, err := c.do(ctx, http.MethodGet, "/admin/users", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetBoughtItemsParams are the query parameters of GetBoughtItems. Unset fields
+// are not sent.
+type GetBoughtItemsParams struct {
+	// Index of the first entry.
+	Start *int
+	// Index after the last entry, at most _start + 100; required unless paging by
+	// cursor.
+	End *int
+	// Field to sort by.
+	Sort string
+	// Sort order.
+	Order string
+	// Full text search.
+	Q string
+	// X-Next-Cursor of the previous page; keeps its sort and search and needs the
+	// same filter.
+	Cursor string
+	// Page size for cursor pagination.
+	Limit *int
+	// Count the entries into X-Total-Count when paging by cursor.
+	IncludeTotal bool
+	// Filter holds filter parameters such as amount_gte.
+	Filter url.Values
+}
+
+func (p *GetBoughtItemsParams) values() url.Values {
+	v := url.Values{}
+	for key, values := range p.Filter {
+		v[key] = values
+	}
+	if p.Start != nil {
+		v.Set("_start", strconv.Itoa(*p.Start))
+	}
+	if p.End != nil {
+		v.Set("_end", strconv.Itoa(*p.End))
+	}
+	if p.Sort != "" {
+		v.Set("_sort", p.Sort)
+	}
+	if p.Order != "" {
+		v.Set("_order", p.Order)
+	}
+	if p.Q != "" {
+		v.Set("q", p.Q)
+	}
+	if p.Cursor != "" {
+		v.Set("cursor", p.Cursor)
+	}
+	if p.Limit != nil {
+		v.Set("limit", strconv.Itoa(*p.Limit))
+	}
+	if p.IncludeTotal {
+		v.Set("include_total", "true")
+	}
+	return v
+}
+
+// GetBoughtItems sends GET /bought. List the bought items, either by _start and
+// _end or by cursor and limit. Filters are given as field=value or
+// field_op=value, such as amount_gte=2, shop_in=Rewe,Edeka or
+// updated_after=2024-01-31T00:00:00Z; other parameters are ignored.
+func (c *Client) GetBoughtItems(ctx context.Context, params *GetBoughtItemsParams) ([]*models.ItemWithID, *Page, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out []*models.ItemWithID
+	res, err := c.do(ctx, http.MethodGet, "/bought", query, nil, &out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, page(res), nil
+}
+
+// RestoreItem sends DELETE /bought/{id}. Put a bought item back on the list to
+// buy.
+func (c *Client) RestoreItem(ctx context.Context, id string) (*models.ID, error) {
+	var out models.ID
+	_, err := c.do(ctx, http.MethodDelete, "/bought/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBoughtItem sends GET /bought/{id}. Get one of the bought items.
+func (c *Client) GetBoughtItem(ctx context.Context, id string) (*models.Item, error) {
+	var out models.Item
+	_, err := c.do(ctx, http.MethodGet, "/bought/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetExpiringParams are the query parameters of GetExpiring. Unset fields are
+// not sent.
+type GetExpiringParams struct {
+	// Days ahead to look, the configured default if not given.
+	Days *int
+}
+
+func (p *GetExpiringParams) values() url.Values {
+	v := url.Values{}
+	if p.Days != nil {
+		v.Set("days", strconv.Itoa(*p.Days))
+	}
+	return v
+}
+
+// GetExpiring sends GET /expiring. Pantry items about to expire.
+func (c *Client) GetExpiring(ctx context.Context, params *GetExpiringParams) ([]*models.ExpiringItem, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out []*models.ExpiringItem
+	_, err := c.do(ctx, http.MethodGet, "/expiring", query, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GraphQL sends POST /graphql. Run a GraphQL query or mutation on lists, items
+// and shops.
+func (c *Client) GraphQL(ctx context.Context, body *models.GraphQLRequest) (*models.GraphQLResponse, error) {
+	var out models.GraphQLResponse
+	_, err := c.do(ctx, http.MethodPost, "/graphql", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDeadDeliveriesParams are the query parameters of GetDeadDeliveries. Unset
+// fields are not sent.
+type GetDeadDeliveriesParams struct {
+	// Index of the first entry.
+	Start *int
+	// Index after the last entry, at most _start + 100; required unless paging by
+	// cursor.
+	End *int
+}
+
+func (p *GetDeadDeliveriesParams) values() url.Values {
+	v := url.Values{}
+	if p.Start != nil {
+		v.Set("_start", strconv.Itoa(*p.Start))
+	}
+	if p.End != nil {
+		v.Set("_end", strconv.Itoa(*p.End))
+	}
+	return v
+}
+
+// GetDeadDeliveries sends GET /lists/{list}/deliveries/dead. List the
+// deliveries that ran out of attempts.
+func (c *Client) GetDeadDeliveries(ctx context.Context, list string, params *GetDeadDeliveriesParams) ([]*models.DeliveryWithID, *Page, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out []*models.DeliveryWithID
+	res, err := c.do(ctx, http.MethodGet, "/lists/"+escape(list)+"/deliveries/dead", query, nil, &out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, page(res), nil
+}
+
+// RetryDelivery sends POST /lists/{list}/deliveries/{id}/retry. Queue a dead
+// delivery again.
+func (c *Client) RetryDelivery(ctx context.Context, list string, id string) (*models.ID, error) {
+	var out models.ID
+	_, err := c.do(ctx, http.MethodPost, "/lists/"+escape(list)+"/deliveries/"+escape(id)+"/retry", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExportListParams are the query parameters of ExportList. Unset fields are not
+// sent.
+type ExportListParams struct {
+	// File format, csv if not given.
+	Format string
+}
+
+func (p *ExportListParams) values() url.Values {
+	v := url.Values{}
+	if p.Format != "" {
+		v.Set("format", p.Format)
+	}
+	return v
+}
+
+// ExportList sends GET /lists/{list}/export. Download the items to buy and the
+// bought items as CSV, JSON or a Markdown checklist.
+func (c *Client) ExportList(ctx context.Context, list string, params *ExportListParams) (string, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out string
+	_, err := c.do(ctx, http.MethodGet, "/lists/"+escape(list)+"/export", query, nil, &out)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// ImportListParams are the query parameters of ImportList. Unset fields are not
+// sent.
+type ImportListParams struct {
+	// File format, told by the Content-Type if not given.
+	Format string
+	// Report what would be imported without importing it.
+	DryRun bool
+}
+
+func (p *ImportListParams) values() url.Values {
+	v := url.Values{}
+	if p.Format != "" {
+		v.Set("format", p.Format)
+	}
+	if p.DryRun {
+		v.Set("dry_run", "true")
+	}
+	return v
+}
+
+// ImportList sends POST /lists/{list}/import. Add the items of a CSV, JSON or
+// text file, such as lines like "2 pc Avocado @Edeka", and report every line.
+func (c *Client) ImportList(ctx context.Context, list string, body []*models.Item, params *ImportListParams) (*models.ImportReport, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out models.ImportReport
+	_, err := c.do(ctx, http.MethodPost, "/lists/"+escape(list)+"/import", query, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetWebhooks sends GET /lists/{list}/webhooks. List the webhooks of a list.
+func (c *Client) GetWebhooks(ctx context.Context, list string) ([]*models.WebhookWithID, *Page, error) {
+	var out []*models.WebhookWithID
+	res, err := c.do(ctx, http.MethodGet, "/lists/"+escape(list)+"/webhooks", nil, nil, &out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, page(res), nil
+}
+
+// CreateWebhook sends POST /lists/{list}/webhooks. Register a webhook. The
+// response holds the signing secret, which is not shown again.
+func (c *Client) CreateWebhook(ctx context.Context, list string, body *models.Webhook) (*models.WebhookWithID, error) {
+	var out models.WebhookWithID
+	_, err := c.do(ctx, http.MethodPost, "/lists/"+escape(list)+"/webhooks", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteWebhook sends DELETE /lists/{list}/webhooks/{id}. Delete a webhook.
+func (c *Client) DeleteWebhook(ctx context.Context, list string, id string) (*models.ID, error) {
+	var out models.ID
+	_, err := c.do(ctx, http.MethodDelete, "/lists/"+escape(list)+"/webhooks/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetWebhook sends GET /lists/{list}/webhooks/{id}. Get a webhook.
+func (c *Client) GetWebhook(ctx context.Context, list string, id string) (*models.WebhookWithID, error) {
+	var out models.WebhookWithID
+	_, err := c.do(ctx, http.MethodGet, "/lists/"+escape(list)+"/webhooks/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetWebhookDeliveriesParams are the query parameters of GetWebhookDeliveries.
+// Unset fields are not sent.
+type GetWebhookDeliveriesParams struct {
+	// Index of the first entry.
+	Start *int
+	// Index after the last entry, at most _start + 100; required unless paging by
+	// cursor.
+	End    *int
+	Status string
+}
+
+func (p *GetWebhookDeliveriesParams) values() url.Values {
+	v := url.Values{}
+	if p.Start != nil {
+		v.Set("_start", strconv.Itoa(*p.Start))
+	}
+	if p.End != nil {
+		v.Set("_end", strconv.Itoa(*p.End))
+	}
+	if p.Status != "" {
+		v.Set("status", p.Status)
+	}
+	return v
+}
+
+// GetWebhookDeliveries sends GET /lists/{list}/webhooks/{id}/deliveries. List
+// the deliveries of a webhook, newest first.
+func (c *Client) GetWebhookDeliveries(ctx context.Context, list string, id string, params *GetWebhookDeliveriesParams) ([]*models.DeliveryWithID, *Page, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out []*models.DeliveryWithID
+	res, err := c.do(ctx, http.MethodGet, "/lists/"+escape(list)+"/webhooks/"+escape(id)+"/deliveries", query, nil, &out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, page(res), nil
+}
+
+// GetLiveness sends GET /livez. Whether the process is running.
+func (c *Client) GetLiveness(ctx context.Context) (*models.HealthReport, error) {
+	var out models.HealthReport
+	_, err := c.do(ctx, http.MethodGet, "/livez", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMetrics sends GET /metrics. Prometheus metrics of the requests and
+// database calls.
+func (c *Client) GetMetrics(ctx context.Context) (string, error) {
+	var out string
+	_, err := c.do(ctx, http.MethodGet, "/metrics", nil, nil, &out)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// GetOpenAPI sends GET /openapi.json. This document.
+func (c *Client) GetOpenAPI(ctx context.Context) (map[string]any, error) {
+	var out map[string]any
+	_, err := c.do(ctx, http.MethodGet, "/openapi.json", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetPantryItemsParams are the query parameters of GetPantryItems. Unset fields
+// are not sent.
+type GetPantryItemsParams struct {
+	// Index of the first entry.
+	Start *int
+	// Index after the last entry, at most _start + 100; required unless paging by
+	// cursor.
+	End *int
+	// Field to sort by.
+	Sort string
+	// Sort order.
+	Order string
+	// Full text search.
+	Q string
+}
+
+func (p *GetPantryItemsParams) values() url.Values {
+	v := url.Values{}
+	if p.Start != nil {
+		v.Set("_start", strconv.Itoa(*p.Start))
+	}
+	if p.End != nil {
+		v.Set("_end", strconv.Itoa(*p.End))
+	}
+	if p.Sort != "" {
+		v.Set("_sort", p.Sort)
+	}
+	if p.Order != "" {
+		v.Set("_order", p.Order)
+	}
+	if p.Q != "" {
+		v.Set("q", p.Q)
+	}
+	return v
+}
+
+// GetPantryItems sends GET /pantry. List the pantry.
+func (c *Client) GetPantryItems(ctx context.Context, params *GetPantryItemsParams) ([]*models.PantryItemWithID, *Page, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out []*models.PantryItemWithID
+	res, err := c.do(ctx, http.MethodGet, "/pantry", query, nil, &out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, page(res), nil
+}
+
+// RestockPantry sends POST /pantry/restock. Put the pantry items that ran low
+// on the list to buy.
+func (c *Client) RestockPantry(ctx context.Context) ([]models.ID, error) {
+	var out []models.ID
+	_, err := c.do(ctx, http.MethodPost, "/pantry/restock", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeletePantryItem sends DELETE /pantry/{id}. Delete a pantry item.
+func (c *Client) DeletePantryItem(ctx context.Context, id string) (*models.ID, error) {
+	var out models.ID
+	_, err := c.do(ctx, http.MethodDelete, "/pantry/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPantryItem sends GET /pantry/{id}. Get a pantry item.
+func (c *Client) GetPantryItem(ctx context.Context, id string) (*models.PantryItem, error) {
+	var out models.PantryItem
+	_, err := c.do(ctx, http.MethodGet, "/pantry/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdatePantryItem sends PUT /pantry/{id}. Change the stock, expiry date or
+// low-stock threshold of a pantry item.
+func (c *Client) UpdatePantryItem(ctx context.Context, id string, body *models.PantryItem) (*models.ID, error) {
+	var out models.ID
+	_, err := c.do(ctx, http.MethodPut, "/pantry/"+escape(id), nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConsumePantryItem sends POST /pantry/{id}/consume. Take an amount of a pantry
+// item as used.
+func (c *Client) ConsumePantryItem(ctx context.Context, id string, body *models.StockRequest) (*models.PantryItemWithID, error) {
+	var out models.PantryItemWithID
+	_, err := c.do(ctx, http.MethodPost, "/pantry/"+escape(id)+"/consume", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DiscardPantryItem sends POST /pantry/{id}/discard. Throw away an amount of a
+// pantry item, or all of it.
+func (c *Client) DiscardPantryItem(ctx context.Context, id string, body *models.StockRequest) (*models.PantryItemWithID, error) {
+	var out models.PantryItemWithID
+	_, err := c.do(ctx, http.MethodPost, "/pantry/"+escape(id)+"/discard", nil, body, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReadiness sends GET /readyz. Whether the service can serve requests, with
+// the state of its dependencies; 503 while it cannot.
+func (c *Client) GetReadiness(ctx context.Context) (*models.HealthReport, error) {
+	var out models.HealthReport
+	_, err := c.do(ctx, http.MethodGet, "/readyz", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetStartup sends GET /startupz. Whether the service finished starting, 503
+// until then.
+func (c *Client) GetStartup(ctx context.Context) (*models.HealthReport, error) {
+	var out models.HealthReport
+	_, err := c.do(ctx, http.MethodGet, "/startupz", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ClearToBuyItems sends DELETE /tobuy. Delete all items to buy.
+func (c *Client) ClearToBuyItems(ctx context.Context) (*models.ClearedList, error) {
+	var out models.ClearedList
+	_, err := c.do(ctx, http.MethodDelete, "/tobuy", nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetToBuyItemsParams are the query parameters of GetToBuyItems. Unset fields
+// are not sent.
+type GetToBuyItemsParams struct {
+	// Index of the first entry.
+	Start *int
+	// Index after the last entry, at most _start + 100; required unless paging by
+	// cursor.
+	End *int
+	// Field to sort by.
+	Sort string
+	// Sort order.
+	Order string
+	// Full text search.
+	Q string
+	// X-Next-Cursor of the previous page; keeps its sort and search and needs the
+	// same filter.
+	Cursor string
+	// Page size for cursor pagination.
+	Limit *int
+	// Count the entries into X-Total-Count when paging by cursor.
+	IncludeTotal bool
+	// Filter holds filter parameters such as amount_gte.
+	Filter url.Values
+}
+
+func (p *GetToBuyItemsParams) values() url.Values {
+	v := url.Values{}
+	for key, values := range p.Filter {
+		v[key] = values
+	}
+	if p.Start != nil {
+		v.Set("_start", strconv.Itoa(*p.Start))
+	}
+	if p.End != nil {
+		v.Set("_end", strconv.Itoa(*p.End))
+	}
+	if p.Sort != "" {
+		v.Set("_sort", p.Sort)
+	}
+	if p.Order != "" {
+		v.Set("_order", p.Order)
+	}
+	if p.Q != "" {
+		v.Set("q", p.Q)
+	}
+	if p.Cursor != "" {
+		v.Set("cursor", p.Cursor)
+	}
+	if p.Limit != nil {
+		v.Set("limit", strconv.Itoa(*p.Limit))
+	}
+	if p.IncludeTotal {
+		v.Set("include_total", "true")
+	}
+	return v
+}
+
+// GetToBuyItems sends GET /tobuy. List the items to buy, either by _start and
+// _end or by cursor and limit. Filters are given as field=value or
+// field_op=value, such as amount_gte=2, shop_in=Rewe,Edeka or
+// updated_after=2024-01-31T00:00:00Z; other parameters are ignored.
+func (c *Client) GetToBuyItems(ctx context.Context, params *GetToBuyItemsParams) ([]*models.ItemWithID, *Page, error) {
+	var query url.Values
+	if params != nil {
+		query = params.values()
+	}
+	var out []*models.ItemWithID
+	res, err := c.do(ctx, http.MethodGet, "/tobuy", query, nil, &out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, page(res), nil
+}
+
+// BuyItem sends DELETE /tobuy/{id}. Buy an item, which moves it to the bought
+// items and stocks the pantry.
+func (c *Client) BuyItem(ctx context.Context, id string) (*models.ID, error) {
+	var out models.ID
+	_, err := c.do(ctx, http.MethodDelete, "/tobuy/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetToBuyItem sends GET /tobuy/{id}. Get one of the items to buy.
+func (c *Client) GetToBuyItem(ctx context.Context, id string) (*models.Item, error) {
+	var out models.Item
+	_, err := c.do(ctx, http.MethodGet, "/tobuy/"+escape(id), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,259 @@
+// Command gen writes client_gen.go, the operations of the item-service client,
+// from api.Spec.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/shoppinglist/item-service/api"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/openapi"
+	"go/format"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const output = "client_gen.go"
+
+func main() {
+	src, err := generate(api.Spec(""))
+	if err != nil {
+		log.Logger().Fatal().Err(err).Msg("Generating the client")
+	}
+	if err = os.WriteFile(output, src, 0o644); err != nil {
+		log.Logger().Fatal().Err(err).Msg("Writing the client")
+	}
+}
+
+func generate(d *openapi.Document) ([]byte, error) {
+	imports := map[string]bool{"context": true}
+	var body bytes.Buffer
+	for _, route := range d.Operations() {
+		writeOperation(&body, route, imports)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by go generate; DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	paths := make([]string, 0, len(imports))
+	for p := range imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(&out, "\t%q\n", p)
+	}
+	out.WriteString(")\n")
+	out.Write(body.Bytes())
+	return format.Source(out.Bytes())
+}
+
+var pathParam = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+func writeOperation(w *bytes.Buffer, route *openapi.Route, imports map[string]bool) {
+	op := route.Operation
+	name := exported(op.OperationID)
+
+	var pathParams []string
+	var queryParams []*openapi.Parameter
+	for _, param := range op.Parameters {
+		switch param.In {
+		case "path":
+			pathParams = append(pathParams, param.Name)
+		case "query":
+			queryParams = append(queryParams, param)
+		}
+	}
+	hasParams := len(queryParams) > 0 || op.Filter
+	if hasParams {
+		writeParams(w, name, op, queryParams, imports)
+	}
+
+	args := []string{"ctx context.Context"}
+	for _, p := range pathParams {
+		args = append(args, p+" string")
+	}
+	bodyArg := "nil"
+	if op.Request != nil {
+		args = append(args, "body "+returnType(reflect.TypeOf(op.Request), imports))
+		bodyArg = "body"
+	}
+	queryArg := "nil"
+	if hasParams {
+		args = append(args, "params *"+name+"Params")
+		queryArg = "query"
+	}
+
+	result, zero := "string", `""`
+	if op.Response != nil {
+		if t := reflect.TypeOf(op.Response); t.Kind() != reflect.String {
+			result, zero = returnType(t, imports), "nil"
+		}
+	}
+	paged := op.Headers["X-Total-Count"] != nil
+	results := []string{result}
+	if paged {
+		results = append(results, "*Page")
+	}
+	results = append(results, "error")
+
+	pathExpr := quote(pathParam.ReplaceAllString(route.Path, `" + escape($1) + "`))
+	pathExpr = strings.TrimSuffix(strings.TrimPrefix(pathExpr, `"" + `), ` + ""`)
+
+	fmt.Fprintf(w, "\n%s", comment("", fmt.Sprintf("%s sends %s %s. %s", name, route.Method, route.Path, sentence(op.Summary))))
+	fmt.Fprintf(w, "func (c *Client) %s(%s) (%s) {\n", name, strings.Join(args, ", "), strings.Join(results, ", "))
+	if hasParams {
+		w.WriteString("\tvar query url.Values\n\tif params != nil {\n\t\tquery = params.values()\n\t}\n")
+		imports["net/url"] = true
+	}
+	outType := strings.TrimPrefix(result, "*")
+	fmt.Fprintf(w, "\tvar out %s\n", outType)
+	resVar := "_"
+	if paged {
+		resVar = "res"
+	}
+	fmt.Fprintf(w, "\t%s, err := c.do(ctx, http.Method%s, %s, %s, %s, &out)\n", resVar, methodName(route.Method), pathExpr, queryArg, bodyArg)
+	imports["net/http"] = true
+	errResults := []string{zero}
+	if paged {
+		errResults = append(errResults, "nil")
+	}
+	fmt.Fprintf(w, "\tif err != nil {\n\t\treturn %s, err\n\t}\n", strings.Join(errResults, ", "))
+	ret := "out"
+	if strings.HasPrefix(result, "*") {
+		ret = "&out"
+	}
+	if paged {
+		ret += ", page(res)"
+	}
+	fmt.Fprintf(w, "\treturn %s, nil\n}\n", ret)
+}
+
+func writeParams(w *bytes.Buffer, name string, op *openapi.Operation, params []*openapi.Parameter, imports map[string]bool) {
+	fmt.Fprintf(w, "\n%s", comment("", name+"Params are the query parameters of "+name+". Unset fields are not sent."))
+	fmt.Fprintf(w, "type %sParams struct {\n", name)
+	for _, param := range params {
+		if param.Description != "" {
+			w.WriteString(comment("\t", sentence(param.Description)))
+		}
+		fmt.Fprintf(w, "\t%s %s\n", exported(param.Name), paramType(param))
+	}
+	if op.Filter {
+		w.WriteString("\t// Filter holds filter parameters such as amount_gte.\n\tFilter url.Values\n")
+	}
+	w.WriteString("}\n")
+
+	fmt.Fprintf(w, "\nfunc (p *%sParams) values() url.Values {\n\tv := url.Values{}\n", name)
+	if op.Filter {
+		w.WriteString("\tfor key, values := range p.Filter {\n\t\tv[key] = values\n\t}\n")
+	}
+	for _, param := range params {
+		field := "p." + exported(param.Name)
+		switch paramType(param) {
+		case "*int":
+			fmt.Fprintf(w, "\tif %s != nil {\n\t\tv.Set(%q, strconv.Itoa(*%s))\n\t}\n", field, param.Name, field)
+			imports["strconv"] = true
+		case "bool":
+			fmt.Fprintf(w, "\tif %s {\n\t\tv.Set(%q, \"true\")\n\t}\n", field, param.Name)
+		default:
+			fmt.Fprintf(w, "\tif %s != \"\" {\n\t\tv.Set(%q, %s)\n\t}\n", field, param.Name, field)
+		}
+	}
+	w.WriteString("\treturn v\n}\n")
+	imports["net/url"] = true
+}
+
+// paramType is a pointer for integers, since zero is a meaningful value
+// there, and the plain type otherwise.
+func paramType(param *openapi.Parameter) string {
+	switch param.Schema.Type {
+	case "integer":
+		return "*int"
+	case "boolean":
+		return "bool"
+	default:
+		return "string"
+	}
+}
+
+// returnType returns structs by pointer and other types as they are.
+func returnType(t reflect.Type, imports map[string]bool) string {
+	if t.Kind() == reflect.Struct {
+		return "*" + typeName(t, imports)
+	}
+	return typeName(t, imports)
+}
+
+func typeName(t reflect.Type, imports map[string]bool) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "*" + typeName(t.Elem(), imports)
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem(), imports)
+	case reflect.Map:
+		return "map[" + typeName(t.Key(), imports) + "]" + typeName(t.Elem(), imports)
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "any"
+		}
+	}
+	if t.PkgPath() == "" {
+		return t.Name()
+	}
+	imports[t.PkgPath()] = true
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+// exported turns an operation ID or parameter name such as getToBuyItems,
+// _start or include_total into an exported Go name.
+func exported(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+func methodName(method string) string {
+	for _, m := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if m == method {
+			return m[:1] + strings.ToLower(m[1:])
+		}
+	}
+	panic("unsupported method " + method)
+}
+
+// comment wraps the text into comment lines of about 80 columns.
+func comment(indent string, text string) string {
+	var b strings.Builder
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(indent)+3+len(line)+1+len(word) > 80 {
+			b.WriteString(indent + "// " + line + "\n")
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	b.WriteString(indent + "// " + line + "\n")
+	return b.String()
+}
+
+func sentence(s string) string {
+	if s == "" || strings.HasSuffix(s, ".") {
+		return s
+	}
+	return s + "."
+}
+
+func quote(s string) string {
+	return `"` + s + `"`
+}
@@ -0,0 +1,55 @@
+package gql
+
+import (
+	"context"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/log"
+)
+
+// resolverError carries the code and the invalid fields of the matching REST
+// problem in the extensions of the GraphQL error.
+type resolverError struct {
+	apiErr *apierror.Error
+}
+
+func (e *resolverError) Error() string {
+	return e.apiErr.Message
+}
+
+func (e *resolverError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{
+		"code": e.apiErr.Code,
+	}
+	if len(e.apiErr.Fields) > 0 {
+		fields := make([]apierror.FieldError, 0, len(e.apiErr.Fields))
+		for _, field := range e.apiErr.Fields {
+			if name, ok := argumentNames[field.Field]; ok {
+				field.Field = name
+			}
+			fields = append(fields, field)
+		}
+		extensions["fields"] = fields
+	}
+	return extensions
+}
+
+// argumentNames maps the names of the REST parameters in validation errors
+// to the arguments of the GraphQL fields.
+var argumentNames = map[string]string{
+	"_start": "start",
+	"_end":   "end",
+	"_sort":  "sort",
+	"_order": "order",
+}
+
+// fail classifies the error like apierror.Middleware does for the REST API.
+// Server errors only expose the generic message; the cause is logged.
+func fail(ctx context.Context, message string, err error) error {
+	apiErr := apierror.From(err)
+	event := log.Ctx(ctx).Info()
+	if apiErr.Status >= 500 {
+		event = log.Ctx(ctx).Error()
+	}
+	event.Err(err).Str("code", string(apiErr.Code)).Int("status", apiErr.Status).Msg(message)
+	return &resolverError{apiErr: apiErr}
+}
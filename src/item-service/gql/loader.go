@@ -0,0 +1,85 @@
+package gql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// batchWait is how long a batch stays open for more keys. The fields of
+	// list elements are resolved concurrently, so their loads arrive within
+	// it.
+	batchWait = 2 * time.Millisecond
+	// maxBatch bounds the keys fetched by one query.
+	maxBatch = 100
+)
+
+// loader batches and caches the loads of one request, so that resolving a
+// field of every element of a list costs one query rather than one per
+// element.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu     sync.Mutex
+	open   *batch[K, V]
+	loaded map[K]*batch[K, V]
+}
+
+type batch[K comparable, V any] struct {
+	keys   []K
+	once   sync.Once
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:  fetch,
+		loaded: map[K]*batch[K, V]{},
+	}
+}
+
+// load returns the value of the key, the zero value if fetch did not return
+// one.
+func (l *loader[K, V]) load(ctx context.Context, key K) (value V, err error) {
+	l.mu.Lock()
+	b, ok := l.loaded[key]
+	if !ok {
+		if l.open == nil {
+			b = &batch[K, V]{done: make(chan struct{})}
+			l.open = b
+			time.AfterFunc(batchWait, func() { l.run(ctx, b) })
+		}
+		b = l.open
+		b.keys = append(b.keys, key)
+		l.loaded[key] = b
+		if len(b.keys) >= maxBatch {
+			l.open = nil
+			go l.run(ctx, b)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.values[key], b.err
+	case <-ctx.Done():
+		return value, ctx.Err()
+	}
+}
+
+func (l *loader[K, V]) run(ctx context.Context, b *batch[K, V]) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.open == b {
+			l.open = nil
+		}
+		keys := b.keys
+		l.mu.Unlock()
+
+		b.values, b.err = l.fetch(ctx, keys)
+		close(b.done)
+	})
+}
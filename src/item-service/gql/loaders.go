@@ -0,0 +1,71 @@
+package gql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/models"
+)
+
+// loaders are the loaders of one request.
+type loaders struct {
+	items *loader[string, *models.ItemWithID]
+	// shopItems loads the items of shops, keyed by the list filter the shop
+	// was listed with.
+	shopItems map[sql.NullBool]*loader[string, []*models.ItemWithID]
+}
+
+func newLoaders() *loaders {
+	l := &loaders{
+		items:     newLoader(fetchItems),
+		shopItems: map[sql.NullBool]*loader[string, []*models.ItemWithID]{},
+	}
+	for _, bought := range []sql.NullBool{{}, {Bool: false, Valid: true}, {Bool: true, Valid: true}} {
+		l.shopItems[bought] = newLoader(fetchShopItems(bought))
+	}
+	return l
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, newLoaders())
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+func fetchItems(ctx context.Context, ids []string) (map[string]*models.ItemWithID, error) {
+	itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{})
+	if err != nil {
+		return nil, err
+	}
+	items, err := itemsDB.GetItemsByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.ItemWithID, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+	return byID, nil
+}
+
+func fetchShopItems(bought sql.NullBool) func(ctx context.Context, shops []string) (map[string][]*models.ItemWithID, error) {
+	return func(ctx context.Context, shops []string) (map[string][]*models.ItemWithID, error) {
+		itemsDB, err := db.NewItemsDB(ctx, bought)
+		if err != nil {
+			return nil, err
+		}
+		items, err := itemsDB.GetItemsByShop(ctx, shops)
+		if err != nil {
+			return nil, err
+		}
+		byShop := make(map[string][]*models.ItemWithID, len(shops))
+		for _, item := range items {
+			byShop[item.Shop] = append(byShop[item.Shop], item)
+		}
+		return byShop, nil
+	}
+}
@@ -0,0 +1,416 @@
+// Package gql serves the GraphQL API of item-service, see schema.graphql.
+// Nested fields are loaded through per-request loaders, so a list grouped by
+// shop takes one query for the shops and one for the items of all of them.
+package gql
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/items"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/policy"
+	"github.com/shoppinglist/validation"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// maxDepth bounds the nesting of queries.
+const maxDepth = 10
+
+// NewSchema returns the executable schema. Requests must be run with a
+// context from NewContext.
+func NewSchema() *graphql.Schema {
+	return graphql.MustParseSchema(schema, &resolver{}, graphql.MaxDepth(maxDepth))
+}
+
+// NewContext returns a copy of the request context with fresh loaders.
+func NewContext(ctx context.Context) context.Context {
+	return withLoaders(ctx)
+}
+
+type resolver struct{}
+
+func (r *resolver) Lists() []*listResolver {
+	return []*listResolver{{id: models.DefaultList}}
+}
+
+func (r *resolver) List(args struct{ ID graphql.ID }) *listResolver {
+	if string(args.ID) != models.DefaultList {
+		return nil
+	}
+	return &listResolver{id: models.DefaultList}
+}
+
+func (r *resolver) Item(ctx context.Context, args struct{ ID graphql.ID }) (*itemResolver, error) {
+	item, err := loadersFrom(ctx).items.load(ctx, string(args.ID))
+	if err != nil {
+		return nil, fail(ctx, "getting an item", err)
+	}
+	if item == nil {
+		return nil, nil
+	}
+	return &itemResolver{item: item}, nil
+}
+
+func (r *resolver) Items(ctx context.Context, args pageArgs) (*itemPageResolver, error) {
+	return (&listResolver{id: models.DefaultList}).Items(ctx, args)
+}
+
+func (r *resolver) Shops(ctx context.Context, args struct{ Bought *bool }) ([]*shopResolver, error) {
+	return (&listResolver{id: models.DefaultList}).Shops(ctx, args)
+}
+
+type newItem struct {
+	Title     string
+	Amount    float64
+	Unit      string
+	Shop      string
+	Category  string
+	ShelfLife int32
+}
+
+func (r *resolver) CreateItem(ctx context.Context, args struct{ Input newItem }) (*itemResolver, error) {
+	if err := policy.Check(ctx, policy.WriteItems); err != nil {
+		return nil, fail(ctx, "creating an item", err)
+	}
+	item := &models.Item{
+		Title:     args.Input.Title,
+		Amount:    args.Input.Amount,
+		Unit:      args.Input.Unit,
+		Shop:      args.Input.Shop,
+		Category:  args.Input.Category,
+		ShelfLife: int(args.Input.ShelfLife),
+	}
+	if err := validation.Struct(item); err != nil {
+		return nil, fail(ctx, "parsing item", err)
+	}
+	out, err := items.Upsert(ctx, "", item)
+	if err != nil {
+		return nil, fail(ctx, "creating an item", err)
+	}
+	return &itemResolver{item: out}, nil
+}
+
+type itemChanges struct {
+	Title     *string
+	Amount    *float64
+	Unit      *string
+	Shop      *string
+	Category  *string
+	ShelfLife *int32
+}
+
+func (c *itemChanges) apply(item *models.Item) {
+	if c.Title != nil {
+		item.Title = *c.Title
+	}
+	if c.Amount != nil {
+		item.Amount = *c.Amount
+	}
+	if c.Unit != nil {
+		item.Unit = *c.Unit
+	}
+	if c.Shop != nil {
+		item.Shop = *c.Shop
+	}
+	if c.Category != nil {
+		item.Category = *c.Category
+	}
+	if c.ShelfLife != nil {
+		item.ShelfLife = int(*c.ShelfLife)
+	}
+}
+
+func (r *resolver) UpdateItem(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input itemChanges
+}) (*itemResolver, error) {
+	if err := policy.Check(ctx, policy.WriteItems); err != nil {
+		return nil, fail(ctx, "updating an item", err)
+	}
+	itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{})
+	if err != nil {
+		return nil, fail(ctx, "getting db", err)
+	}
+	item, err := itemsDB.GetItem(ctx, string(args.ID))
+	if err != nil {
+		return nil, fail(ctx, "getting an item", err)
+	}
+	args.Input.apply(item)
+	if err = validation.Struct(item); err != nil {
+		return nil, fail(ctx, "parsing item", err)
+	}
+	out, err := items.Upsert(ctx, string(args.ID), item)
+	if err != nil {
+		return nil, fail(ctx, "updating an item", err)
+	}
+	return &itemResolver{item: out}, nil
+}
+
+func (r *resolver) BuyItem(ctx context.Context, args struct{ ID graphql.ID }) (*itemResolver, error) {
+	if err := policy.Check(ctx, policy.WriteItems); err != nil {
+		return nil, fail(ctx, "buying an item", err)
+	}
+	item, err := items.Buy(ctx, string(args.ID))
+	if err != nil {
+		return nil, fail(ctx, "buying an item", err)
+	}
+	// Buying an item that was bought already does nothing.
+	if item == nil {
+		return r.mustItem(ctx, string(args.ID))
+	}
+	return &itemResolver{item: item}, nil
+}
+
+func (r *resolver) RestoreItem(ctx context.Context, args struct{ ID graphql.ID }) (*itemResolver, error) {
+	if err := policy.Check(ctx, policy.WriteItems); err != nil {
+		return nil, fail(ctx, "restoring an item", err)
+	}
+	item, err := items.Restore(ctx, string(args.ID))
+	if err != nil {
+		return nil, fail(ctx, "restoring an item", err)
+	}
+	if item == nil {
+		return r.mustItem(ctx, string(args.ID))
+	}
+	return &itemResolver{item: item}, nil
+}
+
+func (r *resolver) mustItem(ctx context.Context, id string) (*itemResolver, error) {
+	item, err := r.Item(ctx, struct{ ID graphql.ID }{graphql.ID(id)})
+	if err == nil && item == nil {
+		err = fail(ctx, "getting an item", apierror.NotFound("item %s not found", id))
+	}
+	return item, err
+}
+
+type listResolver struct {
+	id string
+}
+
+func (r *listResolver) ID() graphql.ID {
+	return graphql.ID(r.id)
+}
+
+// pageArgs are the arguments of the item pages. Those with a default value
+// in the schema are always set.
+type pageArgs struct {
+	Bought *bool
+	Start  int32
+	End    int32
+	Sort   string
+	Order  string
+	Q      string
+}
+
+func (r *listResolver) Items(ctx context.Context, args pageArgs) (*itemPageResolver, error) {
+	q, err := validation.Range(&validation.PaginationQuery{
+		Start: int(args.Start),
+		End:   int(args.End),
+		Sort:  args.Sort,
+		Order: args.Order,
+		Query: args.Q,
+	}, db.ItemFields)
+	if err != nil {
+		return nil, fail(ctx, "parsing arguments", err)
+	}
+	itemsDB, err := db.NewItemsDB(ctx, onList(args.Bought))
+	if err != nil {
+		return nil, fail(ctx, "getting db", err)
+	}
+	items, total, err := itemsDB.GetItems(ctx, q, q.Query)
+	if err != nil {
+		return nil, fail(ctx, "getting items", err)
+	}
+	return &itemPageResolver{items: items, total: total}, nil
+}
+
+func (r *listResolver) Shops(ctx context.Context, args struct{ Bought *bool }) ([]*shopResolver, error) {
+	bought := onList(args.Bought)
+	itemsDB, err := db.NewItemsDB(ctx, bought)
+	if err != nil {
+		return nil, fail(ctx, "getting db", err)
+	}
+	shops, err := itemsDB.GetShops(ctx)
+	if err != nil {
+		return nil, fail(ctx, "getting shops", err)
+	}
+	out := make([]*shopResolver, 0, len(shops))
+	for _, shop := range shops {
+		out = append(out, &shopResolver{shop: shop, bought: bought})
+	}
+	return out, nil
+}
+
+func (r *listResolver) Totals(ctx context.Context) (*totalsResolver, error) {
+	itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{})
+	if err != nil {
+		return nil, fail(ctx, "getting db", err)
+	}
+	shops, err := itemsDB.GetShops(ctx)
+	if err != nil {
+		return nil, fail(ctx, "getting shops", err)
+	}
+	totals := &totalsResolver{shops: int32(len(shops))}
+	for _, shop := range shops {
+		totals.items += int32(shop.Items)
+		totals.bought += int32(shop.Bought)
+	}
+	return totals, nil
+}
+
+type itemPageResolver struct {
+	items []*models.ItemWithID
+	total int
+}
+
+func (r *itemPageResolver) Items() []*itemResolver {
+	out := make([]*itemResolver, 0, len(r.items))
+	for _, item := range r.items {
+		out = append(out, &itemResolver{item: item})
+	}
+	return out
+}
+
+func (r *itemPageResolver) Total() int32 {
+	return int32(r.total)
+}
+
+type shopResolver struct {
+	shop   *models.Shop
+	bought sql.NullBool
+}
+
+func (r *shopResolver) Name() string {
+	return r.shop.Name
+}
+
+func (r *shopResolver) Items(ctx context.Context) ([]*itemResolver, error) {
+	items, err := loadersFrom(ctx).shopItems[r.bought].load(ctx, r.shop.Name)
+	if err != nil {
+		return nil, fail(ctx, "getting items", err)
+	}
+	out := make([]*itemResolver, 0, len(items))
+	for _, item := range items {
+		out = append(out, &itemResolver{item: item})
+	}
+	return out, nil
+}
+
+func (r *shopResolver) Count() int32 {
+	return int32(r.shop.Items)
+}
+
+func (r *shopResolver) Bought() int32 {
+	return int32(r.shop.Bought)
+}
+
+func (r *shopResolver) ToBuy() int32 {
+	return int32(r.shop.Items - r.shop.Bought)
+}
+
+type totalsResolver struct {
+	items  int32
+	bought int32
+	shops  int32
+}
+
+func (r *totalsResolver) Items() int32 {
+	return r.items
+}
+
+func (r *totalsResolver) Bought() int32 {
+	return r.bought
+}
+
+func (r *totalsResolver) ToBuy() int32 {
+	return r.items - r.bought
+}
+
+func (r *totalsResolver) Shops() int32 {
+	return r.shops
+}
+
+type itemResolver struct {
+	item *models.ItemWithID
+}
+
+func (r *itemResolver) ID() graphql.ID {
+	return graphql.ID(r.item.ID)
+}
+
+func (r *itemResolver) Title() string {
+	return r.item.Title
+}
+
+func (r *itemResolver) Amount() float64 {
+	return r.item.Amount
+}
+
+func (r *itemResolver) Unit() string {
+	return r.item.Unit
+}
+
+func (r *itemResolver) Bought() bool {
+	return r.item.Bought
+}
+
+func (r *itemResolver) Shop() string {
+	return r.item.Shop
+}
+
+func (r *itemResolver) Category() string {
+	return r.item.Category
+}
+
+func (r *itemResolver) ShelfLife() int32 {
+	return int32(r.item.ShelfLife)
+}
+
+func (r *itemResolver) Expires() float64 {
+	return float64(r.item.Expires)
+}
+
+func (r *itemResolver) Created() float64 {
+	return float64(r.item.Created)
+}
+
+func (r *itemResolver) Updated() float64 {
+	return float64(r.item.Updated)
+}
+
+func (r *itemResolver) Sources() []*sourceResolver {
+	out := make([]*sourceResolver, 0, len(r.item.Sources))
+	for _, source := range r.item.Sources {
+		out = append(out, &sourceResolver{source: source})
+	}
+	return out
+}
+
+type sourceResolver struct {
+	source *models.ItemSource
+}
+
+func (r *sourceResolver) Plan() string {
+	return r.source.Plan
+}
+
+func (r *sourceResolver) Meal() string {
+	return r.source.Meal
+}
+
+func (r *sourceResolver) Amount() float64 {
+	return r.source.Amount
+}
+
+func onList(bought *bool) sql.NullBool {
+	if bought == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *bought, Valid: true}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/auth"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/items"
+	"github.com/shoppinglist/jobs"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/policy"
+)
+
+// AdminHandler serves the /admin endpoints, with which operators inspect and
+// repair the data of all users. They need the admin permissions of
+// policy.RoleAdmin.
+type AdminHandler interface {
+	GetUsers(c *gin.Context)
+	GetLists(c *gin.Context)
+	DeleteItem(c *gin.Context)
+	RestoreItem(c *gin.Context)
+	Migrate(c *gin.Context)
+	GetJobs(c *gin.Context)
+}
+
+type adminHandler struct {
+	genericHandler
+	authenticator auth.Authenticator
+}
+
+func NewAdminHandler(authenticator auth.Authenticator) AdminHandler {
+	return &adminHandler{
+		genericHandler: genericHandler{
+			config: config.Get(),
+		},
+		authenticator: authenticator,
+	}
+}
+
+// GetUsers lists the users with a token and their roles. Admins and viewers
+// without a token are listed as well, as they are configured.
+func (h *adminHandler) GetUsers(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	ids := h.authenticator.Users()
+	seen := map[string]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	conf := config.Get()
+	for _, id := range append(append([]string{}, conf.Auth.Admins...), conf.Auth.Viewers...) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	users := make([]*models.AdminUser, 0, len(ids))
+	for _, id := range ids {
+		role := policy.RoleOf(&auth.Principal{UserID: id})
+		users = append(users, &models.AdminUser{ID: id, Role: string(role)})
+	}
+	h.res(c, users)
+}
+
+// GetLists counts the items to buy and the bought items of every list.
+func (h *adminHandler) GetLists(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	ctx := c.Request.Context()
+	list := &models.AdminList{Name: models.DefaultList}
+	for _, count := range []struct {
+		bought bool
+		total  *int
+	}{
+		{false, &list.ToBuy},
+		{true, &list.Bought},
+	} {
+		itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{Bool: count.bought, Valid: true})
+		if err != nil {
+			h.err(c, "getting db", err)
+			return
+		}
+		// Only the total is needed, which comes with the first page.
+		if _, *count.total, err = itemsDB.GetItems(ctx, &db.PaginationQuery{Start: 0, End: 1}, ""); err != nil {
+			h.err(c, "counting items", err)
+			return
+		}
+	}
+	h.res(c, []*models.AdminList{list})
+}
+
+// DeleteItem deletes an item from either list.
+func (h *adminHandler) DeleteItem(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	id := c.Param("id")
+	if err := items.Delete(c.Request.Context(), id); err != nil {
+		h.err(c, "deleting an item", err)
+		return
+	}
+	h.res(c, models.ID{ID: id})
+}
+
+// RestoreItem puts a bought item back on the list to buy and returns it. An
+// item that is on the list already is returned as it is.
+func (h *adminHandler) RestoreItem(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	item, err := items.Restore(ctx, id)
+	if err != nil {
+		h.err(c, "restoring an item", err)
+		return
+	}
+	if item == nil {
+		itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{})
+		if err != nil {
+			h.err(c, "getting db", err)
+			return
+		}
+		found, err := itemsDB.GetItem(ctx, id)
+		if err != nil {
+			h.err(c, "getting an item", err)
+			return
+		}
+		item = &models.ItemWithID{Item: *found, ID: id}
+	}
+	h.res(c, item)
+}
+
+// Migrate creates the collections and indexes of the database again.
+func (h *adminHandler) Migrate(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	migrated, err := db.Migrate(c.Request.Context())
+	if err != nil {
+		h.err(c, "migrating", err)
+		return
+	}
+	h.res(c, migrated)
+}
+
+// GetJobs reports the background jobs of the replica that answers.
+func (h *adminHandler) GetJobs(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	h.res(c, jobs.Status())
+}
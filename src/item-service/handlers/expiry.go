@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/expiry"
+	"github.com/shoppinglist/validation"
+	"time"
+)
+
+type ExpiryHandler interface {
+	GetExpiring(c *gin.Context)
+}
+
+type expiryHandler struct {
+	genericHandler
+}
+
+func NewExpiryHandler() ExpiryHandler {
+	return &expiryHandler{
+		genericHandler{
+			config: config.Get(),
+		},
+	}
+}
+
+type ExpiringQuery struct {
+	Days *int `form:"days" binding:"omitempty,gte=0,lte=365"`
+}
+
+// GetExpiring returns the pantry items expiring within the
+// requested number of days, or the configured default.
+func (h *expiryHandler) GetExpiring(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+
+	var q ExpiringQuery
+	if err := validation.BindQuery(c, &q); err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+	days := h.config.Expiry.WithinDays
+	if q.Days != nil {
+		days = *q.Days
+	}
+
+	items, err := expiry.Find(ctx, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		h.err(c, "getting expiring items", err)
+		return
+	}
+	h.res(c, items)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/fixtures"
+	"github.com/shoppinglist/validation"
+	"net/http"
+)
+
+type FixtureHandler interface {
+	GetFixtures(c *gin.Context)
+	LoadFixture(c *gin.Context)
+}
+
+type fixtureHandler struct {
+	genericHandler
+}
+
+func NewFixtureHandler() FixtureHandler {
+	return &fixtureHandler{
+		genericHandler{
+			config: config.Get(),
+		},
+	}
+}
+
+// GetFixtures lists the datasets that can be loaded.
+func (h *fixtureHandler) GetFixtures(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	datasets, err := fixtures.List()
+	if err != nil {
+		h.err(c, "listing datasets", err)
+		return
+	}
+	h.res(c, datasets)
+}
+
+type LoadFixtureQuery struct {
+	Replace bool `form:"replace"`
+}
+
+// LoadFixture loads the dataset into the list, after deleting the items on
+// it if replace is set.
+func (h *fixtureHandler) LoadFixture(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	ctx := c.Request.Context()
+	var q LoadFixtureQuery
+	if err := validation.BindQuery(c, &q); err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+	report, err := fixtures.Load(ctx, c.Param("name"), q.Replace)
+	switch {
+	case errors.Is(err, fixtures.ErrUnknownDataset):
+		h.errWithStatus(c, http.StatusNotFound, "loading dataset", err)
+		return
+	case errors.Is(err, fixtures.ErrDisabled):
+		h.errWithStatus(c, http.StatusForbidden, "loading dataset", err)
+		return
+	case errors.Is(err, fixtures.ErrTooLarge):
+		h.errWithStatus(c, http.StatusUnprocessableEntity, "loading dataset", err)
+		return
+	case err != nil:
+		h.err(c, "loading dataset", err)
+		return
+	}
+	h.res(c, report)
+}
@@ -4,68 +4,44 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
 	"github.com/shoppinglist/config"
-	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/events"
+	"github.com/shoppinglist/models"
 	"net/http"
-	"time"
 
 	"github.com/shoppinglist/log"
 )
 
-type GenericHandler interface {
-	HealthZ(context *gin.Context)
-	Init(context *gin.Context)
-}
-
 type genericHandler struct {
 	config *config.Config
 }
 
-func NewGenericHandler() GenericHandler {
-	return &genericHandler{
-		config.Get(),
-	}
-}
-
-func (h *genericHandler) HealthZ(c *gin.Context) {
-	ctx := c.Request.Context()
-	c.Header("Content-Type", "text/plain")
-	itemsDB, err := db.NewGenericDB(ctx)
-	if err != nil {
-		h.err(c, "getting db", err)
-		return
-	}
-	report, err := itemsDB.Ping(ctx)
-	if err != nil {
-		h.err(c, "pinging db", err)
-		return
-	}
-	t := fmt.Sprintf("%s(%s)@%s: %s\nDB:%s\n", h.config.ServiceName, h.config.HostName, h.config.ServiceVersion, time.Now().Local().Format(time.RFC1123Z), report)
-	log.Logger().Printf("response %s\n", t)
-	h.res(c, t)
+// publish sends the event to the watchers and webhooks of the list. Failing to
+// queue it does not fail the request.
+func (h *genericHandler) publish(c *gin.Context, eventType string, data any) {
+	events.Publish(c.Request.Context(), models.DefaultList, eventType, data)
 }
 
-func (h *genericHandler) Init(c *gin.Context) {
-	ctx := c.Request.Context()
-	c.Header("Content-Type", "text/plain")
-	err := db.InitDB(ctx)
-	if err != nil {
-		h.err(c, "getting db", err)
-		return
+// list returns the list from the path, or aborts if there is no such list.
+func (h *genericHandler) list(c *gin.Context) (string, bool) {
+	list := c.Param("list")
+	if list != models.DefaultList {
+		h.err(c, "getting a list", apierror.NotFound("list %s not found", list))
+		return "", false
 	}
-	h.res(c, "OK")
+	return list, true
 }
 
+// err records the error for apierror.Middleware, which writes the response.
+// Database errors are mapped to the matching status, anything else is a 500.
 func (h *genericHandler) err(c *gin.Context, message string, err error) {
-	h.errWithStatus(c, http.StatusInternalServerError, message, err)
+	_ = c.Error(fmt.Errorf("%s: %w", message, err))
+	c.Abort()
 }
 
 func (h *genericHandler) errWithStatus(c *gin.Context, status int, message string, err error) {
-	err = c.AbortWithError(status, fmt.Errorf("%s: %w", message, err))
-	if err != nil {
-		log.Logger().Error().Err(err).Msg("error aborting with error")
-		c.Status(500)
-	}
+	h.err(c, message, apierror.WithStatus(status, err))
 }
 
 func (h *genericHandler) res(c *gin.Context, data any) {
@@ -84,10 +60,9 @@ func (h *genericHandler) resWithStatus(c *gin.Context, status int, data any) {
 			return
 		}
 	}
+	c.Status(status)
 	_, err = c.Writer.Write(out)
 	if err != nil {
-		h.err(c, "writing response", err)
-		return
+		log.Ctx(c.Request.Context()).Error().Err(err).Msg("Error writing response")
 	}
-	c.Status(status)
 }
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/item-service/gql"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/validation"
+)
+
+type GraphQLHandler interface {
+	GraphQL(c *gin.Context)
+}
+
+type graphQLHandler struct {
+	genericHandler
+	schema *graphql.Schema
+}
+
+func NewGraphQLHandler() GraphQLHandler {
+	return &graphQLHandler{
+		genericHandler: genericHandler{
+			config: config.Get(),
+		},
+		schema: gql.NewSchema(),
+	}
+}
+
+// GraphQL runs a query or mutation of gql.NewSchema. Errors of the request
+// itself are problems; errors of single fields are part of the response.
+func (h *graphQLHandler) GraphQL(c *gin.Context) {
+	var req models.GraphQLRequest
+	if err := validation.BindJSON(c, &req); err != nil {
+		h.err(c, "parsing request", err)
+		return
+	}
+	ctx := gql.NewContext(c.Request.Context())
+	h.res(c, h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
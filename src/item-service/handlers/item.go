@@ -4,10 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
 	"github.com/shoppinglist/config"
 	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/filter"
+	"github.com/shoppinglist/items"
 	"github.com/shoppinglist/log"
 	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/validation"
 	"net/http"
 	"strconv"
 )
@@ -17,6 +21,7 @@ type ItemHandler interface {
 	GetItem(c *gin.Context)
 	BuyItem(c *gin.Context)
 	RestoreItem(c *gin.Context)
+	ClearItems(c *gin.Context)
 }
 
 type itemHandler struct {
@@ -39,6 +44,7 @@ func (h *itemHandler) GetItem(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
 		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
 	}
 	itemsDB, err := db.NewItemsDB(ctx, h.bought)
 	if err != nil {
@@ -51,25 +57,25 @@ func (h *itemHandler) GetItem(c *gin.Context) {
 		h.err(c, "getting an item", err)
 		return
 	}
+	// The item exists but is on the other list.
+	if itemOut == nil {
+		h.err(c, "getting an item", apierror.NotFound("item %s not found", id))
+		return
+	}
 
 	h.res(c, itemOut)
 }
 
 func (h *itemHandler) BuyItem(c *gin.Context) {
-	ctx := c.Request.Context()
 	c.Header("Content-Type", "application/json")
 	id := c.Param("id")
 	if id == "" {
 		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
-	}
-	itemsDB, err := db.NewItemsDB(ctx, h.bought)
-	if err != nil {
-		h.err(c, "getting db", err)
 		return
 	}
-
-	err = itemsDB.BuyItem(ctx, id, true)
-	if err != nil {
+	// An item that was already bought is in the pantry already, so buying it
+	// again does nothing.
+	if _, err := items.Buy(c.Request.Context(), id); err != nil {
 		h.err(c, "buying an item", err)
 		return
 	}
@@ -77,24 +83,38 @@ func (h *itemHandler) BuyItem(c *gin.Context) {
 }
 
 func (h *itemHandler) RestoreItem(c *gin.Context) {
-	ctx := c.Request.Context()
 	c.Header("Content-Type", "application/json")
 	id := c.Param("id")
 	if id == "" {
 		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+	// Restoring undoes the purchase, so the amount leaves the pantry again.
+	if _, err := items.Restore(c.Request.Context(), id); err != nil {
+		h.err(c, "restoring an item", err)
+		return
 	}
+	h.resWithStatus(c, http.StatusOK, models.ID{ID: id})
+}
+
+// ClearItems deletes all items on the list.
+func (h *itemHandler) ClearItems(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
 	itemsDB, err := db.NewItemsDB(ctx, h.bought)
 	if err != nil {
 		h.err(c, "getting db", err)
 		return
 	}
 
-	err = itemsDB.BuyItem(ctx, id, false)
+	ids, err := itemsDB.ClearItems(ctx)
 	if err != nil {
-		h.err(c, "restoring an item", err)
+		h.err(c, "clearing items", err)
 		return
 	}
-	h.resWithStatus(c, http.StatusOK, models.ID{ID: id})
+	cleared := models.ClearedList{IDs: ids}
+	h.publish(c, models.EventListCleared, cleared)
+	h.res(c, cleared)
 }
 
 //func (h *itemHandler) DeleteItem(c *gin.Context) {
@@ -118,24 +138,30 @@ func (h *itemHandler) RestoreItem(c *gin.Context) {
 //	h.resWithStatus(c, http.StatusNoContent, nil)
 //}
 
-type PaginationQuery struct {
-	Start int    `form:"_start"`
-	End   int    `form:"_end"`
-	Sort  string `form:"_sort"`
-	Order string `form:"_order"`
-	Query string `form:"q"`
-}
-
+// GetItems lists the items. Clients send either the react-admin _start and
+// _end range, which always comes with X-Total-Count, or a cursor and limit.
+// Cursor pages return the cursor of the next page in X-Next-Cursor and only
+// count the items when include_total is set. Either way the items can be
+// filtered with field operators such as amount_gte=2 or shop_in=Rewe,Edeka.
 func (h *itemHandler) GetItems(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	log.Logger().Info().Any("env", c.Request.URL).Msgf("Env")
+	log.Ctx(ctx).Info().Any("env", c.Request.URL).Msgf("Env")
 
-	var p PaginationQuery
-	if err := c.ShouldBindQuery(&p); err != nil {
+	if validation.IsCursorRequest(c) {
+		h.getItemsAfter(c)
+		return
+	}
+
+	q, err := validation.Pagination(c, db.ItemFields)
+	if err != nil {
 		h.err(c, "parsing parameters", err)
 		return
 	}
+	if q.Filter, err = filter.Parse(c.Request.URL.Query(), filter.Items); err != nil {
+		h.err(c, "parsing filter", err)
+		return
+	}
 
 	c.Header("Content-Type", "application/json")
 	itemsDB, err := db.NewItemsDB(ctx, h.bought)
@@ -146,18 +172,47 @@ func (h *itemHandler) GetItems(c *gin.Context) {
 
 	var itemsOut []*models.ItemWithID
 	var total int
-	itemsOut, total, err = itemsDB.GetItems(ctx, &db.PaginationQuery{
-		Start: p.Start,
-		End:   p.End,
-		Sort:  p.Sort,
-		Order: p.Order,
-		Query: p.Query,
-	}, p.Query)
+	itemsOut, total, err = itemsDB.GetItems(ctx, q, q.Query)
 	if err != nil {
 		h.err(c, "getting items", err)
+		return
 	}
 	c.Header("X-Total-Count", strconv.Itoa(total))
 	h.res(c, itemsOut)
+}
+
+const HeaderNextCursor = "X-Next-Cursor"
+
+func (h *itemHandler) getItemsAfter(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	q, err := validation.CursorPagination(c, db.ItemFields)
+	if err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+	if q.Filter, err = filter.Parse(c.Request.URL.Query(), filter.Items); err != nil {
+		h.err(c, "parsing filter", err)
+		return
+	}
 
-	c.Status(http.StatusOK)
+	c.Header("Content-Type", "application/json")
+	itemsDB, err := db.NewItemsDB(ctx, h.bought)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	itemsOut, next, total, err := itemsDB.GetItemsAfter(ctx, q)
+	if err != nil {
+		h.err(c, "getting items", err)
+		return
+	}
+	if next != nil {
+		c.Header(HeaderNextCursor, next.Token())
+	}
+	if q.IncludeTotal {
+		c.Header("X-Total-Count", strconv.Itoa(total))
+	}
+	h.res(c, itemsOut)
 }
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/itemfile"
+	"github.com/shoppinglist/items"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/validation"
+	"net/http"
+	"time"
+)
+
+// maxImportSize and maxImportItems bound the files that can be imported at
+// once.
+const (
+	maxImportSize  = 1 << 20
+	maxImportItems = 1000
+)
+
+type ListHandler interface {
+	ExportList(c *gin.Context)
+	ImportList(c *gin.Context)
+}
+
+type listHandler struct {
+	genericHandler
+}
+
+func NewListHandler() ListHandler {
+	return &listHandler{
+		genericHandler{
+			config: config.Get(),
+		},
+	}
+}
+
+type ExportQuery struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv json md"`
+}
+
+// ExportList sends the items to buy and the bought items of the list as a
+// file to download, CSV by default.
+func (h *listHandler) ExportList(c *gin.Context) {
+	ctx := c.Request.Context()
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	var q ExportQuery
+	if err := validation.BindQuery(c, &q); err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+	if q.Format == "" {
+		q.Format = itemfile.FormatCSV
+	}
+
+	itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{})
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	found, _, err := itemsDB.GetItems(ctx, &db.PaginationQuery{Sort: "title"}, "")
+	if err != nil {
+		h.err(c, "getting items", err)
+		return
+	}
+
+	var out bytes.Buffer
+	if err = itemfile.Write(&out, q.Format, "Shopping list", found); err != nil {
+		h.err(c, "exporting items", err)
+		return
+	}
+	c.Header("Content-Type", itemfile.ContentType(q.Format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`,
+		list, time.Now().UTC().Format("2006-01-02"), q.Format))
+	h.res(c, out.String())
+}
+
+type ImportQuery struct {
+	// Format overrides the format told by the Content-Type.
+	Format string `form:"format" binding:"omitempty,oneof=csv json md text"`
+	DryRun bool   `form:"dry_run"`
+}
+
+// ImportList adds the items of a CSV, JSON or text file to the list and
+// reports every line. Lines that cannot be read are reported and skipped;
+// the others are imported unless it is a dry run.
+func (h *listHandler) ImportList(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	if _, ok := h.list(c); !ok {
+		return
+	}
+	var q ImportQuery
+	if err := validation.BindQuery(c, &q); err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+	format := q.Format
+	if format == "" {
+		format = itemfile.FormatOf(c.ContentType())
+	}
+	if format == "" {
+		h.err(c, "parsing an import", apierror.BadRequest("cannot import %s, use format or one of the content types text/csv, application/json, text/markdown and text/plain", c.ContentType()))
+		return
+	}
+
+	entries, err := itemfile.Parse(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize), format)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		h.err(c, "parsing an import", apierror.BadRequest("the file is larger than %d bytes", maxImportSize))
+		return
+	case err != nil:
+		h.err(c, "parsing an import", apierror.BadRequest("%s", err.Error()))
+		return
+	case len(entries) == 0:
+		h.err(c, "parsing an import", apierror.BadRequest("the file holds no items"))
+		return
+	case len(entries) > maxImportItems:
+		h.err(c, "parsing an import", apierror.BadRequest("the file holds %d items, at most %d can be imported at once", len(entries), maxImportItems))
+		return
+	}
+
+	report := &models.ImportReport{DryRun: q.DryRun, Lines: make([]*models.ImportLine, 0, len(entries))}
+	for _, entry := range entries {
+		line := &models.ImportLine{Line: entry.Line, Text: entry.Text}
+		report.Lines = append(report.Lines, line)
+		if entry.Err != nil {
+			line.Error = entry.Err.Error()
+			report.Failed++
+			continue
+		}
+		line.Item = &models.ItemWithID{Item: *entry.Item}
+		if !q.DryRun {
+			if line.Item, err = items.Upsert(ctx, "", entry.Item); err != nil {
+				h.err(c, "importing an item", err)
+				return
+			}
+		}
+		report.Imported++
+	}
+	h.res(c, report)
+}
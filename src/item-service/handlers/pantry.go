@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/validation"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type PantryHandler interface {
+	GetPantryItems(c *gin.Context)
+	GetPantryItem(c *gin.Context)
+	UpdatePantryItem(c *gin.Context)
+	ConsumePantryItem(c *gin.Context)
+	DiscardPantryItem(c *gin.Context)
+	DeletePantryItem(c *gin.Context)
+	Restock(c *gin.Context)
+}
+
+type pantryHandler struct {
+	genericHandler
+}
+
+func NewPantryHandler() PantryHandler {
+	return &pantryHandler{
+		genericHandler{
+			config: config.Get(),
+		},
+	}
+}
+
+func (h *pantryHandler) GetPantryItems(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	q, err := validation.Pagination(c, db.PantryFields)
+	if err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+
+	c.Header("Content-Type", "application/json")
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	itemsOut, total, err := pantryDB.GetPantryItems(ctx, q, q.Query)
+	if err != nil {
+		h.err(c, "getting pantry items", err)
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	h.res(c, itemsOut)
+}
+
+func (h *pantryHandler) GetPantryItem(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	id := c.Param("id")
+	if id == "" {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	itemOut, err := pantryDB.GetPantryItem(ctx, id)
+	if err != nil {
+		h.err(c, "getting a pantry item", err)
+		return
+	}
+	h.res(c, itemOut)
+}
+
+// UpdatePantryItem changes the stock, expiry date or low-stock threshold of a
+// pantry item.
+func (h *pantryHandler) UpdatePantryItem(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	id := c.Param("id")
+	if id == "" {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+
+	var item models.PantryItem
+	if err := validation.BindJSON(c, &item); err != nil {
+		h.err(c, "parsing pantry item", err)
+		return
+	}
+	item.Title = strings.TrimSpace(item.Title)
+
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	existing, err := pantryDB.GetPantryItem(ctx, id)
+	if err != nil {
+		h.err(c, "getting a pantry item", err)
+		return
+	}
+	item.Created = existing.Created
+	item.Consumed = existing.Consumed
+	item.Discarded = existing.Discarded
+	item.Notified = existing.Notified
+
+	if err = pantryDB.UpsertPantryItem(ctx, id, &item); err != nil {
+		h.err(c, "updating a pantry item", err)
+		return
+	}
+	h.res(c, models.ID{ID: id})
+}
+
+func (h *pantryHandler) ConsumePantryItem(c *gin.Context) {
+	h.takeStock(c, "consuming", func(pantryDB db.PantryDB, id string, amount float64) (*models.PantryItem, error) {
+		return pantryDB.ConsumePantryItem(c.Request.Context(), id, amount)
+	})
+}
+
+// DiscardPantryItem throws away the requested amount, or the whole stock if
+// no amount is given.
+func (h *pantryHandler) DiscardPantryItem(c *gin.Context) {
+	h.takeStock(c, "discarding", func(pantryDB db.PantryDB, id string, amount float64) (*models.PantryItem, error) {
+		return pantryDB.DiscardPantryItem(c.Request.Context(), id, amount)
+	})
+}
+
+func (h *pantryHandler) takeStock(c *gin.Context, action string, take func(pantryDB db.PantryDB, id string, amount float64) (*models.PantryItem, error)) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	id := c.Param("id")
+	if id == "" {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+
+	var req models.StockRequest
+	if c.Request.ContentLength != 0 {
+		if err := validation.BindJSON(c, &req); err != nil {
+			h.err(c, "parsing request", err)
+			return
+		}
+	}
+
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	itemOut, err := take(pantryDB, id, req.Amount)
+	if err != nil {
+		h.err(c, action+" a pantry item", err)
+		return
+	}
+	h.res(c, models.PantryItemWithID{PantryItem: *itemOut, ID: id})
+}
+
+func (h *pantryHandler) DeletePantryItem(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	id := c.Param("id")
+	if id == "" {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	if err = pantryDB.DeletePantryItem(ctx, id); err != nil {
+		h.err(c, "deleting a pantry item", err)
+		return
+	}
+	h.res(c, models.ID{ID: id})
+}
+
+// Restock adds the pantry items that dropped below their threshold to the
+// to-buy list, topping them up to the threshold. Amounts already on the list
+// are taken into account.
+func (h *pantryHandler) Restock(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	lowItems, err := pantryDB.GetLowStockItems(ctx)
+	if err != nil {
+		h.err(c, "getting low stock items", err)
+		return
+	}
+
+	itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{
+		Bool:  false,
+		Valid: true,
+	})
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	ids := make([]models.ID, 0, len(lowItems))
+	for _, lowItem := range lowItems {
+		missing := lowItem.Threshold - lowItem.Amount
+		existing, err := itemsDB.FindItem(ctx, lowItem.Title, lowItem.Unit)
+		if err != nil {
+			h.err(c, "finding an item", err)
+			return
+		}
+		if existing != nil {
+			missing -= existing.Amount
+		}
+		if missing <= 0 {
+			continue
+		}
+
+		item := &models.Item{
+			Title:    lowItem.Title,
+			Amount:   missing,
+			Unit:     lowItem.Unit,
+			Shop:     lowItem.Shop,
+			Category: lowItem.Category,
+		}
+		id, err := itemsDB.MergeItem(ctx, item)
+		if err != nil {
+			h.err(c, "adding an item", err)
+			return
+		}
+		h.publish(c, models.EventItemAdded, models.ItemWithID{Item: *item, ID: id})
+		ids = append(ids, models.ID{ID: id})
+	}
+	h.res(c, ids)
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/validation"
+	"github.com/shoppinglist/webhook"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type WebhookHandler interface {
+	GetWebhooks(c *gin.Context)
+	GetWebhook(c *gin.Context)
+	CreateWebhook(c *gin.Context)
+	DeleteWebhook(c *gin.Context)
+	GetWebhookDeliveries(c *gin.Context)
+	GetDeadDeliveries(c *gin.Context)
+	RetryDelivery(c *gin.Context)
+}
+
+type webhookHandler struct {
+	genericHandler
+}
+
+func NewWebhookHandler() WebhookHandler {
+	return &webhookHandler{
+		genericHandler{
+			config: config.Get(),
+		},
+	}
+}
+
+// webhook returns the webhook from the path if it belongs to the list.
+func (h *webhookHandler) webhook(c *gin.Context, webhooksDB db.WebhooksDB, list string) (*models.WebhookWithID, bool) {
+	id := c.Param("id")
+	w, err := webhooksDB.GetWebhook(c.Request.Context(), id)
+	if err != nil {
+		h.err(c, "getting a webhook", err)
+		return nil, false
+	}
+	if w.List != list {
+		h.err(c, "getting a webhook", apierror.NotFound("webhook %s not found", id))
+		return nil, false
+	}
+	return &models.WebhookWithID{Webhook: *w, ID: id}, true
+}
+
+func (h *webhookHandler) GetWebhooks(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	webhooksDB, err := db.NewWebhooksDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	webhooks, err := webhooksDB.GetWebhooks(ctx, list)
+	if err != nil {
+		h.err(c, "getting webhooks", err)
+		return
+	}
+	for _, w := range webhooks {
+		w.Secret = ""
+	}
+	c.Header("X-Total-Count", strconv.Itoa(len(webhooks)))
+	h.res(c, webhooks)
+}
+
+func (h *webhookHandler) GetWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	webhooksDB, err := db.NewWebhooksDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	w, ok := h.webhook(c, webhooksDB, list)
+	if !ok {
+		return
+	}
+	w.Secret = ""
+	h.res(c, w)
+}
+
+// CreateWebhook registers a webhook for the list. The response carries the
+// signing secret, which is not shown again.
+func (h *webhookHandler) CreateWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+
+	var w models.Webhook
+	if err := validation.BindJSON(c, &w); err != nil {
+		h.err(c, "parsing webhook", err)
+		return
+	}
+	if w.Secret == "" {
+		var err error
+		if w.Secret, err = webhook.NewSecret(); err != nil {
+			h.err(c, "generating a secret", err)
+			return
+		}
+	}
+	w.List = list
+
+	webhooksDB, err := db.NewWebhooksDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	id, err := webhooksDB.UpsertWebhook(ctx, "", &w)
+	if err != nil {
+		h.err(c, "creating a webhook", err)
+		return
+	}
+	h.resWithStatus(c, http.StatusCreated, models.WebhookWithID{Webhook: w, ID: id})
+}
+
+func (h *webhookHandler) DeleteWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	webhooksDB, err := db.NewWebhooksDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	w, ok := h.webhook(c, webhooksDB, list)
+	if !ok {
+		return
+	}
+	if err = webhooksDB.DeleteWebhook(ctx, w.ID); err != nil {
+		h.err(c, "deleting a webhook", err)
+		return
+	}
+	h.res(c, models.ID{ID: w.ID})
+}
+
+type DeliveriesQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending delivered dead"`
+}
+
+// GetWebhookDeliveries returns the deliveries of a webhook with every attempt
+// made, newest first, optionally filtered by status.
+func (h *webhookHandler) GetWebhookDeliveries(c *gin.Context) {
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	h.getDeliveries(c, &db.DeliveryFilter{List: list, Webhook: c.Param("id")})
+}
+
+// GetDeadDeliveries returns the deliveries of the list that ran out of
+// attempts.
+func (h *webhookHandler) GetDeadDeliveries(c *gin.Context) {
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	h.getDeliveries(c, &db.DeliveryFilter{List: list, Status: models.DeliveryDead})
+}
+
+func (h *webhookHandler) getDeliveries(c *gin.Context, filter *db.DeliveryFilter) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+
+	var q DeliveriesQuery
+	if err := validation.BindQuery(c, &q); err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+	if filter.Status == "" {
+		filter.Status = q.Status
+	}
+	// Deliveries are always listed newest first.
+	page, err := validation.Pagination(c, nil)
+	if err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+
+	deliveriesDB, err := db.NewDeliveriesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	deliveries, total, err := deliveriesDB.GetDeliveries(ctx, page, filter)
+	if err != nil {
+		h.err(c, "getting deliveries", err)
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	h.res(c, deliveries)
+}
+
+// RetryDelivery puts a dead delivery back into the queue with a fresh set of
+// attempts. Earlier attempts stay on record.
+func (h *webhookHandler) RetryDelivery(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+
+	deliveriesDB, err := db.NewDeliveriesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	delivery, err := deliveriesDB.GetDelivery(ctx, id)
+	if err != nil {
+		h.err(c, "getting a delivery", err)
+		return
+	}
+	if delivery.List != list {
+		h.err(c, "getting a delivery", apierror.NotFound("delivery %s not found", id))
+		return
+	}
+	if delivery.Status != models.DeliveryDead {
+		h.err(c, "requeuing a delivery", apierror.Conflict("delivery %s is %s, only dead deliveries can be retried", id, delivery.Status))
+		return
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.Failures = 0
+	delivery.NextAttempt = time.Now().UTC().UnixMilli()
+	delivery.LockedUntil = 0
+	if _, err = deliveriesDB.UpsertDelivery(ctx, id, delivery); err != nil {
+		h.err(c, "requeuing a delivery", err)
+		return
+	}
+	h.res(c, models.ID{ID: id})
+}
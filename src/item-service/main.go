@@ -7,9 +7,26 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/auth"
 	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/expiry"
+	"github.com/shoppinglist/health"
+	"github.com/shoppinglist/idempotency"
+	"github.com/shoppinglist/item-service/api"
 	"github.com/shoppinglist/item-service/handlers"
+	"github.com/shoppinglist/item-service/rpc"
+	"github.com/shoppinglist/itempb"
 	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/metrics"
+	"github.com/shoppinglist/openapi"
+	"github.com/shoppinglist/policy"
+	"github.com/shoppinglist/ratelimit"
+	"github.com/shoppinglist/tracing"
+	"github.com/shoppinglist/webhook"
+	"google.golang.org/grpc"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,70 +34,180 @@ import (
 	"time"
 )
 
-func ErrorHandler() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Status(http.StatusOK)
-		c.Next()
-		for _, err := range c.Errors {
-			log.Logger().Err(err).Msg("Error getting db")
-		}
-		if len(c.Errors) > 0 && c.Writer.Status() == http.StatusOK {
-			c.JSON(http.StatusInternalServerError, "Internal Server Error")
-		}
-	}
-}
-
 func main() {
 	//zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	log.Logger().Info().Any("env", os.Environ()).Msgf("Env")
+	conf := config.MustInit(os.Args[1:])
+	if err := log.Configure(conf.Log.Level, conf.Log.Format); err != nil {
+		log.Logger().Fatal().Err(err).Msg("Logging")
+	}
+	// Apply the log settings again when the configuration is reloaded.
+	config.Subscribe(func(c *config.Config) {
+		if err := log.Configure(c.Log.Level, c.Log.Format); err != nil {
+			log.Logger().Err(err).Msg("Logging")
+		}
+	})
+	log.Logger().Debug().Any("env", log.Environ()).Msg("Env")
+	log.Logger().Info().Object("config", conf).Msg("Config")
 
-	port := config.Get().Port
+	port := conf.Server.Port
 	listenAddress := "0.0.0.0:" + port
 	log.Logger().Printf("Listening at %s", listenAddress)
 
-	router := gin.Default()
+	shutdownTracing, err := tracing.Setup(context.Background(), conf.Tracing.Exporter, conf.Service.Name, conf.Service.Version)
+	if err != nil {
+		log.Logger().Fatal().Err(err).Msg("Tracing")
+	}
+
+	// gin.Default would add gin's own access log next to log.Middleware.
+	router := gin.New()
+	if err := router.SetTrustedProxies(conf.Server.TrustedProxies); err != nil {
+		log.Logger().Fatal().Err(err).Msg("Trusted proxies")
+	}
+	router.Use(gin.Recovery())
 	router.HandleMethodNotAllowed = true
+	router.Use(metrics.Middleware())
+	router.Use(tracing.Middleware(conf.Service.Name))
+	router.Use(log.Middleware("/livez", "/readyz", "/startupz", "/metrics"))
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "https://shoppinglist.turevskiy.kharkiv.ua"},
-		AllowMethods:     []string{"*"},
-		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type", "X-Total-Count"},
+		// The allowed origins are live, see config.Reload.
+		AllowOriginFunc: func(origin string) bool {
+			return config.Get().CORS.Allows(origin)
+		},
+		AllowMethods: []string{"*"},
+		AllowHeaders: []string{"*"},
+		ExposeHeaders: []string{"Content-Length", "Content-Type", "X-Total-Count", handlers.HeaderNextCursor, apierror.HeaderRequestID,
+			"Retry-After", ratelimit.HeaderLimit, ratelimit.HeaderRemaining, ratelimit.HeaderReset, ratelimit.HeaderPolicy, idempotency.HeaderReplayed},
 		AllowCredentials: true,
-		//AllowOriginFunc: func(origin string) bool {
-		//	return origin == "https://github.com"
-		//},
-		MaxAge: 12 * time.Hour,
+		MaxAge:           conf.CORS.MaxAge,
 	}))
-	router.Use(ErrorHandler())
-	router.NoRoute(func(c *gin.Context) {
-		c.JSON(http.StatusNotFound, "Page not found")
-	})
-	router.NoMethod(func(c *gin.Context) {
-		c.JSON(http.StatusMethodNotAllowed, "Method not found")
-	})
+	router.Use(apierror.Middleware())
+	router.NoRoute(apierror.NoRoute)
+	router.NoMethod(apierror.NoMethod)
+
+	// The limits apply to the API only, not to the probes and metrics.
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore())
+
+	probes := health.NewProbes(db.Dependencies()...)
+	router.GET("/livez", probes.Live)
+	router.GET("/startupz", probes.Startup)
+	router.GET("/readyz", probes.Ready)
+	router.GET("/metrics", metrics.Handler())
 
-	genericHandler := handlers.NewGenericHandler()
-	router.GET("/init", genericHandler.Init)
-	router.GET("/healthz", genericHandler.HealthZ)
+	// The REST and gRPC APIs accept the same tokens.
+	authenticator, err := auth.NewAuthenticator(conf.Auth.Tokens)
+	if err != nil {
+		log.Logger().Fatal().Err(err).Msg("Authentication")
+	}
+	authenticated := router.Group("", limiter.ByIP(), auth.Middleware(authenticator), limiter.ByUser(),
+		idempotency.Middleware(db.NewIdempotencyDB))
 
 	toBuyHandler := handlers.NewItemHandler(sql.NullBool{
 		Bool:  false,
 		Valid: true,
 	})
-	toBuy := router.Group("/tobuy")
+	toBuy := authenticated.Group("/tobuy", policy.ReadWrite(policy.ReadItems, policy.WriteItems))
 	toBuy.GET("", toBuyHandler.GetItems)
 	toBuy.GET("/:id", toBuyHandler.GetItem)
+	toBuy.DELETE("", toBuyHandler.ClearItems)
 	toBuy.DELETE("/:id", toBuyHandler.BuyItem)
 
 	boughtHandler := handlers.NewItemHandler(sql.NullBool{
 		Bool:  true,
 		Valid: true,
 	})
-	bought := router.Group("/bought")
+	bought := authenticated.Group("/bought", policy.ReadWrite(policy.ReadItems, policy.WriteItems))
 	bought.GET("", boughtHandler.GetItems)
 	bought.GET("/:id", boughtHandler.GetItem)
 	bought.DELETE("/:id", boughtHandler.RestoreItem)
 
+	pantryHandler := handlers.NewPantryHandler()
+	pantry := authenticated.Group("/pantry", policy.ReadWrite(policy.ReadPantry, policy.WritePantry))
+	pantry.GET("", pantryHandler.GetPantryItems)
+	pantry.POST("/restock", pantryHandler.Restock)
+	pantry.GET("/:id", pantryHandler.GetPantryItem)
+	pantry.PUT("/:id", pantryHandler.UpdatePantryItem)
+	pantry.DELETE("/:id", pantryHandler.DeletePantryItem)
+	pantry.POST("/:id/consume", pantryHandler.ConsumePantryItem)
+	pantry.POST("/:id/discard", pantryHandler.DiscardPantryItem)
+
+	expiryHandler := handlers.NewExpiryHandler()
+	authenticated.GET("/expiring", policy.Require(policy.ReadPantry), expiryHandler.GetExpiring)
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go config.Watch(jobsCtx)
+	go probes.Start(jobsCtx, db.Connect)
+	if interval := conf.Expiry.CheckInterval; interval > 0 {
+		notifier, err := expiry.NewNotifier(conf.Expiry.Notifier, conf.Expiry.WebhookURL)
+		if err != nil {
+			log.Logger().Fatal().Err(err).Msg("Expiry notifier")
+		}
+		within := time.Duration(conf.Expiry.WithinDays) * 24 * time.Hour
+		go expiry.Schedule(jobsCtx, interval, within, notifier)
+	}
+
+	if conf.Features.GraphQL {
+		graphQLHandler := handlers.NewGraphQLHandler()
+		// The mutations check for policy.WriteItems themselves.
+		authenticated.POST("/graphql", policy.Require(policy.ReadItems), graphQLHandler.GraphQL)
+	}
+
+	webhookHandler := handlers.NewWebhookHandler()
+	webhooks := authenticated.Group("/lists/:list", policy.ReadWrite(policy.ReadWebhooks, policy.WriteWebhooks))
+	webhooks.GET("/webhooks", webhookHandler.GetWebhooks)
+	webhooks.POST("/webhooks", webhookHandler.CreateWebhook)
+	webhooks.GET("/webhooks/:id", webhookHandler.GetWebhook)
+	webhooks.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+	webhooks.GET("/webhooks/:id/deliveries", webhookHandler.GetWebhookDeliveries)
+	webhooks.GET("/deliveries/dead", webhookHandler.GetDeadDeliveries)
+	webhooks.POST("/deliveries/:id/retry", webhookHandler.RetryDelivery)
+
+	listHandler := handlers.NewListHandler()
+	lists := authenticated.Group("/lists/:list", policy.ReadWrite(policy.ReadItems, policy.WriteItems))
+	lists.GET("/export", listHandler.ExportList)
+	lists.POST("/import", listHandler.ImportList)
+
+	adminHandler := handlers.NewAdminHandler(authenticator)
+	admin := authenticated.Group("/admin", policy.ReadWrite(policy.ReadAdmin, policy.WriteAdmin))
+	admin.GET("/users", adminHandler.GetUsers)
+	admin.GET("/lists", adminHandler.GetLists)
+	admin.DELETE("/items/:id", adminHandler.DeleteItem)
+	admin.POST("/items/:id/restore", adminHandler.RestoreItem)
+	admin.POST("/migrations", adminHandler.Migrate)
+	admin.GET("/jobs", adminHandler.GetJobs)
+	if conf.Fixtures.Enabled {
+		fixtureHandler := handlers.NewFixtureHandler()
+		admin.GET("/fixtures", fixtureHandler.GetFixtures)
+		admin.POST("/fixtures/:name", fixtureHandler.LoadFixture)
+	}
+
+	if interval := conf.Webhooks.DispatchInterval; interval > 0 {
+		client, err := webhook.NewClient(10*time.Second, conf.Webhooks.AllowedNetworks)
+		if err != nil {
+			log.Logger().Fatal().Err(err).Msg("Webhooks")
+		}
+		dispatcher := webhook.NewDispatcher(webhook.Options{
+			Client:      client,
+			Interval:    interval,
+			MaxAttempts: conf.Webhooks.MaxAttempts,
+		})
+		go dispatcher.Run(jobsCtx)
+	}
+
+	// The document must match the routes, see api.Spec.
+	spec := api.Spec(conf.Service.Version)
+	if !conf.Fixtures.Enabled {
+		spec.Remove(http.MethodGet, "/admin/fixtures")
+		spec.Remove(http.MethodPost, "/admin/fixtures/:name")
+	}
+	if !conf.Features.GraphQL {
+		spec.Remove(http.MethodPost, "/graphql")
+	}
+	router.GET("/openapi.json", openapi.Handler(spec))
+	if problems := spec.Check(router.Routes()); len(problems) > 0 {
+		log.Logger().Fatal().Strs("problems", problems).Msg("OpenAPI document does not match the routes")
+	}
+
 	srv := &http.Server{
 		Addr:    listenAddress,
 		Handler: router,
@@ -93,21 +220,54 @@ func main() {
 		}
 	}()
 
+	var grpcServer *grpc.Server
+	if grpcPort := conf.Server.GRPCPort; grpcPort != "" {
+		grpcServer = grpc.NewServer(
+			grpc.ChainUnaryInterceptor(log.UnaryInterceptor(), auth.UnaryInterceptor(authenticator)),
+			grpc.ChainStreamInterceptor(log.StreamInterceptor(), auth.StreamInterceptor(authenticator)),
+		)
+		itempb.RegisterItemsServer(grpcServer, rpc.NewItemsServer())
+		listener, err := net.Listen("tcp", "0.0.0.0:"+grpcPort)
+		if err != nil {
+			log.Logger().Fatal().Err(err).Msg("gRPC listen")
+		}
+		log.Logger().Printf("gRPC listening at %s", listener.Addr())
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Logger().Fatal().Err(err).Msg("gRPC serve")
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shut down the server with
 	// a timeout of 5 seconds.
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscanll.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall. SIGKILL but can"t be caught, so don't need to add it
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Logger().Info().Msg("Shutdown Server ...")
+	probes.Drain()
+	time.Sleep(conf.Server.DrainDelay)
+	stopJobs()
+	if grpcServer != nil {
+		// Watch streams only end when their clients cancel, so they are not
+		// waited for.
+		grpcServer.Stop()
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Logger().Fatal().Err(err).Msg("Server Shutdown")
 	}
+	if err := db.Close(ctx); err != nil {
+		log.Logger().Err(err).Msg("Closing the database connection")
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Logger().Err(err).Msg("Flushing spans")
+	}
 	// catching ctx.Done(). timeout of 5 seconds.
 	select {
 	case <-ctx.Done():
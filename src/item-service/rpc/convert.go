@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"github.com/shoppinglist/itempb"
+	"github.com/shoppinglist/models"
+)
+
+func toProto(id string, item *models.Item) *itempb.Item {
+	out := &itempb.Item{
+		Id:        id,
+		Title:     item.Title,
+		Amount:    item.Amount,
+		Unit:      item.Unit,
+		Bought:    item.Bought,
+		Shop:      item.Shop,
+		Category:  item.Category,
+		ShelfLife: int32(item.ShelfLife),
+		Expires:   item.Expires,
+		Created:   item.Created,
+		Updated:   item.Updated,
+	}
+	for _, source := range item.Sources {
+		out.Sources = append(out.Sources, &itempb.ItemSource{
+			Plan:   source.Plan,
+			Meal:   source.Meal,
+			Amount: source.Amount,
+		})
+	}
+	return out
+}
+
+// fromProto returns the stored fields of the item. The timestamps are set by
+// the database.
+func fromProto(item *itempb.Item) *models.Item {
+	out := &models.Item{
+		Title:     item.Title,
+		Amount:    item.Amount,
+		Unit:      item.Unit,
+		Bought:    item.Bought,
+		Shop:      item.Shop,
+		Category:  item.Category,
+		ShelfLife: int(item.ShelfLife),
+		Expires:   item.Expires,
+	}
+	for _, source := range item.Sources {
+		out.Sources = append(out.Sources, &models.ItemSource{
+			Plan:   source.Plan,
+			Meal:   source.Meal,
+			Amount: source.Amount,
+		})
+	}
+	return out
+}
+
+// toEvent converts an event published by the REST or gRPC API. Item events
+// carry the item, list.cleared the deleted IDs.
+func toEvent(event *models.Event) *itempb.ItemEvent {
+	out := &itempb.ItemEvent{
+		Id:   event.ID,
+		Type: event.Type,
+		List: event.List,
+		Time: event.Time,
+	}
+	switch data := event.Data.(type) {
+	case models.ItemWithID:
+		out.Item = toProto(data.ID, &data.Item)
+	case *models.ItemWithID:
+		out.Item = toProto(data.ID, &data.Item)
+	case models.ClearedList:
+		out.Ids = data.IDs
+	}
+	return out
+}
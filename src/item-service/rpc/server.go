@@ -0,0 +1,282 @@
+// Package rpc serves the gRPC API of item-service, see itempb/items.proto. It
+// shares the storage, the item operations and the tokens of the REST API.
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/events"
+	"github.com/shoppinglist/filter"
+	"github.com/shoppinglist/itempb"
+	"github.com/shoppinglist/items"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/policy"
+	"github.com/shoppinglist/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/url"
+)
+
+type itemsServer struct {
+	itempb.UnimplementedItemsServer
+}
+
+func NewItemsServer() itempb.ItemsServer {
+	return &itemsServer{}
+}
+
+func (s *itemsServer) GetItem(ctx context.Context, req *itempb.GetItemRequest) (*itempb.Item, error) {
+	if err := policy.Check(ctx, policy.ReadItems); err != nil {
+		return nil, statusOf(ctx, "getting an item", err)
+	}
+	itemsDB, err := db.NewItemsDB(ctx, onList(req.List))
+	if err != nil {
+		return nil, statusOf(ctx, "getting db", err)
+	}
+	item, err := itemsDB.GetItem(ctx, req.Id)
+	if err != nil {
+		return nil, statusOf(ctx, "getting an item", err)
+	}
+	// The item exists but is on the other list.
+	if item == nil {
+		return nil, status.Errorf(codes.NotFound, "item %s not found", req.Id)
+	}
+	return toProto(req.Id, item), nil
+}
+
+// ListItems pages through the items like the cursor pagination of GET /tobuy
+// and GET /bought.
+func (s *itemsServer) ListItems(ctx context.Context, req *itempb.ListItemsRequest) (*itempb.ListItemsResponse, error) {
+	if err := policy.Check(ctx, policy.ReadItems); err != nil {
+		return nil, statusOf(ctx, "listing items", err)
+	}
+	q, err := validation.Cursor(&validation.CursorQuery{
+		Cursor:       req.PageToken,
+		Limit:        int(req.PageSize),
+		IncludeTotal: req.IncludeTotal,
+		Sort:         req.Sort,
+		Order:        req.Order,
+		Query:        req.Query,
+	}, db.ItemFields)
+	if err != nil {
+		return nil, statusOf(ctx, "parsing parameters", err)
+	}
+	values := url.Values{}
+	for key, value := range req.Filter {
+		values.Set(key, value)
+	}
+	if q.Filter, err = filter.Parse(values, filter.Items); err != nil {
+		return nil, statusOf(ctx, "parsing filter", inFilter(err))
+	}
+
+	itemsDB, err := db.NewItemsDB(ctx, onList(req.List))
+	if err != nil {
+		return nil, statusOf(ctx, "getting db", err)
+	}
+	itemsOut, next, total, err := itemsDB.GetItemsAfter(ctx, q)
+	if err != nil {
+		return nil, statusOf(ctx, "getting items", err)
+	}
+
+	res := &itempb.ListItemsResponse{Items: make([]*itempb.Item, 0, len(itemsOut))}
+	for _, item := range itemsOut {
+		res.Items = append(res.Items, toProto(item.ID, &item.Item))
+	}
+	if next != nil {
+		res.NextPageToken = next.Token()
+	}
+	if q.IncludeTotal {
+		res.TotalSize = int32(total)
+	}
+	return res, nil
+}
+
+func (s *itemsServer) UpsertItem(ctx context.Context, req *itempb.UpsertItemRequest) (*itempb.Item, error) {
+	if err := policy.Check(ctx, policy.WriteItems); err != nil {
+		return nil, statusOf(ctx, "upserting an item", err)
+	}
+	if req.Item == nil {
+		return nil, status.Error(codes.InvalidArgument, "item is required")
+	}
+	item := fromProto(req.Item)
+	if err := validation.Struct(item); err != nil {
+		return nil, statusOf(ctx, "parsing item", err)
+	}
+	out, err := items.Upsert(ctx, req.Item.Id, item)
+	if err != nil {
+		return nil, statusOf(ctx, "upserting an item", err)
+	}
+	return toProto(out.ID, &out.Item), nil
+}
+
+// BuyItem returns the bought item. Buying an item that was bought already
+// does nothing.
+func (s *itemsServer) BuyItem(ctx context.Context, req *itempb.ItemRequest) (*itempb.Item, error) {
+	if err := policy.Check(ctx, policy.WriteItems); err != nil {
+		return nil, statusOf(ctx, "buying an item", err)
+	}
+	item, err := items.Buy(ctx, req.Id)
+	if err != nil {
+		return nil, statusOf(ctx, "buying an item", err)
+	}
+	if item == nil {
+		return s.GetItem(ctx, &itempb.GetItemRequest{Id: req.Id})
+	}
+	return toProto(item.ID, &item.Item), nil
+}
+
+// RestoreItem returns the restored item. Restoring an item that is on the list
+// to buy does nothing.
+func (s *itemsServer) RestoreItem(ctx context.Context, req *itempb.ItemRequest) (*itempb.Item, error) {
+	if err := policy.Check(ctx, policy.WriteItems); err != nil {
+		return nil, statusOf(ctx, "restoring an item", err)
+	}
+	item, err := items.Restore(ctx, req.Id)
+	if err != nil {
+		return nil, statusOf(ctx, "restoring an item", err)
+	}
+	if item == nil {
+		return s.GetItem(ctx, &itempb.GetItemRequest{Id: req.Id})
+	}
+	return toProto(item.ID, &item.Item), nil
+}
+
+func (s *itemsServer) DeleteItem(ctx context.Context, req *itempb.ItemRequest) (*itempb.DeleteItemResponse, error) {
+	if err := policy.Check(ctx, policy.WriteItems); err != nil {
+		return nil, statusOf(ctx, "deleting an item", err)
+	}
+	if err := items.Delete(ctx, req.Id); err != nil {
+		return nil, statusOf(ctx, "deleting an item", err)
+	}
+	return &itempb.DeleteItemResponse{Id: req.Id}, nil
+}
+
+// WatchItems sends the events published in this replica. A watcher that
+// cannot keep up is ended with ABORTED and should reload the list before
+// watching again.
+func (s *itemsServer) WatchItems(req *itempb.WatchItemsRequest, stream itempb.Items_WatchItemsServer) error {
+	if err := policy.Check(stream.Context(), policy.ReadItems); err != nil {
+		return statusOf(stream.Context(), "watching items", err)
+	}
+	list := req.List
+	if list == "" {
+		list = models.DefaultList
+	}
+	watched, cancel := events.Subscribe(list)
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-watched:
+			if !ok {
+				return status.Error(codes.Aborted, "watcher fell behind, reload the list and watch again")
+			}
+			if err := stream.Send(toEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func onList(list itempb.List) sql.NullBool {
+	switch list {
+	case itempb.List_LIST_TO_BUY:
+		return sql.NullBool{Bool: false, Valid: true}
+	case itempb.List_LIST_BOUGHT:
+		return sql.NullBool{Bool: true, Valid: true}
+	default:
+		return sql.NullBool{}
+	}
+}
+
+// statusOf classifies the error like apierror.Middleware does for the REST
+// API. Server errors only expose the generic message; the cause is logged.
+func statusOf(ctx context.Context, message string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	apiErr := apierror.From(err)
+	event := log.Ctx(ctx).Info()
+	if apiErr.Status >= 500 {
+		event = log.Ctx(ctx).Error()
+	}
+	event.Err(err).Str("code", string(apiErr.Code)).Int("status", apiErr.Status).Msg(message)
+
+	st := status.New(codeOf(apiErr), apiErr.Message)
+	if len(apiErr.Fields) > 0 {
+		violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(apiErr.Fields))
+		for _, field := range apiErr.Fields {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fieldName(field.Field),
+				Description: field.Message,
+			})
+		}
+		if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+func codeOf(apiErr *apierror.Error) codes.Code {
+	switch {
+	case errors.Is(apiErr, gocb.ErrDocumentNotFound):
+		return codes.NotFound
+	case apiErr.Status == http.StatusBadRequest:
+		return codes.InvalidArgument
+	case apiErr.Status == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case apiErr.Status == http.StatusForbidden:
+		return codes.PermissionDenied
+	case apiErr.Status == http.StatusNotFound:
+		return codes.NotFound
+	case apiErr.Status == http.StatusConflict:
+		return codes.Aborted
+	case apiErr.Status == http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case apiErr.Status == http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
+
+// requestFields maps the names of the REST parameters in validation errors
+// to the fields of the gRPC requests.
+var requestFields = map[string]string{
+	"cursor": "page_token",
+	"limit":  "page_size",
+	"_sort":  "sort",
+	"_order": "order",
+	"q":      "query",
+}
+
+func fieldName(field string) string {
+	if name, ok := requestFields[field]; ok {
+		return name
+	}
+	return field
+}
+
+// inFilter reports the fields of a filter error as keys of the filter map.
+func inFilter(err error) error {
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Fields == nil {
+		return err
+	}
+	fields := make([]apierror.FieldError, 0, len(apiErr.Fields))
+	for _, field := range apiErr.Fields {
+		field.Field = "filter[" + field.Field + "]"
+		fields = append(fields, field)
+	}
+	return apierror.Invalid(fields...)
+}
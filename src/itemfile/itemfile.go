@@ -0,0 +1,160 @@
+// Package itemfile reads and writes the items of a list as files, for
+// exporting and importing lists. CSV and JSON carry every item field;
+// Markdown is a printable checklist whose lines read back as plain text, such
+// as "- [ ] 2 pc Avocado @Edeka".
+package itemfile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/shoppinglist/models"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The formats of Write and Parse. FormatText is read only; it is the
+// Markdown checklist without the need for list markers.
+const (
+	FormatCSV      = "csv"
+	FormatJSON     = "json"
+	FormatMarkdown = "md"
+	FormatText     = "text"
+)
+
+// ExportFormats and ImportFormats list the formats in the order they are
+// documented.
+var (
+	ExportFormats = []string{FormatCSV, FormatJSON, FormatMarkdown}
+	ImportFormats = []string{FormatCSV, FormatJSON, FormatMarkdown, FormatText}
+)
+
+// ContentType returns the media type of the format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSON:
+		return "application/json"
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// FormatOf returns the format of a media type, such as the Content-Type of
+// an import, or "" if there is none.
+func FormatOf(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "text/csv":
+		return FormatCSV
+	case "application/json":
+		return FormatJSON
+	case "text/markdown":
+		return FormatMarkdown
+	case "text/plain":
+		return FormatText
+	default:
+		return ""
+	}
+}
+
+// columns are the CSV columns, the JSON names of the item fields.
+var columns = []string{"id", "title", "amount", "unit", "bought", "shop", "category", "shelfLife", "expires", "created", "updated", "sources"}
+
+// Write writes the items in the format. Markdown lists the items to buy
+// before the bought ones, under the title.
+func Write(w io.Writer, format string, title string, items []*models.ItemWithID) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, items)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case FormatMarkdown:
+		return writeMarkdown(w, title, items)
+	default:
+		return fmt.Errorf("cannot export %q", format)
+	}
+}
+
+func writeCSV(w io.Writer, items []*models.ItemWithID) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(columns); err != nil {
+		return err
+	}
+	for _, item := range items {
+		sources := ""
+		if len(item.Sources) > 0 {
+			b, err := json.Marshal(item.Sources)
+			if err != nil {
+				return err
+			}
+			sources = string(b)
+		}
+		if err := out.Write([]string{
+			item.ID,
+			item.Title,
+			formatAmount(item.Amount),
+			item.Unit,
+			strconv.FormatBool(item.Bought),
+			item.Shop,
+			item.Category,
+			strconv.Itoa(item.ShelfLife),
+			strconv.FormatInt(item.Expires, 10),
+			strconv.FormatInt(item.Created, 10),
+			strconv.FormatInt(item.Updated, 10),
+			sources,
+		}); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func writeMarkdown(w io.Writer, title string, items []*models.ItemWithID) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+	for _, section := range []struct {
+		heading string
+		bought  bool
+	}{{"To buy", false}, {"Bought", true}} {
+		fmt.Fprintf(&b, "\n## %s\n\n", section.heading)
+		for _, item := range items {
+			if item.Bought == section.bought {
+				fmt.Fprintf(&b, "%s\n", Line(&item.Item))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Line writes the item as a checklist line that Parse reads back, such as
+// "- [x] 2 pc Avocado @Edeka".
+func Line(item *models.Item) string {
+	parts := []string{"- [ ]"}
+	if item.Bought {
+		parts[0] = "- [x]"
+	}
+	if item.Amount != 0 {
+		parts = append(parts, formatAmount(item.Amount))
+		if item.Unit != "" {
+			parts = append(parts, item.Unit)
+		}
+	}
+	parts = append(parts, item.Title)
+	if item.Shop != "" {
+		parts = append(parts, "@"+item.Shop)
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
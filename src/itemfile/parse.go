@@ -0,0 +1,262 @@
+package itemfile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/validation"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Entry is an item read from a file, or why it could not be read.
+type Entry struct {
+	// Line is the line of a CSV or text file, counting the CSV header, or
+	// the position in a JSON array, from 1.
+	Line int
+	// Text is the line as written, for the report.
+	Text string
+	Item *models.Item
+	Err  error
+}
+
+// Parse reads the items of a file in one of the ImportFormats. Every item is
+// validated like one sent to the API, and every line that is not an item has
+// an entry with the error, so that the file can be fixed in one go. Parse
+// fails as a whole only if the file cannot be read, such as a CSV file
+// without a title column or JSON that is not an array.
+//
+// Identifiers, times and meal plan sources are not read, since imported items
+// are new items. Text and Markdown lines hold an optional amount, unit, the
+// title and an optional shop, such as "2 pc Avocado @Edeka", in a list or
+// checklist or not; headings and empty lines are skipped.
+func Parse(r io.Reader, format string) (entries []*Entry, err error) {
+	switch format {
+	case FormatCSV:
+		entries, err = parseCSV(r)
+	case FormatJSON:
+		entries, err = parseJSON(r)
+	case FormatMarkdown, FormatText:
+		entries, err = parseText(r)
+	default:
+		return nil, fmt.Errorf("cannot import %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Err == nil {
+			entry.Err = Check(entry.Item)
+		}
+	}
+	return entries, nil
+}
+
+// Check validates the item, describing the invalid fields in one error.
+func Check(item *models.Item) error {
+	return describe(validation.Struct(item))
+}
+
+// describe turns the invalid fields of a validation error into one error
+// for the report.
+func describe(err error) error {
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || len(apiErr.Fields) == 0 {
+		return err
+	}
+	problems := make([]string, 0, len(apiErr.Fields))
+	for _, field := range apiErr.Fields {
+		problems = append(problems, field.Field+" "+field.Message)
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func parseCSV(r io.Reader) (entries []*Entry, err error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+	in.TrimLeadingSpace = true
+	header, err := in.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := index["title"]; !ok {
+		return nil, errors.New("the CSV header has no title column")
+	}
+
+	for {
+		record, err := in.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			entries = append(entries, &Entry{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := in.FieldPos(0)
+		entry := &Entry{Line: line, Text: strings.Join(record, ",")}
+		entry.Item, entry.Err = csvItem(record, index)
+		entries = append(entries, entry)
+	}
+}
+
+// csvItem reads the known columns of a CSV record. Missing columns and
+// empty cells are zero.
+func csvItem(record []string, index map[string]int) (item *models.Item, err error) {
+	cell := func(column string) string {
+		if i, ok := index[strings.ToLower(column)]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	item = &models.Item{
+		Title:    cell("title"),
+		Unit:     cell("unit"),
+		Shop:     cell("shop"),
+		Category: cell("category"),
+	}
+	var problems []string
+	if s := cell("amount"); s != "" {
+		if item.Amount, err = parseAmount(s); err != nil {
+			problems = append(problems, fmt.Sprintf("amount %q is not a number", s))
+		}
+	}
+	if s := cell("bought"); s != "" {
+		if item.Bought, err = strconv.ParseBool(s); err != nil {
+			problems = append(problems, fmt.Sprintf("bought %q is not true or false", s))
+		}
+	}
+	if s := cell("shelfLife"); s != "" {
+		if item.ShelfLife, err = strconv.Atoi(s); err != nil {
+			problems = append(problems, fmt.Sprintf("shelfLife %q is not a whole number", s))
+		}
+	}
+	if s := cell("expires"); s != "" {
+		if item.Expires, err = strconv.ParseInt(s, 10, 64); err != nil {
+			problems = append(problems, fmt.Sprintf("expires %q is not a time in Unix milliseconds", s))
+		}
+	}
+	if len(problems) > 0 {
+		return item, errors.New(strings.Join(problems, "; "))
+	}
+	return item, nil
+}
+
+func parseJSON(r io.Reader) (entries []*Entry, err error) {
+	var elements []json.RawMessage
+	err = json.NewDecoder(r).Decode(&elements)
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeError):
+		return nil, errors.New("the JSON is not an array of items")
+	case err != nil:
+		return nil, fmt.Errorf("the JSON is invalid: %w", err)
+	}
+	for i, element := range elements {
+		entry := &Entry{Line: i + 1, Item: &models.Item{}}
+		entries = append(entries, entry)
+		if err = json.Unmarshal(element, entry.Item); err != nil {
+			entry.Err = describe(validation.Error(err))
+			continue
+		}
+		entry.Text = entry.Item.Title
+		entry.Item.Base = models.Base{}
+		entry.Item.Sources = nil
+	}
+	return entries, nil
+}
+
+// listMarker matches the list or checklist marker of a text line, such as
+// "- [x] ", "* " or "1. ".
+var listMarker = regexp.MustCompile(`^(?:[-*+]\s+|\d+[.)]\s+)?(?:\[([ xX])\]\s*)?`)
+
+// leadingAmount matches an amount with an optional unit written right after
+// it, such as 2, 1.5, 0,5 or 500g.
+var leadingAmount = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)(\p{L}*)$`)
+
+// units are the units recognized after an amount in text lines. Other words
+// are part of the title.
+var units = map[string]bool{}
+
+func init() {
+	for _, unit := range strings.Fields("pc pcs piece pieces g kg mg l ml cl dl oz lb lbs " +
+		"pack packs pkg bottle bottles can cans box boxes bag bags jar jars bunch bunches dozen cup cups tbsp tsp") {
+		units[unit] = true
+	}
+}
+
+func parseText(r io.Reader) (entries []*Entry, err error) {
+	scanner := bufio.NewScanner(r)
+	line := 1
+	for ; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry := &Entry{Line: line, Text: text}
+		entry.Item, entry.Err = textItem(text)
+		entries = append(entries, entry)
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return nil, fmt.Errorf("line %d is longer than %d bytes", line, bufio.MaxScanTokenSize)
+	}
+	return entries, scanner.Err()
+}
+
+// textItem reads a line such as "- [ ] 2 pc Avocado @Edeka".
+func textItem(text string) (item *models.Item, err error) {
+	item = &models.Item{}
+	marker := listMarker.FindStringSubmatch(text)
+	item.Bought = strings.EqualFold(marker[1], "x")
+	rest := strings.TrimSpace(text[len(marker[0]):])
+
+	if i := strings.LastIndex(rest, "@"); i >= 0 && (i == 0 || rest[i-1] == ' ') {
+		item.Shop = strings.TrimSpace(rest[i+1:])
+		rest = strings.TrimSpace(rest[:i])
+	}
+
+	words := strings.Fields(rest)
+	if len(words) > 1 {
+		if match := leadingAmount.FindStringSubmatch(words[0]); match != nil {
+			amount, _ := parseAmount(match[1])
+			switch suffix := strings.ToLower(match[2]); {
+			case suffix == "" || suffix == "x":
+				item.Amount = amount
+				words = words[1:]
+				if units[strings.ToLower(words[0])] {
+					item.Unit = words[0]
+					words = words[1:]
+				}
+			case units[suffix]:
+				item.Amount, item.Unit = amount, match[2]
+				words = words[1:]
+			}
+		}
+	}
+	item.Title = strings.Join(words, " ")
+	if item.Title == "" {
+		return item, errors.New("the line has no title")
+	}
+	return item, nil
+}
+
+// parseAmount reads a decimal number with a point or a comma.
+func parseAmount(s string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+}
@@ -0,0 +1,375 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.1
+// source: itempb/items.proto
+
+package itempb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Items_GetItem_FullMethodName     = "/shoppinglist.items.v1.Items/GetItem"
+	Items_ListItems_FullMethodName   = "/shoppinglist.items.v1.Items/ListItems"
+	Items_UpsertItem_FullMethodName  = "/shoppinglist.items.v1.Items/UpsertItem"
+	Items_BuyItem_FullMethodName     = "/shoppinglist.items.v1.Items/BuyItem"
+	Items_RestoreItem_FullMethodName = "/shoppinglist.items.v1.Items/RestoreItem"
+	Items_DeleteItem_FullMethodName  = "/shoppinglist.items.v1.Items/DeleteItem"
+	Items_WatchItems_FullMethodName  = "/shoppinglist.items.v1.Items/WatchItems"
+)
+
+// ItemsClient is the client API for Items service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ItemsClient interface {
+	// GetItem returns the item, NOT_FOUND if it does not exist or is on the
+	// other list.
+	GetItem(ctx context.Context, in *GetItemRequest, opts ...grpc.CallOption) (*Item, error)
+	// ListItems returns a page of items. Pass next_page_token as page_token to
+	// get the following page.
+	ListItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (*ListItemsResponse, error)
+	// UpsertItem creates an item, or replaces it if the id is given.
+	UpsertItem(ctx context.Context, in *UpsertItemRequest, opts ...grpc.CallOption) (*Item, error)
+	// BuyItem moves an item to the bought list and stocks the pantry.
+	BuyItem(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*Item, error)
+	// RestoreItem puts a bought item back on the list to buy.
+	RestoreItem(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*Item, error)
+	DeleteItem(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*DeleteItemResponse, error)
+	// WatchItems streams the changes of a list until the client cancels.
+	WatchItems(ctx context.Context, in *WatchItemsRequest, opts ...grpc.CallOption) (Items_WatchItemsClient, error)
+}
+
+type itemsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewItemsClient(cc grpc.ClientConnInterface) ItemsClient {
+	return &itemsClient{cc}
+}
+
+func (c *itemsClient) GetItem(ctx context.Context, in *GetItemRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, Items_GetItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *itemsClient) ListItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (*ListItemsResponse, error) {
+	out := new(ListItemsResponse)
+	err := c.cc.Invoke(ctx, Items_ListItems_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *itemsClient) UpsertItem(ctx context.Context, in *UpsertItemRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, Items_UpsertItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *itemsClient) BuyItem(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, Items_BuyItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *itemsClient) RestoreItem(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, Items_RestoreItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *itemsClient) DeleteItem(ctx context.Context, in *ItemRequest, opts ...grpc.CallOption) (*DeleteItemResponse, error) {
+	out := new(DeleteItemResponse)
+	err := c.cc.Invoke(ctx, Items_DeleteItem_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *itemsClient) WatchItems(ctx context.Context, in *WatchItemsRequest, opts ...grpc.CallOption) (Items_WatchItemsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Items_ServiceDesc.Streams[0], Items_WatchItems_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &itemsWatchItemsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Items_WatchItemsClient interface {
+	Recv() (*ItemEvent, error)
+	grpc.ClientStream
+}
+
+type itemsWatchItemsClient struct {
+	grpc.ClientStream
+}
+
+func (x *itemsWatchItemsClient) Recv() (*ItemEvent, error) {
+	m := new(ItemEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ItemsServer is the server API for Items service.
+// All implementations must embed UnimplementedItemsServer
+// for forward compatibility
+type ItemsServer interface {
+	// GetItem returns the item, NOT_FOUND if it does not exist or is on the
+	// other list.
+	GetItem(context.Context, *GetItemRequest) (*Item, error)
+	// ListItems returns a page of items. Pass next_page_token as page_token to
+	// get the following page.
+	ListItems(context.Context, *ListItemsRequest) (*ListItemsResponse, error)
+	// UpsertItem creates an item, or replaces it if the id is given.
+	UpsertItem(context.Context, *UpsertItemRequest) (*Item, error)
+	// BuyItem moves an item to the bought list and stocks the pantry.
+	BuyItem(context.Context, *ItemRequest) (*Item, error)
+	// RestoreItem puts a bought item back on the list to buy.
+	RestoreItem(context.Context, *ItemRequest) (*Item, error)
+	DeleteItem(context.Context, *ItemRequest) (*DeleteItemResponse, error)
+	// WatchItems streams the changes of a list until the client cancels.
+	WatchItems(*WatchItemsRequest, Items_WatchItemsServer) error
+	mustEmbedUnimplementedItemsServer()
+}
+
+// UnimplementedItemsServer must be embedded to have forward compatible implementations.
+type UnimplementedItemsServer struct {
+}
+
+func (UnimplementedItemsServer) GetItem(context.Context, *GetItemRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetItem not implemented")
+}
+func (UnimplementedItemsServer) ListItems(context.Context, *ListItemsRequest) (*ListItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListItems not implemented")
+}
+func (UnimplementedItemsServer) UpsertItem(context.Context, *UpsertItemRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpsertItem not implemented")
+}
+func (UnimplementedItemsServer) BuyItem(context.Context, *ItemRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BuyItem not implemented")
+}
+func (UnimplementedItemsServer) RestoreItem(context.Context, *ItemRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreItem not implemented")
+}
+func (UnimplementedItemsServer) DeleteItem(context.Context, *ItemRequest) (*DeleteItemResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteItem not implemented")
+}
+func (UnimplementedItemsServer) WatchItems(*WatchItemsRequest, Items_WatchItemsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchItems not implemented")
+}
+func (UnimplementedItemsServer) mustEmbedUnimplementedItemsServer() {}
+
+// UnsafeItemsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ItemsServer will
+// result in compilation errors.
+type UnsafeItemsServer interface {
+	mustEmbedUnimplementedItemsServer()
+}
+
+func RegisterItemsServer(s grpc.ServiceRegistrar, srv ItemsServer) {
+	s.RegisterService(&Items_ServiceDesc, srv)
+}
+
+func _Items_GetItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ItemsServer).GetItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Items_GetItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ItemsServer).GetItem(ctx, req.(*GetItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Items_ListItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ItemsServer).ListItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Items_ListItems_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ItemsServer).ListItems(ctx, req.(*ListItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Items_UpsertItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpsertItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ItemsServer).UpsertItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Items_UpsertItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ItemsServer).UpsertItem(ctx, req.(*UpsertItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Items_BuyItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ItemsServer).BuyItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Items_BuyItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ItemsServer).BuyItem(ctx, req.(*ItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Items_RestoreItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ItemsServer).RestoreItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Items_RestoreItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ItemsServer).RestoreItem(ctx, req.(*ItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Items_DeleteItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ItemsServer).DeleteItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Items_DeleteItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ItemsServer).DeleteItem(ctx, req.(*ItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Items_WatchItems_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchItemsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ItemsServer).WatchItems(m, &itemsWatchItemsServer{stream})
+}
+
+type Items_WatchItemsServer interface {
+	Send(*ItemEvent) error
+	grpc.ServerStream
+}
+
+type itemsWatchItemsServer struct {
+	grpc.ServerStream
+}
+
+func (x *itemsWatchItemsServer) Send(m *ItemEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Items_ServiceDesc is the grpc.ServiceDesc for Items service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Items_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shoppinglist.items.v1.Items",
+	HandlerType: (*ItemsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetItem",
+			Handler:    _Items_GetItem_Handler,
+		},
+		{
+			MethodName: "ListItems",
+			Handler:    _Items_ListItems_Handler,
+		},
+		{
+			MethodName: "UpsertItem",
+			Handler:    _Items_UpsertItem_Handler,
+		},
+		{
+			MethodName: "BuyItem",
+			Handler:    _Items_BuyItem_Handler,
+		},
+		{
+			MethodName: "RestoreItem",
+			Handler:    _Items_RestoreItem_Handler,
+		},
+		{
+			MethodName: "DeleteItem",
+			Handler:    _Items_DeleteItem_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchItems",
+			Handler:       _Items_WatchItems_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "itempb/items.proto",
+}
@@ -0,0 +1,157 @@
+// Package items holds the item operations that change more than the item
+// itself, such as the pantry or the watchers of the list. The REST and gRPC
+// APIs both go through it so that they behave the same.
+package items
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/events"
+	"github.com/shoppinglist/expiry"
+	"github.com/shoppinglist/models"
+	"time"
+)
+
+var (
+	toBuy  = sql.NullBool{Bool: false, Valid: true}
+	bought = sql.NullBool{Bool: true, Valid: true}
+)
+
+// Buy moves the item to the bought items, sets its expiry date and stocks the
+// pantry. It returns nil if the item is not on the list to buy, such as when
+// it was bought already.
+func Buy(ctx context.Context, id string) (item *models.ItemWithID, err error) {
+	itemsDB, err := db.NewItemsDB(ctx, toBuy)
+	if err != nil {
+		return nil, fmt.Errorf("getting db: %w", err)
+	}
+	found, err := move(ctx, itemsDB, id, true, func(item *models.Item) int64 {
+		return expiry.Expires(time.Now(), item.Category, item.ShelfLife)
+	})
+	if err != nil || found == nil {
+		return nil, err
+	}
+
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting db: %w", err)
+	}
+	if _, err = pantryDB.StockItem(ctx, found); err != nil {
+		return nil, fmt.Errorf("stocking an item: %w", err)
+	}
+	item = &models.ItemWithID{Item: *found, ID: id}
+	events.Publish(ctx, models.DefaultList, models.EventItemBought, item)
+	return
+}
+
+// Restore puts a bought item back on the list to buy and takes it out of the
+// pantry again. It returns nil if the item was not bought.
+func Restore(ctx context.Context, id string) (item *models.ItemWithID, err error) {
+	itemsDB, err := db.NewItemsDB(ctx, bought)
+	if err != nil {
+		return nil, fmt.Errorf("getting db: %w", err)
+	}
+	found, err := move(ctx, itemsDB, id, false, func(item *models.Item) int64 {
+		return 0
+	})
+	if err != nil || found == nil {
+		return nil, err
+	}
+
+	pantryDB, err := db.NewPantryDB(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting db: %w", err)
+	}
+	if err = pantryDB.UnstockItem(ctx, found); err != nil {
+		return nil, fmt.Errorf("unstocking an item: %w", err)
+	}
+	item = &models.ItemWithID{Item: *found, ID: id}
+	events.Publish(ctx, models.DefaultList, models.EventItemAdded, item)
+	return
+}
+
+// move moves the item of the list of itemsDB to the other list and returns
+// it as it is now, or nil if it is not on the list. The item is moved only if
+// it did not change since it was read, so that of two concurrent requests
+// only one moves it and changes the pantry; the other finds it moved already.
+func move(ctx context.Context, itemsDB db.ItemsDB, id string, bought bool, expires func(item *models.Item) int64) (item *models.Item, err error) {
+	for i := 0; ; i++ {
+		item, cas, err := itemsDB.GetItemCas(ctx, id)
+		if err != nil || item == nil {
+			return nil, err
+		}
+		item.Bought = bought
+		item.Expires = expires(item)
+		err = itemsDB.BuyItem(ctx, id, cas, item.Bought, item.Expires)
+		if errors.Is(err, gocb.ErrAmbiguousTimeout) && landed(ctx, id, item) {
+			return item, nil
+		}
+		if errors.Is(err, gocb.ErrCasMismatch) && i < db.CasRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+}
+
+// landed tells whether a move that timed out took effect anyway, in which
+// case the item is on the other list with the expiry date the move set, and
+// the request that moved it still has to change the pantry.
+func landed(ctx context.Context, id string, moved *models.Item) bool {
+	itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{Bool: moved.Bought, Valid: true})
+	if err != nil {
+		return false
+	}
+	item, err := itemsDB.GetItem(ctx, id)
+	return err == nil && item != nil && item.Expires == moved.Expires
+}
+
+// Upsert creates the item, or replaces it if id is not empty, and publishes
+// item.added or item.updated. The creation time of a replaced item is kept.
+func Upsert(ctx context.Context, id string, item *models.Item) (out *models.ItemWithID, err error) {
+	itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{})
+	if err != nil {
+		return nil, fmt.Errorf("getting db: %w", err)
+	}
+	eventType := models.EventItemAdded
+	if id != "" {
+		existing, err := itemsDB.GetItem(ctx, id)
+		if err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) {
+			return nil, err
+		}
+		if existing != nil {
+			eventType = models.EventItemUpdated
+			item.Created = existing.Created
+		}
+	}
+
+	if id, err = itemsDB.UpsertItem(ctx, id, item); err != nil {
+		return nil, err
+	}
+	out = &models.ItemWithID{Item: *item, ID: id}
+	events.Publish(ctx, models.DefaultList, eventType, out)
+	return
+}
+
+// Delete deletes the item from either list and publishes item.deleted.
+func Delete(ctx context.Context, id string) (err error) {
+	itemsDB, err := db.NewItemsDB(ctx, sql.NullBool{})
+	if err != nil {
+		return fmt.Errorf("getting db: %w", err)
+	}
+	item, err := itemsDB.GetItem(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = itemsDB.DeleteItem(ctx, id); err != nil {
+		return err
+	}
+	events.Publish(ctx, models.DefaultList, models.EventItemDeleted, &models.ItemWithID{Item: *item, ID: id})
+	return
+}
@@ -0,0 +1,121 @@
+// Package jobs runs the periodic background jobs of a service, such as the
+// expiry reminders and the webhook dispatcher, and keeps track of their runs
+// so that their health can be reported, see Status.
+package jobs
+
+import (
+	"context"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// job is the state of a job that was started with Run.
+type job struct {
+	name     string
+	interval time.Duration
+	running  bool
+	runs     int
+	failures int
+	// failing counts the failed runs since the last successful one.
+	failing     int
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+	duration    time.Duration
+}
+
+var registry struct {
+	sync.Mutex
+	jobs map[string]*job
+}
+
+// Run calls fn right away and then every interval until ctx is done. A run
+// fails if fn returns an error, which is logged.
+func Run(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	j := &job{name: name, interval: interval}
+	registry.Lock()
+	if registry.jobs == nil {
+		registry.jobs = map[string]*job{}
+	}
+	registry.jobs[name] = j
+	registry.Unlock()
+	defer func() {
+		registry.Lock()
+		delete(registry.jobs, name)
+		registry.Unlock()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		j.run(ctx, fn)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *job) run(ctx context.Context, fn func(ctx context.Context) error) {
+	registry.Lock()
+	j.running = true
+	registry.Unlock()
+
+	started := time.Now()
+	err := fn(ctx)
+	if err != nil && ctx.Err() == nil {
+		log.Ctx(ctx).Error().Err(err).Str("job", j.name).Msg("Job failed")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	j.running = false
+	j.runs++
+	j.lastRun = started
+	j.duration = time.Since(started)
+	if err != nil {
+		j.failures++
+		j.failing++
+		j.lastError = err.Error()
+		return
+	}
+	j.failing = 0
+	j.lastSuccess = started
+}
+
+// Status reports the jobs running in this replica by name. A job is healthy
+// unless its last run failed or it missed two runs in a row.
+func Status() (jobs []*models.JobStatus) {
+	registry.Lock()
+	defer registry.Unlock()
+	jobs = []*models.JobStatus{}
+	for _, j := range registry.jobs {
+		status := &models.JobStatus{
+			Name:       j.name,
+			Interval:   j.interval.String(),
+			Running:    j.running,
+			Runs:       j.runs,
+			Failures:   j.failures,
+			Failing:    j.failing,
+			DurationMs: j.duration.Milliseconds(),
+		}
+		if !j.lastRun.IsZero() {
+			status.LastRun = j.lastRun.UTC().UnixMilli()
+		}
+		if !j.lastSuccess.IsZero() {
+			status.LastSuccess = j.lastSuccess.UTC().UnixMilli()
+		}
+		if j.failing > 0 {
+			status.LastError = j.lastError
+		}
+		overdue := !j.running && time.Since(j.lastRun) > 2*j.interval
+		status.Healthy = j.failing == 0 && !overdue
+		jobs = append(jobs, status)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Name < jobs[k].Name })
+	return
+}
@@ -0,0 +1,71 @@
+package log
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// metadataRequestID is the metadata key of the request ID, the counterpart
+// of the X-Request-ID header.
+const metadataRequestID = "x-request-id"
+
+// UnaryInterceptor is Middleware for unary gRPC calls. The full method name
+// is the route, and the status code is logged in place of the HTTP status.
+func UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx = newCallContext(ctx, info.FullMethod)
+		res, err := handler(ctx, req)
+		logCall(ctx, err, start)
+		return res, err
+	}
+}
+
+// StreamInterceptor is UnaryInterceptor for streaming calls, which are
+// logged when they end.
+func StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := newCallContext(ss.Context(), info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		logCall(ctx, err, start)
+		return err
+	}
+}
+
+func newCallContext(ctx context.Context, method string) context.Context {
+	var sent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(metadataRequestID); len(values) > 0 {
+			sent = values[0]
+		}
+	}
+	requestID := newRequestID(sent)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(metadataRequestID, requestID))
+	return newRequestContext(ctx, requestID, "grpc", method)
+}
+
+func logCall(ctx context.Context, err error, start time.Time) {
+	code := status.Code(err)
+	event := Ctx(ctx).Info()
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss:
+		event = Ctx(ctx).Error()
+	}
+	event.Str("code", code.String()).Dur("latency", time.Since(start)).Msg("request")
+}
+
+// serverStream replaces the context of a stream with the one carrying the
+// logger.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
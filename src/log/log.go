@@ -1,12 +1,119 @@
+// Package log provides the zerolog loggers of the services. Code that handles
+// a request logs through Ctx, which carries the request ID, route and user of
+// the request; Logger is the service logger for everything else.
 package log
 
 import (
+	"context"
+	"fmt"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+	"io"
 	"os"
+	"sync/atomic"
 )
 
-var logger = zerolog.New(os.Stdout).With().Timestamp().Caller().Logger()
+// The formats Configure accepts.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+var logger = newLogger(output)
+
+// output is where the loggers write. Configure swaps its writer rather than
+// the loggers, which request contexts and other packages hold on to.
+var output = &switchWriter{}
+
+type switchWriter struct {
+	w atomic.Pointer[io.Writer]
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	if w := s.w.Load(); w != nil {
+		return (*w).Write(p)
+	}
+	return os.Stdout.Write(p)
+}
+
+func (s *switchWriter) set(w io.Writer) {
+	s.w.Store(&w)
+}
+
+func newLogger(w io.Writer) zerolog.Logger {
+	return zerolog.New(w).With().Timestamp().Caller().Logger().Hook(traceHook{})
+}
 
 func Logger() *zerolog.Logger {
 	return &logger
 }
+
+// Configure sets the level, such as debug or info, and the format of all
+// loggers. It can be called again while serving, when the configuration is
+// reloaded.
+func Configure(level string, format string) error {
+	return ConfigureOutput(level, format, os.Stdout)
+}
+
+// ConfigureOutput is Configure writing to w, such as os.Stderr for commands
+// that write their results to standard output.
+func ConfigureOutput(level string, format string, w io.Writer) error {
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	switch format {
+	case FormatJSON, "":
+		output.set(w)
+	case FormatConsole:
+		output.set(zerolog.ConsoleWriter{Out: w})
+	default:
+		return fmt.Errorf("invalid log format %q, expected %s or %s", format, FormatJSON, FormatConsole)
+	}
+	zerolog.SetGlobalLevel(lvl)
+	return nil
+}
+
+type contextKey struct{}
+
+// Ctx returns the logger of the request the context belongs to, or the
+// service logger outside of requests. Events get the trace and span IDs of
+// the span in the context.
+func Ctx(ctx context.Context) *zerolog.Logger {
+	l, ok := ctx.Value(contextKey{}).(zerolog.Logger)
+	if !ok {
+		l = logger
+	}
+	l = l.With().Ctx(ctx).Logger()
+	return &l
+}
+
+// NewContext returns a copy of ctx carrying the logger.
+func NewContext(ctx context.Context, l zerolog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// With returns a copy of ctx whose logger has the fields added, as in
+//
+//	ctx = log.With(ctx, func(c zerolog.Context) zerolog.Context {
+//		return c.Str("userId", id)
+//	})
+func With(ctx context.Context, fields func(c zerolog.Context) zerolog.Context) context.Context {
+	l, ok := ctx.Value(contextKey{}).(zerolog.Logger)
+	if !ok {
+		l = logger
+	}
+	return NewContext(ctx, fields(l.With()).Logger())
+}
+
+// traceHook adds the trace and span IDs to events logged with the context of
+// a traced request.
+type traceHook struct{}
+
+func (traceHook) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	spanContext := trace.SpanContextFromContext(e.GetCtx())
+	if !spanContext.IsValid() {
+		return
+	}
+	e.Str("traceId", spanContext.TraceID().String()).Str("spanId", spanContext.SpanID().String())
+}
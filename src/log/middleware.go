@@ -0,0 +1,116 @@
+package log
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"net/http"
+	"time"
+)
+
+const HeaderRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request the context belongs to.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns the ID the caller sent, if it is usable, or a new one.
+func newRequestID(sent string) string {
+	if sent == "" || len(sent) > 128 {
+		return xid.New().String()
+	}
+	return sent
+}
+
+// newRequestContext gives the request its ID and a logger with the ID, the
+// method and the route.
+func newRequestContext(ctx context.Context, requestID string, method string, route string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return With(ctx, func(c zerolog.Context) zerolog.Context {
+		c = c.Str("requestId", requestID).Str("method", method)
+		if route != "" {
+			c = c.Str("route", route)
+		}
+		return c
+	})
+}
+
+// logRequest writes the access log line of a finished request. Server errors
+// are logged as errors, everything else as info.
+func logRequest(ctx context.Context, status int, size int, start time.Time) {
+	event := Ctx(ctx).Info()
+	if status >= http.StatusInternalServerError {
+		event = Ctx(ctx).Error()
+	}
+	event.Int("status", status).Int("size", size).Dur("latency", time.Since(start)).Msg("request")
+}
+
+// Middleware gives every request an ID, taken from the X-Request-ID header
+// if the caller sent a usable one, and a logger for Ctx. When the request is
+// done it is logged with its status and latency, except for the skipped
+// routes such as health checks. It must be registered before the handlers
+// and the other middlewares that log.
+func Middleware(skip ...string) gin.HandlerFunc {
+	skipped := map[string]bool{}
+	for _, route := range skip {
+		skipped[route] = true
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := newRequestID(c.GetHeader(HeaderRequestID))
+		c.Header(HeaderRequestID, requestID)
+		c.Request = c.Request.WithContext(newRequestContext(c.Request.Context(), requestID, c.Request.Method, c.FullPath()))
+
+		c.Next()
+
+		if !skipped[c.FullPath()] {
+			logRequest(c.Request.Context(), c.Writer.Status(), c.Writer.Size(), start)
+		}
+	}
+}
+
+// Handler is Middleware for services without gin. Requests are not labelled
+// with a route.
+func Handler(next http.Handler, skip ...string) http.Handler {
+	skipped := map[string]bool{}
+	for _, path := range skip {
+		skipped[path] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := newRequestID(r.Header.Get(HeaderRequestID))
+		w.Header().Set(HeaderRequestID, requestID)
+		r = r.WithContext(newRequestContext(r.Context(), requestID, r.Method, ""))
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		if !skipped[r.URL.Path] {
+			logRequest(With(r.Context(), func(c zerolog.Context) zerolog.Context {
+				return c.Str("path", r.URL.Path)
+			}), rec.status, rec.size, start)
+		}
+	})
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
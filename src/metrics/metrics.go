@@ -0,0 +1,145 @@
+// Package metrics exposes Prometheus metrics of the HTTP APIs and the database
+// calls of a service on /metrics.
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// unmatched is the route label of requests that matched no route, so that
+// scans of random paths do not add label values.
+const unmatched = "unmatched"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	httpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being served.",
+	})
+
+	dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_operation_duration_seconds",
+		Help:    "Latency of database operations by backend, collection and operation.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"backend", "collection", "operation"})
+	dbErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_operation_errors_total",
+		Help: "Failed database operations by backend, collection and operation.",
+	}, []string{"backend", "collection", "operation"})
+
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "State of the circuit breakers: 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
+	breakerRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "circuit_breaker_rejections_total",
+		Help: "Calls failed fast by open circuit breakers.",
+	}, []string{"name"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "Requests rejected over a rate limit, by limit.",
+	}, []string{"limit"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(HTTPHandler())
+}
+
+// HTTPHandler is Handler for services without gin.
+func HTTPHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records the requests of the gin router by route pattern, such as
+// /tobuy/:id.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = unmatched
+		}
+		observeHTTP(route, c.Request.Method, c.Writer.Status(), start)
+	}
+}
+
+// Instrument records the requests of a plain net/http handler. Requests are
+// labelled with their path if it is one of routes.
+func Instrument(next http.Handler, routes ...string) http.Handler {
+	known := map[string]bool{}
+	for _, route := range routes {
+		known[route] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		route := unmatched
+		if known[r.URL.Path] {
+			route = r.URL.Path
+		}
+		observeHTTP(route, r.Method, rec.status, start)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func observeHTTP(route string, method string, status int, start time.Time) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(time.Since(start).Seconds())
+}
+
+// ObserveDB records a database operation that started at start. Failed
+// operations are counted as errors as well.
+func ObserveDB(backend string, collection string, operation string, start time.Time, failed bool) {
+	dbDuration.WithLabelValues(backend, collection, operation).Observe(time.Since(start).Seconds())
+	if failed {
+		dbErrors.WithLabelValues(backend, collection, operation).Inc()
+	}
+}
+
+// SetBreakerState records the state of the circuit breaker, see
+// resilience.State.
+func SetBreakerState(name string, state int) {
+	breakerState.WithLabelValues(name).Set(float64(state))
+}
+
+// RejectedByBreaker counts a call the open circuit breaker failed fast.
+func RejectedByBreaker(name string) {
+	breakerRejections.WithLabelValues(name).Inc()
+}
+
+// RateLimited counts a request rejected over the named rate limit.
+func RateLimited(limit string) {
+	rateLimited.WithLabelValues(limit).Inc()
+}
@@ -0,0 +1,39 @@
+package models
+
+// AdminUser is a user with a token and the role it has, see policy.RoleOf.
+type AdminUser struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// AdminList counts the items of a list.
+type AdminList struct {
+	Name   string `json:"name"`
+	ToBuy  int    `json:"toBuy"`
+	Bought int    `json:"bought"`
+}
+
+// Migration reports the collection a schema migration created or indexed.
+// Nothing is migrated in the in-memory backend.
+type Migration struct {
+	Collection string `json:"collection"`
+	Migrated   bool   `json:"migrated"`
+	Error      string `json:"error,omitempty"`
+}
+
+// JobStatus is the state of a background job in the replica that answered.
+// The times are Unix milliseconds; Failing counts the failed runs since the
+// last successful one.
+type JobStatus struct {
+	Name        string `json:"name"`
+	Interval    string `json:"interval"`
+	Healthy     bool   `json:"healthy"`
+	Running     bool   `json:"running"`
+	Runs        int    `json:"runs"`
+	Failures    int    `json:"failures"`
+	Failing     int    `json:"failing"`
+	LastRun     int64  `json:"lastRun,omitempty"`
+	LastSuccess int64  `json:"lastSuccess,omitempty"`
+	LastError   string `json:"lastError,omitempty"`
+	DurationMs  int64  `json:"durationMs"`
+}
@@ -0,0 +1,17 @@
+package models
+
+const (
+	ExpiringSourcePantry = "pantry"
+)
+
+// ExpiringItem is a pantry item that is about to go off. Bought items are
+// stocked in the pantry, so they are reported as pantry items.
+type ExpiringItem struct {
+	ID       string  `json:"id"`
+	Source   string  `json:"source"`
+	Title    string  `json:"title"`
+	Amount   float64 `json:"amount"`
+	Unit     string  `json:"unit"`
+	Category string  `json:"category"`
+	Expires  int64   `json:"expires"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// FixtureDataset describes a dataset that can be loaded into the list.
+type FixtureDataset struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Items counts the items the dataset loads, repeats included.
+	Items int `json:"items"`
+}
+
+// FixtureReport is the outcome of loading a dataset. Deleted counts the
+// items that were on the list before when it was replaced.
+type FixtureReport struct {
+	Dataset string `json:"dataset"`
+	Deleted int    `json:"deleted"`
+	Loaded  int    `json:"loaded"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// GraphQLRequest is the body of POST /graphql.
+type GraphQLRequest struct {
+	Query         string         `json:"query" binding:"required"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// GraphQLResponse is the result of a GraphQL request. Errors in resolvers do
+// not fail the request; they are listed in Errors next to the partial data.
+type GraphQLResponse struct {
+	Data   map[string]any  `json:"data,omitempty"`
+	Errors []*GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError is an error of a GraphQL request. The extensions hold the code
+// of the matching problem and the invalid arguments, if any.
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// The statuses of health reports and their checks.
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+	// HealthStarting and HealthDraining are reported while the service
+	// starts up and while it shuts down.
+	HealthStarting = "starting"
+	HealthDraining = "draining"
+)
+
+// HealthReport is the response of the /livez, /readyz and /startupz probes.
+type HealthReport struct {
+	Status  string         `json:"status"`
+	Service string         `json:"service"`
+	Version string         `json:"version"`
+	Host    string         `json:"host"`
+	Checks  []*HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the state of one dependency, such as couchbase.kv. A
+// dependency is down once it failed FailureThreshold checks in a row and
+// degraded when it failed fewer or answered slowly.
+type HealthCheck struct {
+	Name                string  `json:"name"`
+	Status              string  `json:"status"`
+	LatencyMs           float64 `json:"latencyMs"`
+	Error               string  `json:"error,omitempty"`
+	ConsecutiveFailures int     `json:"consecutiveFailures"`
+	// Checked is when the check ran, in Unix milliseconds. Reports are cached
+	// briefly, so it may be in the past.
+	Checked int64             `json:"checked"`
+	Details map[string]string `json:"details,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// IdempotencyRecord is the stored outcome of a request with an
+// Idempotency-Key. It is pending while the first request runs and holds its
+// response afterwards.
+type IdempotencyRecord struct {
+	// Fingerprint is a hash of the method, path and body of the request, so
+	// that a key reused for another request is told apart from a retry.
+	Fingerprint string              `json:"fingerprint"`
+	Pending     bool                `json:"pending"`
+	Status      int                 `json:"status,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        []byte              `json:"body,omitempty"`
+	// Created is when the first request arrived, in Unix milliseconds.
+	Created int64 `json:"created"`
+}
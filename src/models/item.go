@@ -2,11 +2,16 @@ package models
 
 type Item struct {
 	Base
-	Title  string  `json:"title"`
-	Amount float64 `json:"amount"`
-	Unit   string  `json:"unit"`
+	Title  string  `json:"title" binding:"required,notblank,max=200"`
+	Amount float64 `json:"amount" binding:"gte=0,lte=100000"`
+	Unit   string  `json:"unit" binding:"max=16"`
 	Bought bool    `json:"bought"`
-	Shop   string  `json:"shop"`
+	Shop   string  `json:"shop" binding:"max=100"`
+
+	Category  string        `json:"category" binding:"max=50"`
+	ShelfLife int           `json:"shelfLife,omitempty" binding:"gte=0,lte=3650"`
+	Expires   int64         `json:"expires,omitempty" binding:"gte=0"`
+	Sources   []*ItemSource `json:"sources,omitempty"`
 }
 
 type ItemWithID struct {
@@ -19,3 +24,16 @@ type ItemSearchResult struct {
 	ID    string  `json:"id"`
 	Score float64 `json:"score"`
 }
+
+// ItemSource records the part of an item amount that was generated for a
+// planned meal, so it can be taken back when the meal is unplanned.
+type ItemSource struct {
+	Plan   string  `json:"plan"`
+	Meal   string  `json:"meal"`
+	Amount float64 `json:"amount"`
+}
+
+// ClearedList holds the IDs of the items deleted by clearing a list.
+type ClearedList struct {
+	IDs []string `json:"ids"`
+}
@@ -0,0 +1,25 @@
+package models
+
+// DefaultList is the list all items belong to. Items are kept in a single
+// shared list for now.
+const DefaultList = "default"
+
+// ImportReport is the outcome of importing a file into a list, line by line.
+// A dry run reports what would be imported without importing it.
+type ImportReport struct {
+	DryRun bool `json:"dryRun"`
+	// Imported counts the items that were imported, or would be in a dry
+	// run; Failed counts the lines that were not.
+	Imported int           `json:"imported"`
+	Failed   int           `json:"failed"`
+	Lines    []*ImportLine `json:"lines"`
+}
+
+// ImportLine reports one line of an import: the item read from it, which
+// has no ID in a dry run, or the error.
+type ImportLine struct {
+	Line  int         `json:"line"`
+	Text  string      `json:"text,omitempty"`
+	Item  *ItemWithID `json:"item,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
@@ -0,0 +1,27 @@
+package models
+
+type PantryItem struct {
+	Base
+	Title     string  `json:"title" binding:"required,notblank,max=200"`
+	Amount    float64 `json:"amount" binding:"gte=0,lte=100000"`
+	Unit      string  `json:"unit" binding:"max=16"`
+	Shop      string  `json:"shop" binding:"max=100"`
+	Category  string  `json:"category" binding:"max=50"`
+	Expires   int64   `json:"expires,omitempty" binding:"gte=0"`
+	Threshold float64 `json:"threshold" binding:"gte=0,lte=100000"`
+	Consumed  float64 `json:"consumed"`
+	Discarded float64 `json:"discarded"`
+	// Notified is the expiry date the last reminder was sent for, so that
+	// the item is reminded of once per expiry date.
+	Notified int64 `json:"notified,omitempty"`
+}
+
+type PantryItemWithID struct {
+	PantryItem
+	ID string `json:"id"`
+}
+
+// StockRequest is the amount to take from a pantry item. Zero takes all of it.
+type StockRequest struct {
+	Amount float64 `json:"amount" binding:"gte=0,lte=100000"`
+}
@@ -0,0 +1,14 @@
+package models
+
+type Meal struct {
+	ID       string `json:"id"`
+	Day      string `json:"day" binding:"required,datetime=2006-01-02"`
+	RecipeID string `json:"recipeId" binding:"required,notblank,max=64"`
+	Servings int    `json:"servings" binding:"gte=0,lte=1000"`
+}
+
+type Plan struct {
+	Base
+	Week  string  `json:"week"`
+	Meals []*Meal `json:"meals"`
+}
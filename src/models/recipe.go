@@ -0,0 +1,36 @@
+package models
+
+type Ingredient struct {
+	Title  string  `json:"title" binding:"required,notblank,max=200"`
+	Amount float64 `json:"amount" binding:"gte=0,lte=100000"`
+	Unit   string  `json:"unit" binding:"max=16"`
+	Shop   string  `json:"shop" binding:"max=100"`
+}
+
+type Recipe struct {
+	Base
+	Title       string        `json:"title" binding:"required,notblank,max=200"`
+	Servings    int           `json:"servings" binding:"gte=0,lte=1000"`
+	Ingredients []*Ingredient `json:"ingredients" binding:"max=200,dive,required"`
+}
+
+type RecipeWithID struct {
+	Recipe
+	ID string `json:"id"`
+}
+
+// Scale returns the recipe ingredients with amounts adjusted from the recipe
+// servings to the requested number of servings.
+func (r *Recipe) Scale(servings int) []*Ingredient {
+	factor := 1.0
+	if servings > 0 && r.Servings > 0 {
+		factor = float64(servings) / float64(r.Servings)
+	}
+	ingredients := make([]*Ingredient, 0, len(r.Ingredients))
+	for _, ingredient := range r.Ingredients {
+		scaled := *ingredient
+		scaled.Amount = ingredient.Amount * factor
+		ingredients = append(ingredients, &scaled)
+	}
+	return ingredients
+}
@@ -0,0 +1,9 @@
+package models
+
+// Shop sums up the items of a shop. Items without a shop are counted under
+// the empty name.
+type Shop struct {
+	Name   string `json:"name"`
+	Items  int    `json:"items"`
+	Bought int    `json:"bought"`
+}
@@ -0,0 +1,63 @@
+package models
+
+const (
+	EventItemAdded   = "item.added"
+	EventItemUpdated = "item.updated"
+	EventItemBought  = "item.bought"
+	EventItemDeleted = "item.deleted"
+	EventListCleared = "list.cleared"
+)
+
+// EventTypes lists the event types webhooks can subscribe to.
+var EventTypes = []string{EventItemAdded, EventItemUpdated, EventItemBought, EventItemDeleted, EventListCleared}
+
+type Webhook struct {
+	Base
+	List   string   `json:"list"`
+	URL    string   `json:"url" binding:"required,httpurl,max=2048"`
+	Events []string `json:"events" binding:"required,min=1,dive,event"`
+	Secret string   `json:"secret,omitempty" binding:"max=256"`
+}
+
+type WebhookWithID struct {
+	Webhook
+	ID string `json:"id"`
+}
+
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	List string `json:"list"`
+	Time int64  `json:"time"`
+	Data any    `json:"data"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type DeliveryAttempt struct {
+	Time       int64  `json:"time"`
+	Duration   int64  `json:"duration"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Delivery struct {
+	Base
+	Webhook     string             `json:"webhook"`
+	List        string             `json:"list"`
+	Event       *Event             `json:"event"`
+	Status      string             `json:"status"`
+	Failures    int                `json:"failures"`
+	NextAttempt int64              `json:"nextAttempt"`
+	LockedUntil int64              `json:"lockedUntil"`
+	Attempts    []*DeliveryAttempt `json:"attempts"`
+}
+
+type DeliveryWithID struct {
+	Delivery
+	ID string `json:"id"`
+}
@@ -0,0 +1,267 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Document is an OpenAPI 3.0 document. Build it with New and Add; the schemas
+// of request and response bodies are derived from the Go types.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+	// Security applies to every operation that is not Public.
+	Security []SecurityRequirement `json:"security,omitempty"`
+
+	// Rules describes custom binding rules in the schema, keyed by the rule
+	// name. The built-in rules of the validator are known already.
+	Rules map[string]func(s *Schema, param string) `json:"-"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// SecurityRequirement maps the names of security schemes to their scopes.
+type SecurityRequirement map[string][]string
+
+// PathItem holds the operations of a path keyed by lower case method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// Security is only set on Public operations, to lift the requirement of
+	// the document.
+	Security *[]SecurityRequirement `json:"security,omitempty"`
+
+	// Request and Response are values of the Go types of the bodies. Add
+	// derives the schemas from them and the client generator their types.
+	Request  any `json:"-"`
+	Response any `json:"-"`
+	// Status is the status of a successful response, 200 if zero.
+	Status int `json:"-"`
+	// ContentType of the successful response, application/json if empty.
+	ContentType string `json:"-"`
+	// Headers of the successful response.
+	Headers map[string]*Header `json:"-"`
+	// Filter lets the operation take arbitrary filter parameters besides the
+	// documented ones.
+	Filter bool `json:"-"`
+	// Public operations can be called without credentials.
+	Public bool `json:"-"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// New returns a document without operations.
+func New(title string, version string) *Document {
+	d := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:   title,
+			Version: version,
+		},
+		Paths: map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+		Rules: map[string]func(s *Schema, param string){},
+	}
+	d.SchemaOf(reflect.TypeOf(apierror.Problem{}))
+	return d
+}
+
+var pathParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// Path converts a gin route path such as /tobuy/:id to /tobuy/{id}.
+func Path(ginPath string) string {
+	return pathParam.ReplaceAllString(ginPath, "{$1}")
+}
+
+// Add documents the route registered with gin under method and path. Path
+// parameters are added to the operation, and every operation documents the
+// problem+json error response.
+func (d *Document) Add(method string, ginPath string, op *Operation) {
+	path := Path(ginPath)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+
+	var params []*Parameter
+	for _, match := range pathParam.FindAllStringSubmatch(ginPath, -1) {
+		params = append(params, &Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	op.Parameters = append(params, op.Parameters...)
+	if op.Public {
+		op.Security = &[]SecurityRequirement{}
+	}
+
+	if op.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				"application/json": {Schema: d.SchemaOf(reflect.TypeOf(op.Request))},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	contentType := op.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	success := &Response{
+		Description: http.StatusText(status),
+		Headers:     op.Headers,
+	}
+	if op.Response != nil {
+		success.Content = map[string]*MediaType{
+			contentType: {Schema: d.SchemaOf(reflect.TypeOf(op.Response))},
+		}
+	}
+	if op.Responses == nil {
+		op.Responses = map[string]*Response{}
+	}
+	op.Responses[fmt.Sprint(status)] = success
+	op.Responses["default"] = &Response{
+		Description: "Problem details of the error",
+		Content: map[string]*MediaType{
+			"application/problem+json": {Schema: &Schema{Ref: "#/components/schemas/Problem"}},
+		},
+	}
+}
+
+// Remove drops the operation of a route that is not served, such as one
+// switched off by a feature flag.
+func (d *Document) Remove(method string, ginPath string) {
+	path := Path(ginPath)
+	item, ok := d.Paths[path]
+	if !ok {
+		return
+	}
+	delete(*item, strings.ToLower(method))
+	if len(*item) == 0 {
+		delete(d.Paths, path)
+	}
+}
+
+// Operations returns the operations sorted by path and method.
+func (d *Document) Operations() (ops []*Route) {
+	for path, item := range d.Paths {
+		for method, op := range *item {
+			ops = append(ops, &Route{Method: strings.ToUpper(method), Path: path, Operation: op})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return
+}
+
+// Route is a documented operation with its method and path.
+type Route struct {
+	Method    string
+	Path      string
+	Operation *Operation
+}
+
+// Check compares the document with the routes registered with gin and
+// describes every route that is not documented and every documented route
+// that is not registered.
+func (d *Document) Check(routes gin.RoutesInfo) (problems []string) {
+	registered := map[string]bool{}
+	for _, route := range routes {
+		key := route.Method + " " + Path(route.Path)
+		registered[key] = true
+		item, ok := d.Paths[Path(route.Path)]
+		if !ok || (*item)[strings.ToLower(route.Method)] == nil {
+			problems = append(problems, key+" is not documented")
+		}
+	}
+	for _, route := range d.Operations() {
+		if key := route.Method + " " + route.Path; !registered[key] {
+			problems = append(problems, key+" is documented but not registered")
+		}
+	}
+	sort.Strings(problems)
+	return
+}
+
+// Query returns a query parameter.
+func Query(name string, schema *Schema, description string) *Parameter {
+	return &Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// Handler serves the document as JSON.
+func Handler(d *Document) gin.HandlerFunc {
+	body, err := json.Marshal(d)
+	return func(c *gin.Context) {
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.Data(http.StatusOK, "application/json", body)
+	}
+}
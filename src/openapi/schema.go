@@ -0,0 +1,203 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Schema is an OpenAPI schema object, limited to what the Go types need.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+
+	// goType is the Go type the schema was derived from.
+	goType reflect.Type
+}
+
+// GoType returns the Go type the schema was derived from, if any.
+func (s *Schema) GoType() reflect.Type {
+	return s.goType
+}
+
+const refPrefix = "#/components/schemas/"
+
+// SchemaOf returns the schema of the Go type. Named struct types are added to
+// the components and referenced. The constraints come from the binding tags,
+// so the document states the rules the handlers enforce.
+func (d *Document) SchemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string", goType: t}
+	case reflect.Bool:
+		return &Schema{Type: "boolean", goType: t}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", goType: t}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", goType: t}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", goType: t}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.SchemaOf(t.Elem()), goType: t}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.SchemaOf(t.Elem()), goType: t}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// Registered before the fields so that recursive types terminate.
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.structSchema(t)
+		}
+		return &Schema{Ref: refPrefix + t.Name(), goType: t}
+	default:
+		return &Schema{goType: t}
+	}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, goType: t}
+	d.addFields(s, t)
+	return s
+}
+
+func (d *Document) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				d.addFields(s, embedded)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.SchemaOf(field.Type)
+		if d.applyRules(property, field.Tag.Get("binding")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = property
+	}
+}
+
+// applyRules adds the constraints of the binding tag to the schema and tells
+// whether the field is required. Rules after dive apply to the items.
+func (d *Document) applyRules(s *Schema, tag string) (required bool) {
+	if tag == "" {
+		return false
+	}
+	rules, itemRules, dive := strings.Cut(tag, ",dive")
+	if dive && s.Items != nil {
+		d.applyRules(s.Items, strings.TrimPrefix(itemRules, ","))
+	}
+	// Constraints cannot sit next to a reference in OpenAPI 3.0.
+	if s.Ref != "" {
+		return strings.Contains(","+rules+",", ",required,")
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "notblank":
+			s.MinLength = intPtr(1)
+			s.Pattern = `\S`
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			d.bound(s, name == "min", n)
+		case "gte", "lte":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			d.bound(s, name == "gte", n)
+		case "gt":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			s.Minimum = &n
+			s.ExclusiveMinimum = true
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				s.Enum = append(s.Enum, value)
+			}
+		case "datetime":
+			if param == "2006-01-02" {
+				s.Format = "date"
+			}
+		case "httpurl":
+			s.Format = "uri"
+		default:
+			if custom, ok := d.Rules[name]; ok {
+				custom(s, param)
+			}
+		}
+	}
+	return
+}
+
+// bound sets the lower or upper bound that fits the type of the schema.
+func (d *Document) bound(s *Schema, lower bool, n float64) {
+	switch s.Type {
+	case "string":
+		if lower {
+			s.MinLength = intPtr(int(n))
+		} else {
+			s.MaxLength = intPtr(int(n))
+		}
+	case "array":
+		if lower {
+			s.MinItems = intPtr(int(n))
+		} else {
+			s.MaxItems = intPtr(int(n))
+		}
+	default:
+		if lower {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,131 @@
+// Package policy defines the roles of the users and the permissions they
+// grant. It is the one place that decides who may do what: the REST routes
+// are guarded by Require, and the gRPC and GraphQL handlers call Check.
+//
+// Every authenticated user has the user role unless config.Auth lists them
+// as a viewer, who may only read, or as an admin, who may do anything. While
+// authentication is disabled every caller is auth.Anonymous, a plain user.
+package policy
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/auth"
+	"github.com/shoppinglist/config"
+	"net/http"
+)
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleUser   Role = "user"
+	RoleAdmin  Role = "admin"
+)
+
+type Permission string
+
+const (
+	ReadItems     Permission = "items:read"
+	WriteItems    Permission = "items:write"
+	ReadPantry    Permission = "pantry:read"
+	WritePantry   Permission = "pantry:write"
+	ReadWebhooks  Permission = "webhooks:read"
+	WriteWebhooks Permission = "webhooks:write"
+	ReadRecipes   Permission = "recipes:read"
+	WriteRecipes  Permission = "recipes:write"
+	// ReadAdmin and WriteAdmin cover the /admin endpoints, which see and
+	// change the data of every user.
+	ReadAdmin  Permission = "admin:read"
+	WriteAdmin Permission = "admin:write"
+)
+
+// Roles are the permissions granted by each role.
+var Roles = map[Role][]Permission{
+	RoleViewer: {ReadItems, ReadPantry, ReadWebhooks, ReadRecipes},
+	RoleUser: {ReadItems, WriteItems, ReadPantry, WritePantry, ReadWebhooks, WriteWebhooks,
+		ReadRecipes, WriteRecipes},
+	RoleAdmin: {ReadItems, WriteItems, ReadPantry, WritePantry, ReadWebhooks, WriteWebhooks,
+		ReadRecipes, WriteRecipes, ReadAdmin, WriteAdmin},
+}
+
+// RoleOf returns the role of the caller. Admins and viewers are configured
+// by user ID; anonymous callers are never admins.
+func RoleOf(principal *auth.Principal) Role {
+	if principal == nil || principal == auth.Anonymous {
+		return RoleUser
+	}
+	conf := config.Get()
+	switch {
+	case contains(conf.Auth.Admins, principal.UserID):
+		return RoleAdmin
+	case contains(conf.Auth.Viewers, principal.UserID):
+		return RoleViewer
+	default:
+		return RoleUser
+	}
+}
+
+// Allows tells whether the role grants the permission.
+func (r Role) Allows(permission Permission) bool {
+	for _, granted := range Roles[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns a forbidden error unless the caller of the request has the
+// permission. Requests without a caller, as in services without
+// authentication, are anonymous.
+func Check(ctx context.Context, permission Permission) error {
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		principal = auth.Anonymous
+	}
+	if role := RoleOf(principal); !role.Allows(permission) {
+		return apierror.Forbidden("the %s role does not permit %s", role, permission)
+	}
+	return nil
+}
+
+// Require rejects the requests of callers without the permission. It must
+// follow auth.Middleware where the service authenticates.
+func Require(permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := Check(c.Request.Context(), permission); err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ReadWrite requires the read permission for GET and HEAD requests and the
+// write permission for the others, for route groups of one kind of data.
+func ReadWrite(read Permission, write Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permission := write
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			permission = read
+		}
+		if err := Check(c.Request.Context(), permission); err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// Package ratelimit protects the REST APIs from clients that send too many
+// requests. Every client has a token bucket per limit; requests over the
+// limit are rejected with 429 Too Many Requests and a Retry-After header.
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/auth"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/metrics"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// The headers describing the limit closest to being reached, as in the IETF
+// RateLimit header fields draft. Reset is in seconds.
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+	HeaderPolicy    = "RateLimit-Policy"
+)
+
+// The names of the limits, see config.RateLimit.
+const (
+	limitIP       = "ip"
+	limitDefault  = "default"
+	limitMutation = "mutation"
+	limitSearch   = "search"
+)
+
+type Limiter interface {
+	// ByIP limits the requests per client address. It goes before
+	// authentication, so that it also slows down guessing tokens.
+	ByIP() gin.HandlerFunc
+	// ByUser limits the requests per authenticated user, or per address
+	// while authentication is disabled, with the limit of the kind of
+	// request: mutations, searches or anything else. It goes after
+	// authentication.
+	ByUser() gin.HandlerFunc
+}
+
+type limiter struct {
+	store Store
+}
+
+// NewLimiter returns a Limiter keeping its buckets in the store. The limits
+// are read from the live configuration on every request.
+func NewLimiter(store Store) Limiter {
+	return &limiter{store: store}
+}
+
+func (l *limiter) ByIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l.limit(c, limitIP, "ip:"+c.ClientIP())
+	}
+}
+
+func (l *limiter) ByUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := "ip:" + c.ClientIP()
+		if principal := auth.FromContext(c.Request.Context()); principal != nil && principal != auth.Anonymous {
+			client = "user:" + principal.UserID
+		}
+		name := kind(c)
+		l.limit(c, name, name+":"+client)
+	}
+}
+
+// kind tells which limit of a user applies to the request.
+func kind(c *gin.Context) string {
+	switch {
+	case c.FullPath() == "/graphql", c.Query("q") != "":
+		return limitSearch
+	case c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && c.Request.Method != http.MethodOptions:
+		return limitMutation
+	default:
+		return limitDefault
+	}
+}
+
+// limit takes a token from the bucket of the key for the named limit, and
+// rejects the request if there was none. Requests pass when the store fails,
+// as the limits protect the service but must not take it down.
+func (l *limiter) limit(c *gin.Context, name string, key string) {
+	conf := config.Get().RateLimit
+	rate := map[string]string{
+		limitIP:       conf.IP,
+		limitDefault:  conf.Default,
+		limitMutation: conf.Mutations,
+		limitSearch:   conf.Search,
+	}[name]
+	if !conf.Enabled || rate == "" {
+		c.Next()
+		return
+	}
+	// The configuration was validated, so the rate parses.
+	requests, period, _ := config.ParseRate(rate)
+	limit := Limit{Requests: requests, Period: period}
+
+	result, err := l.store.Take(c.Request.Context(), key, limit)
+	if err != nil {
+		log.Ctx(c.Request.Context()).Warn().Err(err).Str("limit", name).Msg("Rate limit store failed, letting the request pass")
+		c.Next()
+		return
+	}
+	setHeaders(c, limit, result)
+	if !result.Allowed {
+		metrics.RateLimited(name)
+		_ = c.Error(apierror.TooManyRequests(result.RetryAfter, "too many requests, at most %s allowed", rate))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// setHeaders describes the limit unless one closer to being reached already
+// did.
+func setHeaders(c *gin.Context, limit Limit, result Result) {
+	header := c.Writer.Header()
+	if previous, err := strconv.Atoi(header.Get(HeaderRemaining)); err == nil && previous <= result.Remaining {
+		return
+	}
+	header.Set(HeaderLimit, strconv.Itoa(limit.Requests))
+	header.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+	header.Set(HeaderReset, strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+	header.Set(HeaderPolicy, fmt.Sprintf("%d;w=%d", limit.Requests, int(math.Ceil(limit.Period.Seconds()))))
+}
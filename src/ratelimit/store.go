@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Period. A client may spend them in a burst, after
+// which they come back evenly over the period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Result is the state of a bucket after a Take.
+type Result struct {
+	Allowed bool
+	// Remaining is the number of requests left right now.
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, when this
+	// one was not.
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets of the clients. The memory store serves a
+// single replica; a store the replicas share, such as one in Redis, makes the
+// limits apply to the service as a whole.
+type Store interface {
+	// Take takes a token from the bucket of the key, which holds up to
+	// limit.Requests tokens and refills them over limit.Period.
+	Take(ctx context.Context, key string, limit Limit) (result Result, err error)
+}
+
+// sweepInterval is how often the memory store forgets full buckets.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket holds all its tokens again.
+	full time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: map[string]*bucket{},
+		swept:   time.Now(),
+	}
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, limit Limit) (result Result, err error) {
+	now := time.Now()
+	capacity := float64(limit.Requests)
+	// perToken is how long one token takes to come back.
+	perToken := limit.Period / time.Duration(limit.Requests)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	// The limit may have been changed by a reload since the last request.
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.updated))/float64(perToken))
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((capacity - b.tokens) * float64(perToken))
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep forgets the buckets that are full again, which are the same as new
+// ones. The caller holds the lock.
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/events"
+	"github.com/shoppinglist/models"
+	"net/http"
+
+	"github.com/shoppinglist/log"
+)
+
+type genericHandler struct {
+	config *config.Config
+}
+
+// publish sends the event to the watchers and webhooks of the list. Failing to
+// queue it does not fail the request.
+func (h *genericHandler) publish(c *gin.Context, eventType string, data any) {
+	events.Publish(c.Request.Context(), models.DefaultList, eventType, data)
+}
+
+// err records the error for apierror.Middleware, which writes the response.
+// Database errors are mapped to the matching status, anything else is a 500.
+func (h *genericHandler) err(c *gin.Context, message string, err error) {
+	_ = c.Error(fmt.Errorf("%s: %w", message, err))
+	c.Abort()
+}
+
+func (h *genericHandler) errWithStatus(c *gin.Context, status int, message string, err error) {
+	h.err(c, message, apierror.WithStatus(status, err))
+}
+
+func (h *genericHandler) res(c *gin.Context, data any) {
+	h.resWithStatus(c, http.StatusOK, data)
+}
+
+func (h *genericHandler) resWithStatus(c *gin.Context, status int, data any) {
+	var out []byte
+	var err error
+	if s, ok := data.(string); ok {
+		out = []byte(s)
+	} else {
+		out, err = json.Marshal(data)
+		if err != nil {
+			h.err(c, "marshaling items", err)
+			return
+		}
+	}
+	c.Status(status)
+	_, err = c.Writer.Write(out)
+	if err != nil {
+		log.Ctx(c.Request.Context()).Error().Err(err).Msg("Error writing response")
+	}
+}
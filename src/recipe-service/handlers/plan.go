@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/validation"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type PlanHandler interface {
+	GetPlan(c *gin.Context)
+	AddMeal(c *gin.Context)
+	DeleteMeal(c *gin.Context)
+	GenerateList(c *gin.Context)
+}
+
+type planHandler struct {
+	genericHandler
+}
+
+func NewPlanHandler() PlanHandler {
+	return &planHandler{
+		genericHandler{
+			config: config.Get(),
+		},
+	}
+}
+
+const dayLayout = "2006-01-02"
+
+// parseWeek parses an ISO week such as "2024-W05" and returns it in that
+// form, so that 2024-W5 names the same plan, together with its Monday.
+func parseWeek(raw string) (week string, monday time.Time, err error) {
+	var year, number int
+	if _, err = fmt.Sscanf(raw, "%d-W%d", &year, &number); err != nil {
+		return "", time.Time{}, fmt.Errorf("week %q is not in the YYYY-Www format", raw)
+	}
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	monday = jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+(number-1)*7)
+	if y, w := monday.ISOWeek(); y != year || w != number {
+		return "", time.Time{}, fmt.Errorf("week %q does not exist", raw)
+	}
+	return fmt.Sprintf("%04d-W%02d", year, number), monday, nil
+}
+
+func (h *planHandler) GetPlan(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	week, _, err := parseWeek(c.Param("week"))
+	if err != nil {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", err)
+		return
+	}
+	plansDB, err := db.NewPlansDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	plan, err := plansDB.GetPlan(ctx, week)
+	if err != nil {
+		h.err(c, "getting a plan", err)
+		return
+	}
+	h.res(c, plan)
+}
+
+// AddMeal assigns a recipe to a day of the week.
+func (h *planHandler) AddMeal(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	week, monday, err := parseWeek(c.Param("week"))
+	if err != nil {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", err)
+		return
+	}
+
+	var meal models.Meal
+	if err := validation.BindJSON(c, &meal); err != nil {
+		h.err(c, "parsing meal", err)
+		return
+	}
+	// The day format was checked when binding the meal.
+	day, _ := time.Parse(dayLayout, meal.Day)
+	if day.Before(monday) || !day.Before(monday.AddDate(0, 0, 7)) {
+		h.err(c, "parsing meal", apierror.Invalid(apierror.FieldError{
+			Field:   "day",
+			Rule:    "week",
+			Message: fmt.Sprintf("must be in week %s", week),
+		}))
+		return
+	}
+
+	recipesDB, err := db.NewRecipesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	if _, err = recipesDB.GetRecipe(ctx, meal.RecipeID); err != nil {
+		h.err(c, "getting a recipe", err)
+		return
+	}
+
+	plansDB, err := db.NewPlansDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	plan, err := plansDB.GetPlan(ctx, week)
+	if err != nil {
+		h.err(c, "getting a plan", err)
+		return
+	}
+
+	meal.ID = xid.New().String()
+	plan.Meals = append(plan.Meals, &meal)
+	if err = plansDB.UpsertPlan(ctx, plan); err != nil {
+		h.err(c, "upserting a plan", err)
+		return
+	}
+	h.res(c, models.ID{ID: meal.ID})
+}
+
+// DeleteMeal unplans a meal and takes back the items generated for it.
+func (h *planHandler) DeleteMeal(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	mealID := c.Param("meal")
+	week, _, err := parseWeek(c.Param("week"))
+	if err != nil {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", err)
+		return
+	}
+
+	plansDB, err := db.NewPlansDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	plan, err := plansDB.GetPlan(ctx, week)
+	if err != nil {
+		h.err(c, "getting a plan", err)
+		return
+	}
+
+	meals := make([]*models.Meal, 0, len(plan.Meals))
+	for _, meal := range plan.Meals {
+		if meal.ID != mealID {
+			meals = append(meals, meal)
+		}
+	}
+	if len(meals) == len(plan.Meals) {
+		h.err(c, "deleting a meal", apierror.NotFound("meal %s is not planned in week %s", mealID, week))
+		return
+	}
+	plan.Meals = meals
+	// Save the plan first: if taking back the items fails, regenerating the
+	// list still goes by the meals that are left.
+	if err = plansDB.UpsertPlan(ctx, plan); err != nil {
+		h.err(c, "upserting a plan", err)
+		return
+	}
+
+	itemsDB, err := db.NewItemsDB(ctx, toBuy)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	if err = itemsDB.RemoveItemSources(ctx, week, mealID); err != nil {
+		h.err(c, "removing meal items", err)
+		return
+	}
+	h.res(c, models.ID{ID: mealID})
+}
+
+// need is the amount of one ingredient required by the planned meals.
+type need struct {
+	ingredient models.Ingredient
+	sources    []*models.ItemSource
+}
+
+// GenerateList produces the to-buy items for the week. Identical ingredients
+// are aggregated across meals, and amounts already on the to-buy list are
+// subtracted. Items generated earlier for the same week are replaced.
+func (h *planHandler) GenerateList(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	week, _, err := parseWeek(c.Param("week"))
+	if err != nil {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", err)
+		return
+	}
+
+	plansDB, err := db.NewPlansDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	plan, err := plansDB.GetPlan(ctx, week)
+	if err != nil {
+		h.err(c, "getting a plan", err)
+		return
+	}
+
+	recipesDB, err := db.NewRecipesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	var needs []*need
+	byKey := map[string]*need{}
+	for _, meal := range plan.Meals {
+		recipe, err := recipesDB.GetRecipe(ctx, meal.RecipeID)
+		if err != nil {
+			h.err(c, "getting a recipe", err)
+			return
+		}
+		for _, ingredient := range recipe.Scale(meal.Servings) {
+			key := strings.ToLower(strings.TrimSpace(ingredient.Title)) + "|" + ingredient.Unit
+			n, ok := byKey[key]
+			if !ok {
+				n = &need{ingredient: *ingredient}
+				n.ingredient.Amount = 0
+				byKey[key] = n
+				needs = append(needs, n)
+			}
+			n.ingredient.Amount += ingredient.Amount
+			n.sources = append(n.sources, &models.ItemSource{Plan: week, Meal: meal.ID, Amount: ingredient.Amount})
+		}
+	}
+
+	itemsDB, err := db.NewItemsDB(ctx, toBuy)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	if err = itemsDB.RemoveItemSources(ctx, week, ""); err != nil {
+		h.err(c, "removing generated items", err)
+		return
+	}
+
+	ids := make([]models.ID, 0, len(needs))
+	for _, n := range needs {
+		existing, err := itemsDB.FindItem(ctx, n.ingredient.Title, n.ingredient.Unit)
+		if err != nil {
+			h.err(c, "finding an item", err)
+			return
+		}
+		missing := n.ingredient.Amount
+		if existing != nil {
+			missing -= existing.Amount
+		}
+		if missing <= 0 {
+			continue
+		}
+
+		// Attribute the missing amount to the meals in proportion to their need.
+		share := missing / n.ingredient.Amount
+		for _, source := range n.sources {
+			source.Amount *= share
+		}
+		item := &models.Item{
+			Title:   n.ingredient.Title,
+			Amount:  missing,
+			Unit:    n.ingredient.Unit,
+			Shop:    n.ingredient.Shop,
+			Sources: n.sources,
+		}
+		id, err := itemsDB.MergeItem(ctx, item)
+		if err != nil {
+			h.err(c, "adding an ingredient", err)
+			return
+		}
+		h.publish(c, models.EventItemAdded, models.ItemWithID{Item: *item, ID: id})
+		ids = append(ids, models.ID{ID: id})
+	}
+	h.res(c, ids)
+}
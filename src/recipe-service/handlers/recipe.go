@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/models"
+	"github.com/shoppinglist/validation"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type RecipeHandler interface {
+	GetRecipes(c *gin.Context)
+	GetRecipe(c *gin.Context)
+	CreateRecipe(c *gin.Context)
+	UpdateRecipe(c *gin.Context)
+	DeleteRecipe(c *gin.Context)
+	AddToList(c *gin.Context)
+}
+
+// toBuy selects the items that are still waiting to be bought.
+var toBuy = sql.NullBool{
+	Bool:  false,
+	Valid: true,
+}
+
+type recipeHandler struct {
+	genericHandler
+}
+
+func NewRecipeHandler() RecipeHandler {
+	return &recipeHandler{
+		genericHandler{
+			config: config.Get(),
+		},
+	}
+}
+
+func (h *recipeHandler) GetRecipes(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	q, err := validation.Pagination(c, db.RecipeFields)
+	if err != nil {
+		h.err(c, "parsing parameters", err)
+		return
+	}
+
+	c.Header("Content-Type", "application/json")
+	recipesDB, err := db.NewRecipesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	recipesOut, total, err := recipesDB.GetRecipes(ctx, q, q.Query)
+	if err != nil {
+		h.err(c, "getting recipes", err)
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	h.res(c, recipesOut)
+}
+
+func (h *recipeHandler) GetRecipe(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	id := c.Param("id")
+	if id == "" {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+	recipesDB, err := db.NewRecipesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	recipeOut, err := recipesDB.GetRecipe(ctx, id)
+	if err != nil {
+		h.err(c, "getting a recipe", err)
+		return
+	}
+
+	h.res(c, models.RecipeWithID{Recipe: *recipeOut, ID: id})
+}
+
+func (h *recipeHandler) CreateRecipe(c *gin.Context) {
+	h.upsertRecipe(c, "")
+}
+
+func (h *recipeHandler) UpdateRecipe(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+	h.upsertRecipe(c, id)
+}
+
+func (h *recipeHandler) upsertRecipe(c *gin.Context, id string) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+
+	var recipe models.Recipe
+	if err := validation.BindJSON(c, &recipe); err != nil {
+		h.err(c, "parsing recipe", err)
+		return
+	}
+	recipe.Title = strings.TrimSpace(recipe.Title)
+	if recipe.Servings <= 0 {
+		recipe.Servings = 1
+	}
+
+	recipesDB, err := db.NewRecipesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	if id != "" {
+		existing, err := recipesDB.GetRecipe(ctx, id)
+		if err != nil {
+			h.err(c, "getting a recipe", err)
+			return
+		}
+		recipe.Created = existing.Created
+	}
+
+	id, err = recipesDB.UpsertRecipe(ctx, id, &recipe)
+	if err != nil {
+		h.err(c, "upserting a recipe", err)
+		return
+	}
+	h.res(c, models.ID{ID: id})
+}
+
+func (h *recipeHandler) DeleteRecipe(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	id := c.Param("id")
+	if id == "" {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+	recipesDB, err := db.NewRecipesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	err = recipesDB.DeleteRecipe(ctx, id)
+	if err != nil {
+		h.err(c, "deleting a recipe", err)
+		return
+	}
+	h.res(c, models.ID{ID: id})
+}
+
+type AddToListRequest struct {
+	Servings int `json:"servings" binding:"gte=0,lte=1000"`
+}
+
+// AddToList scales the recipe ingredients to the requested servings and merges
+// them into the to-buy list.
+func (h *recipeHandler) AddToList(c *gin.Context) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json")
+	id := c.Param("id")
+	if id == "" {
+		h.errWithStatus(c, http.StatusBadRequest, "bad request", fmt.Errorf("no id specified"))
+		return
+	}
+
+	var req AddToListRequest
+	if c.Request.ContentLength != 0 {
+		if err := validation.BindJSON(c, &req); err != nil {
+			h.err(c, "parsing request", err)
+			return
+		}
+	}
+
+	recipesDB, err := db.NewRecipesDB(ctx)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+	recipe, err := recipesDB.GetRecipe(ctx, id)
+	if err != nil {
+		h.err(c, "getting a recipe", err)
+		return
+	}
+
+	itemsDB, err := db.NewItemsDB(ctx, toBuy)
+	if err != nil {
+		h.err(c, "getting db", err)
+		return
+	}
+
+	ids := make([]models.ID, 0, len(recipe.Ingredients))
+	for _, ingredient := range recipe.Scale(req.Servings) {
+		item := &models.Item{
+			Title:  ingredient.Title,
+			Amount: ingredient.Amount,
+			Unit:   ingredient.Unit,
+			Shop:   ingredient.Shop,
+		}
+		itemID, err := itemsDB.MergeItem(ctx, item)
+		if err != nil {
+			h.err(c, "adding an ingredient", err)
+			return
+		}
+		h.publish(c, models.EventItemAdded, models.ItemWithID{Item: *item, ID: itemID})
+		ids = append(ids, models.ID{ID: itemID})
+	}
+	h.res(c, ids)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/auth"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/health"
+	"github.com/shoppinglist/idempotency"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/policy"
+	"github.com/shoppinglist/ratelimit"
+	"github.com/shoppinglist/recipe-service/handlers"
+	"github.com/shoppinglist/tracing"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	//zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	conf := config.MustInit(os.Args[1:])
+	if err := log.Configure(conf.Log.Level, conf.Log.Format); err != nil {
+		log.Logger().Fatal().Err(err).Msg("Logging")
+	}
+	// Apply the log settings again when the configuration is reloaded.
+	config.Subscribe(func(c *config.Config) {
+		if err := log.Configure(c.Log.Level, c.Log.Format); err != nil {
+			log.Logger().Err(err).Msg("Logging")
+		}
+	})
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go config.Watch(watchCtx)
+	log.Logger().Debug().Any("env", log.Environ()).Msg("Env")
+	log.Logger().Info().Object("config", conf).Msg("Config")
+
+	port := conf.Server.Port
+	listenAddress := "0.0.0.0:" + port
+	log.Logger().Printf("Listening at %s", listenAddress)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), conf.Tracing.Exporter, conf.Service.Name, conf.Service.Version)
+	if err != nil {
+		log.Logger().Fatal().Err(err).Msg("Tracing")
+	}
+
+	// gin.Default would add gin's own access log next to log.Middleware.
+	router := gin.New()
+	if err := router.SetTrustedProxies(conf.Server.TrustedProxies); err != nil {
+		log.Logger().Fatal().Err(err).Msg("Trusted proxies")
+	}
+	router.Use(gin.Recovery())
+	router.HandleMethodNotAllowed = true
+	router.Use(tracing.Middleware(conf.Service.Name))
+	router.Use(log.Middleware("/livez", "/readyz", "/startupz"))
+	router.Use(cors.New(cors.Config{
+		// The allowed origins are live, see config.Reload.
+		AllowOriginFunc: func(origin string) bool {
+			return config.Get().CORS.Allows(origin)
+		},
+		AllowMethods: []string{"*"},
+		AllowHeaders: []string{"*"},
+		ExposeHeaders: []string{"Content-Length", "Content-Type", "X-Total-Count", apierror.HeaderRequestID,
+			"Retry-After", ratelimit.HeaderLimit, ratelimit.HeaderRemaining, ratelimit.HeaderReset, ratelimit.HeaderPolicy, idempotency.HeaderReplayed},
+		AllowCredentials: true,
+		MaxAge:           conf.CORS.MaxAge,
+	}))
+	router.Use(apierror.Middleware())
+	router.NoRoute(apierror.NoRoute)
+	router.NoMethod(apierror.NoMethod)
+
+	probes := health.NewProbes(db.Dependencies()...)
+	router.GET("/livez", probes.Live)
+	router.GET("/startupz", probes.Startup)
+	router.GET("/readyz", probes.Ready)
+	go probes.Start(watchCtx, db.Connect)
+
+	// The limits apply to the API only, not to the probes. The API accepts
+	// the same tokens as item-service, so that the roles of policy.RoleOf
+	// apply to recipes and plans as well.
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore())
+	authenticator, err := auth.NewAuthenticator(conf.Auth.Tokens)
+	if err != nil {
+		log.Logger().Fatal().Err(err).Msg("Authentication")
+	}
+	limited := router.Group("", limiter.ByIP(), auth.Middleware(authenticator), limiter.ByUser(),
+		idempotency.Middleware(db.NewIdempotencyDB))
+
+	recipeHandler := handlers.NewRecipeHandler()
+	recipes := limited.Group("/recipes", policy.ReadWrite(policy.ReadRecipes, policy.WriteRecipes))
+	recipes.GET("", recipeHandler.GetRecipes)
+	recipes.POST("", recipeHandler.CreateRecipe)
+	recipes.GET("/:id", recipeHandler.GetRecipe)
+	recipes.PUT("/:id", recipeHandler.UpdateRecipe)
+	recipes.DELETE("/:id", recipeHandler.DeleteRecipe)
+	recipes.POST("/:id/tobuy", policy.Require(policy.WriteItems), recipeHandler.AddToList)
+
+	planHandler := handlers.NewPlanHandler()
+	plans := limited.Group("/plans", policy.ReadWrite(policy.ReadRecipes, policy.WriteRecipes))
+	plans.GET("/:week", planHandler.GetPlan)
+	plans.POST("/:week/meals", planHandler.AddMeal)
+	plans.DELETE("/:week/meals/:meal", planHandler.DeleteMeal)
+	plans.POST("/:week/tobuy", policy.Require(policy.WriteItems), planHandler.GenerateList)
+
+	srv := &http.Server{
+		Addr:    listenAddress,
+		Handler: router,
+	}
+
+	go func() {
+		// service connections
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Logger().Fatal().Err(err).Msg("listen\n")
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shut down the server with
+	// a timeout of 5 seconds.
+	quit := make(chan os.Signal, 1)
+	// kill (no param) default send syscanll.SIGTERM
+	// kill -2 is syscall.SIGINT
+	// kill -9 is syscall. SIGKILL but can"t be caught, so don't need to add it
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Logger().Info().Msg("Shutdown Server ...")
+	probes.Drain()
+	time.Sleep(conf.Server.DrainDelay)
+	stopWatching()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Logger().Fatal().Err(err).Msg("Server Shutdown")
+	}
+	if err := db.Close(ctx); err != nil {
+		log.Logger().Err(err).Msg("Closing the database connection")
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Logger().Err(err).Msg("Flushing spans")
+	}
+	// catching ctx.Done(). timeout of 5 seconds.
+	select {
+	case <-ctx.Done():
+		log.Logger().Info().Msg("timeout of 5 seconds.")
+	}
+	log.Logger().Info().Msg("Server exiting")
+}
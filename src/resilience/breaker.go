@@ -0,0 +1,160 @@
+// Package resilience keeps the services responsive while a dependency such as
+// Couchbase is slow or down: Retry repeats transient failures with jittered
+// backoff, and a Breaker fails calls fast once the dependency keeps failing.
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/metrics"
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed lets all calls through.
+	Closed State = iota
+	// HalfOpen lets one probe through after the cooldown. Its outcome closes
+	// or opens the breaker again.
+	HalfOpen
+	// Open fails all calls fast.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// ErrOpen is matched by the errors of calls an open breaker rejected.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// OpenError is returned for calls while the breaker is open.
+type OpenError struct {
+	Name  string
+	Until time.Time
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %s is open", e.Name)
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// RetryAfter is how long the caller should wait before trying again. It is
+// at least a second, as in the Retry-After header.
+func (e *OpenError) RetryAfter() time.Duration {
+	if wait := time.Until(e.Until); wait > time.Second {
+		return wait
+	}
+	return time.Second
+}
+
+// Breaker stops calls to a dependency after consecutive failures.
+type Breaker interface {
+	// Allow returns an *OpenError if the call must fail fast. Every allowed
+	// call must be followed by Done.
+	Allow() error
+	// Done records whether the allowed call found the dependency unhealthy.
+	Done(failed bool)
+	State() State
+}
+
+type breaker struct {
+	name     string
+	failures int
+	cooldown time.Duration
+
+	mu          sync.Mutex
+	state       State
+	consecutive int
+	// until is the end of the cooldown when open, and of the probe when
+	// half-open.
+	until time.Time
+}
+
+// NewBreaker returns a breaker that opens after the number of consecutive
+// failures and tries the dependency again after the cooldown. The name labels
+// its logs and metrics.
+func NewBreaker(name string, failures int, cooldown time.Duration) Breaker {
+	metrics.SetBreakerState(name, int(Closed))
+	return &breaker{
+		name:     name,
+		failures: failures,
+		cooldown: cooldown,
+	}
+}
+
+func (b *breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch b.state {
+	case Open:
+		if now.Before(b.until) {
+			break
+		}
+		b.set(HalfOpen)
+		fallthrough
+	case HalfOpen:
+		// A probe that never reported back gives way after the cooldown.
+		if now.Before(b.until) {
+			break
+		}
+		b.until = now.Add(b.cooldown)
+		return nil
+	default:
+		return nil
+	}
+	metrics.RejectedByBreaker(b.name)
+	return &OpenError{Name: b.name, Until: b.until}
+}
+
+func (b *breaker) Done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.consecutive = 0
+		if b.state != Closed {
+			b.set(Closed)
+		}
+		return
+	}
+	b.consecutive++
+	if b.state == HalfOpen || b.consecutive >= b.failures {
+		b.until = time.Now().Add(b.cooldown)
+		if b.state != Open {
+			b.set(Open)
+		}
+	}
+}
+
+func (b *breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// set changes the state. The caller holds the lock.
+func (b *breaker) set(state State) {
+	event := log.Logger().Info()
+	if state == Open {
+		event = log.Logger().Warn()
+	}
+	event.Str("breaker", b.name).Stringer("from", b.state).Stringer("to", state).
+		Int("failures", b.consecutive).Msg("Circuit breaker changed state")
+	b.state = state
+	metrics.SetBreakerState(b.name, int(state))
+}
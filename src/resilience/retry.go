@@ -0,0 +1,36 @@
+package resilience
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Retry calls fn until it succeeds, fails with an error that retryable
+// rejects, or was called attempts times. Before every further attempt it
+// waits a random delay of up to base doubled per attempt, so that the
+// retries of concurrent requests spread out. It stops waiting when the
+// context is done and returns the last error of fn.
+func Retry(ctx context.Context, attempts int, base time.Duration, retryable func(err error) bool, fn func() error) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !retryable(err) {
+			return err
+		}
+		timer := time.NewTimer(Jitter(base << (attempt - 1)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Jitter returns a random duration between zero and max.
+func Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
@@ -0,0 +1,182 @@
+// Command shopctl maintains the shopping data outside of the services.
+//
+//	shopctl backup [-out file] [-collections items,pantry] [-- settings]
+//	shopctl restore -in file [-policy skip|overwrite|newer] [-collections items] [-- settings]
+//	shopctl fixtures [-list] [-replace] dataset [-- settings]
+//
+// The database is configured like the services, from CONFIG_FILE and the
+// environment, and from the settings flags after --, such as
+// -- -database.bucket=shoppinglist. Logs go to standard error, so that
+// backups can be written to standard output with -out -. Fixtures are only
+// loaded with FIXTURES_ENABLED=true.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/shoppinglist/backup"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/fixtures"
+	"github.com/shoppinglist/log"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"backup":   runBackup,
+	"restore":  runRestore,
+	"fixtures": runFixtures,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: shopctl backup|restore|fixtures [flags] [-- settings]\nRun shopctl <command> -h for the flags.")
+		os.Exit(2)
+	}
+	args, settings := os.Args[2:], []string(nil)
+	for i, arg := range args {
+		if arg == "--" {
+			args, settings = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	conf := config.MustInit(settings)
+	if err := log.ConfigureOutput(conf.Log.Level, conf.Log.Format, os.Stderr); err != nil {
+		log.Logger().Fatal().Err(err).Msg("Logging")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := commands[os.Args[1]](ctx, args)
+	if closeErr := db.Close(context.Background()); err == nil {
+		err = closeErr
+	}
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Logger().Error().Err(err).Msg(os.Args[1] + " failed")
+		os.Exit(1)
+	}
+}
+
+func runBackup(ctx context.Context, args []string) (err error) {
+	flags := flag.NewFlagSet("shopctl backup", flag.ContinueOnError)
+	out := flags.String("out", "", "archive `file` to write, - for standard output (default shoppinglist-<time>.ndjson.gz)")
+	collections := flags.String("collections", "", "comma-separated collections to back up (default "+strings.Join(db.DataCollections, ",")+")")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = "shoppinglist-" + time.Now().UTC().Format("20060102T150405Z") + ".ndjson.gz"
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			// A partial archive must not pass for a backup.
+			if err != nil {
+				_ = os.Remove(*out)
+			}
+		}()
+		w = file
+	}
+	counts, err := backup.Backup(ctx, w, list(*collections))
+	if err != nil {
+		return err
+	}
+	log.Logger().Info().Str("archive", *out).Any("documents", counts).Msg("Backup written")
+	return nil
+}
+
+func runRestore(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("shopctl restore", flag.ContinueOnError)
+	in := flags.String("in", "", "archive `file` to read, - for standard input")
+	policy := flags.String("policy", string(backup.Skip), "what to do with documents that exist: skip, overwrite, or newer to keep the later updated one")
+	collections := flags.String("collections", "", "comma-separated collections to restore (default all in the archive)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		flags.Usage()
+		return fmt.Errorf("-in is required")
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	manifest, results, err := backup.Restore(ctx, r, backup.Options{
+		Policy:      backup.Policy(*policy),
+		Collections: list(*collections),
+	})
+	event := log.Logger().Info()
+	if err != nil {
+		event = log.Logger().Warn()
+	}
+	if manifest != nil {
+		event = event.Int64("created", manifest.Created).Str("service", manifest.Service)
+	}
+	event.Str("archive", *in).Any("results", results).Msg("Restored")
+	return err
+}
+
+func runFixtures(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("shopctl fixtures", flag.ContinueOnError)
+	listOnly := flags.Bool("list", false, "list the datasets instead of loading one")
+	replace := flags.Bool("replace", false, "delete the items on the list first")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: shopctl fixtures [-list] [-replace] dataset [-- settings]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *listOnly {
+		datasets, err := fixtures.List()
+		if err != nil {
+			return err
+		}
+		for _, dataset := range datasets {
+			fmt.Printf("%s\t%d items\t%s\n", dataset.Name, dataset.Items, dataset.Description)
+		}
+		return nil
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("one dataset is required")
+	}
+	// Load logs what it loaded.
+	_, err := fixtures.Load(ctx, flags.Arg(0), *replace)
+	return err
+}
+
+// list splits a comma-separated flag.
+func list(s string) (values []string) {
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,83 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are propagated with the
+// W3C traceparent header and exported as configured by OTEL_TRACES_EXPORTER.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The exporters Setup accepts.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+const instrumentationName = "github.com/shoppinglist"
+
+// Setup installs the tracer provider of the service. The OTLP exporter is
+// configured with the standard OTEL_EXPORTER_OTLP_* variables and the sampler
+// with OTEL_TRACES_SAMPLER. With ExporterNone spans are not recorded, but
+// incoming trace IDs are still passed on. Call shutdown to flush the spans
+// before exiting.
+func Setup(ctx context.Context, exporter string, service string, version string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case ExporterOTLP:
+		spanExporter, err = otlptracegrpc.New(ctx)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New()
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q, expected %s, %s or %s", exporter, ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(service),
+			semconv.ServiceVersion(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span for every request, named by its route, as
+// the child of the span in the traceparent header if there is one.
+func Middleware(service string) gin.HandlerFunc {
+	return otelgin.Middleware(service)
+}
+
+// Start starts a span as the child of the span in the context.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends the span and marks it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -7,20 +7,30 @@ import (
 	"github.com/couchbase/gocb/v2"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/rs/zerolog"
+	"github.com/shoppinglist/config"
 	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/metrics"
 	"net/http"
 	"os"
 	"os/signal"
 	"time"
 )
 
-var serviceName string
-var port = "80"
-
 func main() {
-	serviceName = os.Getenv("SERVICE_NAME")
+	conf := config.MustInit(os.Args[1:])
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	log.Logger().Info().Any("env", os.Environ()).Msgf("Env")
+	if err := log.Configure(conf.Log.Level, conf.Log.Format); err != nil {
+		log.Logger().Fatal().Err(err).Msg("Logging")
+	}
+	// Apply the log settings again when the configuration is reloaded.
+	config.Subscribe(func(c *config.Config) {
+		if err := log.Configure(c.Log.Level, c.Log.Format); err != nil {
+			log.Logger().Err(err).Msg("Logging")
+		}
+	})
+	go config.Watch(context.Background())
+	log.Logger().Debug().Any("env", log.Environ()).Msg("Env")
+	log.Logger().Info().Object("config", conf).Msg("Config")
 
 	c := func() {
 		// Uncomment following line to enable logging
@@ -28,13 +38,14 @@ func main() {
 
 		// Update this to your cluster details
 		// For a secure cluster connection, use `couchbases://<your-cluster-ip>` instead.
-		connectionString := os.Getenv("COUCHBASE_CONNECTION_STRING")
+		connectionString := conf.Database.ConnectionString
 		//connectionString := "couchbase://127.0.0.1?network=external"
 		//connectionString := "127.0.0.1?network=external"
-		bucketName := os.Getenv("COUCHBASE_BUCKET")
-		username := os.Getenv("COUCHBASE_USERNAME")
-		password := os.Getenv("COUCHBASE_PASSWORD")
-		fmt.Print(connectionString, bucketName, username, password)
+		bucketName := conf.Database.Bucket
+		username := conf.Database.Username
+		password := conf.Database.Password
+		log.Logger().Info().Str("connectionString", log.Redact("connectionString", connectionString)).
+			Str("bucket", bucketName).Str("username", username).Msg("Connecting to Couchbase")
 
 		cluster, err := gocb.Connect(connectionString, gocb.ClusterOptions{
 			Authenticator: gocb.PasswordAuthenticator{
@@ -43,15 +54,15 @@ func main() {
 			},
 		})
 		if err != nil {
-			log.Logger().Err(err)
+			log.Logger().Err(err).Msg("Connecting failed")
 			return
 		}
 
 		bucket := cluster.Bucket(bucketName)
 
-		err = bucket.WaitUntilReady(5*time.Second, nil)
+		err = bucket.WaitUntilReady(conf.Database.ConnectTimeout, nil)
 		if err != nil {
-			log.Logger().Err(err)
+			log.Logger().Err(err).Msg("Waiting for the bucket failed")
 			return
 
 		}
@@ -76,7 +87,7 @@ func main() {
 				Interests: []string{"Swimming", "Rowing"},
 			}, nil)
 		if err != nil {
-			log.Logger().Err(err)
+			log.Logger().Err(err).Msg("Upserting a document failed")
 			return
 
 		}
@@ -84,7 +95,7 @@ func main() {
 		// Get the document back
 		getResult, err := col.Get("u:jade", nil)
 		if err != nil {
-			log.Logger().Err(err)
+			log.Logger().Err(err).Msg("Getting a document failed")
 			return
 
 		}
@@ -92,7 +103,7 @@ func main() {
 		var inUser User
 		err = getResult.Content(&inUser)
 		if err != nil {
-			log.Logger().Err(err)
+			log.Logger().Err(err).Msg("Decoding a document failed")
 			return
 
 		}
@@ -131,17 +142,17 @@ func main() {
 	_ = c
 	c()
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		log.Logger().Info().Msgf("HTTP %s %s%s\n", r.Method, r.Host, r.URL)
-		// ctx := r.Context()
+	http.Handle("/metrics", metrics.HTTPHandler())
+	http.Handle("/", metrics.Instrument(log.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 
 		if r.URL.Path == "/healthz" && r.Method == "GET" {
 			w.Header().Set("Content-Type", "text/plain")
-			t := fmt.Sprintf("%s: %s\n", serviceName, time.Now().Local().Format(time.RFC1123Z))
-			log.Logger().Printf("response %s\n", t)
+			t := fmt.Sprintf("%s: %s\n", conf.Service.Name, time.Now().Local().Format(time.RFC1123Z))
+			log.Ctx(ctx).Printf("response %s\n", t)
 			_, err := w.Write([]byte(t + "\n"))
 			if err != nil {
-				log.Logger().Err(err).Msg("Error writing response")
+				log.Ctx(ctx).Err(err).Msg("Error writing response")
 				http.Error(w, "Server Error", http.StatusInternalServerError)
 				return
 			}
@@ -149,9 +160,9 @@ func main() {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
-	})
+	}), "/healthz"), "/healthz"))
 
-	listenAddress := fmt.Sprintf(":%s", port)
+	listenAddress := fmt.Sprintf(":%s", conf.Server.Port)
 	log.Logger().Info().Msgf("Listening at %s", listenAddress)
 
 	httpServer := http.Server{
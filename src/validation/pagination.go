@@ -0,0 +1,198 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/db"
+	"strings"
+)
+
+// MaxPageSize is the largest number of entries returned per page. GraphQL
+// queries without an end get a page of this size; REST requests have to send
+// _end, so that clients that used to get every entry notice the limit.
+const MaxPageSize = 100
+
+// PaginationQuery holds the list parameters sent by react-admin.
+type PaginationQuery struct {
+	Start int    `form:"_start" binding:"gte=0"`
+	End   int    `form:"_end" binding:"gte=0"`
+	Sort  string `form:"_sort" binding:"max=64"`
+	Order string `form:"_order" binding:"omitempty,oneof=ASC DESC asc desc"`
+	Query string `form:"q" binding:"max=200"`
+}
+
+// Pagination binds the list parameters of the request and validates them.
+// Only the given fields, the indexed ones of the collection, can be sorted by.
+func Pagination(c *gin.Context, sortable []string) (*db.PaginationQuery, error) {
+	var p PaginationQuery
+	_, hasEnd := c.GetQuery("_end")
+	return p.query(BindQuery(c, &p), sortable, !hasEnd)
+}
+
+// Range validates list parameters that did not come from a query string, such
+// as the arguments of a GraphQL field.
+func Range(p *PaginationQuery, sortable []string) (*db.PaginationQuery, error) {
+	return p.query(Struct(p), sortable, false)
+}
+
+// query checks the parameters along with the error of binding them. If
+// missingEnd is set, the end was required but not given.
+func (p *PaginationQuery) query(err error, sortable []string, missingEnd bool) (*db.PaginationQuery, error) {
+	var fields []apierror.FieldError
+	if err != nil {
+		// Report the rule violations together with the checks below.
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) || apiErr.Fields == nil {
+			return nil, err
+		}
+		fields = apiErr.Fields
+	}
+
+	if p.Sort != "" && !contains(sortable, p.Sort) {
+		fields = append(fields, apierror.FieldError{
+			Field:   "_sort",
+			Rule:    "oneof",
+			Message: fmt.Sprintf("must be one of %s", strings.Join(sortable, ", ")),
+		})
+	}
+	if p.End == 0 {
+		p.End = p.Start + MaxPageSize
+	}
+	switch {
+	case missingEnd:
+		fields = append(fields, apierror.FieldError{
+			Field:   "_end",
+			Rule:    "required",
+			Message: fmt.Sprintf("is required, at most %d entries after _start", MaxPageSize),
+		})
+	case p.End < p.Start:
+		fields = append(fields, apierror.FieldError{
+			Field:   "_end",
+			Rule:    "gtefield",
+			Message: "must not be less than _start",
+		})
+	case p.End-p.Start > MaxPageSize:
+		fields = append(fields, apierror.FieldError{
+			Field:   "_end",
+			Rule:    "max",
+			Message: fmt.Sprintf("must be at most %d entries after _start", MaxPageSize),
+		})
+	}
+	if len(fields) > 0 {
+		return nil, apierror.Invalid(fields...)
+	}
+
+	return &db.PaginationQuery{
+		Start: p.Start,
+		End:   p.End,
+		Sort:  p.Sort,
+		Order: strings.ToUpper(p.Order),
+		Query: p.Query,
+	}, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CursorQuery holds the parameters of cursor pagination. The sort, order and
+// search are taken from the cursor after the first page; sending different
+// ones along with a cursor is an error.
+type CursorQuery struct {
+	Cursor       string `form:"cursor" binding:"max=1024"`
+	Limit        int    `form:"limit" binding:"gte=0,lte=100"`
+	IncludeTotal bool   `form:"include_total"`
+	Sort         string `form:"_sort" binding:"max=64"`
+	Order        string `form:"_order" binding:"omitempty,oneof=ASC DESC asc desc"`
+	Query        string `form:"q" binding:"max=200"`
+}
+
+// IsCursorRequest tells whether the request asks for cursor pagination rather
+// than the _start and _end range.
+func IsCursorRequest(c *gin.Context) bool {
+	_, cursor := c.GetQuery("cursor")
+	_, limit := c.GetQuery("limit")
+	return cursor || limit
+}
+
+// CursorPagination binds the cursor pagination parameters of the request and
+// validates them. Only the given fields can be sorted by.
+func CursorPagination(c *gin.Context, sortable []string) (*db.CursorQuery, error) {
+	var p CursorQuery
+	return p.query(BindQuery(c, &p), sortable)
+}
+
+// Cursor validates cursor pagination parameters that did not come from a
+// query string, such as those of a gRPC request.
+func Cursor(p *CursorQuery, sortable []string) (*db.CursorQuery, error) {
+	return p.query(Struct(p), sortable)
+}
+
+// query checks the parameters along with the error of binding them.
+func (p *CursorQuery) query(err error, sortable []string) (*db.CursorQuery, error) {
+	var fields []apierror.FieldError
+	if err != nil {
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) || apiErr.Fields == nil {
+			return nil, err
+		}
+		fields = apiErr.Fields
+	}
+
+	q := &db.CursorQuery{
+		Sort:         p.Sort,
+		Order:        strings.ToUpper(p.Order),
+		Query:        p.Query,
+		Limit:        p.Limit,
+		IncludeTotal: p.IncludeTotal,
+	}
+	if q.Limit == 0 {
+		q.Limit = MaxPageSize
+	}
+	if p.Cursor != "" {
+		after, err := db.ParseCursor(p.Cursor)
+		if err != nil {
+			fields = append(fields, apierror.FieldError{
+				Field:   "cursor",
+				Rule:    "cursor",
+				Message: "is not a cursor returned by this listing",
+			})
+		} else {
+			if (p.Sort != "" && p.Sort != after.Sort) ||
+				(p.Order != "" && order(p.Order) != order(after.Order)) ||
+				(p.Query != "" && p.Query != after.Query) {
+				fields = append(fields, apierror.FieldError{
+					Field:   "cursor",
+					Rule:    "cursor",
+					Message: "was issued for a different _sort, _order or q",
+				})
+			}
+			q.Sort, q.Order, q.Query, q.After = after.Sort, after.Order, after.Query, after
+		}
+	}
+	if q.Sort != "" && !contains(sortable, q.Sort) {
+		fields = append(fields, apierror.FieldError{
+			Field:   "_sort",
+			Rule:    "oneof",
+			Message: fmt.Sprintf("must be one of %s", strings.Join(sortable, ", ")),
+		})
+	}
+	if len(fields) > 0 {
+		return nil, apierror.Invalid(fields...)
+	}
+	return q, nil
+}
+
+func order(o string) string {
+	if o == "" {
+		return "ASC"
+	}
+	return strings.ToUpper(o)
+}
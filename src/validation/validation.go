@@ -0,0 +1,169 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/shoppinglist/apierror"
+	"github.com/shoppinglist/models"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The rules are declared with binding tags on the request and model structs.
+// Besides the built-in rules of the validator, these are available:
+//
+//	notblank  the string contains more than white space
+//	httpurl   the string is an absolute http or https URL
+//	event     the string is one of models.EventTypes
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		panic("validation: gin does not use the go-playground validator")
+	}
+	v.RegisterTagNameFunc(fieldName)
+	mustRegister(v, "notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	mustRegister(v, "httpurl", func(fl validator.FieldLevel) bool {
+		u, err := url.Parse(fl.Field().String())
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	})
+	mustRegister(v, "event", func(fl validator.FieldLevel) bool {
+		for _, eventType := range models.EventTypes {
+			if fl.Field().String() == eventType {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func mustRegister(v *validator.Validate, tag string, fn validator.Func) {
+	if err := v.RegisterValidation(tag, fn); err != nil {
+		panic(err)
+	}
+}
+
+// fieldName reports fields by the name the client uses for them.
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// BindJSON decodes and validates the request body.
+func BindJSON(c *gin.Context, obj any) error {
+	return Error(c.ShouldBindJSON(obj))
+}
+
+// BindQuery decodes and validates the query parameters.
+func BindQuery(c *gin.Context, obj any) error {
+	return Error(c.ShouldBindQuery(obj))
+}
+
+// Struct validates a value that did not come through gin binding.
+func Struct(obj any) error {
+	return Error(binding.Validator.ValidateStruct(obj))
+}
+
+// Error turns binding and validation errors into an apierror.Error with the
+// offending fields. Other errors are reported as bad requests.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	var typeError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+	var numError *strconv.NumError
+	switch {
+	case errors.As(err, &validationErrors):
+		fields := make([]apierror.FieldError, 0, len(validationErrors))
+		for _, fe := range validationErrors {
+			fields = append(fields, apierror.FieldError{
+				Field:   path(fe.Namespace()),
+				Rule:    fe.Tag(),
+				Message: message(fe),
+			})
+		}
+		return apierror.Invalid(fields...)
+	case errors.As(err, &typeError):
+		return apierror.Invalid(apierror.FieldError{
+			Field:   typeError.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("must be of type %s", typeError.Type),
+		})
+	case errors.As(err, &syntaxError), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return apierror.BadRequest("request body is not valid JSON")
+	case errors.As(err, &numError):
+		return apierror.BadRequest("%q is not a valid number", numError.Num)
+	default:
+		return apierror.BadRequest("%s", err.Error())
+	}
+}
+
+// path drops the struct name the validator puts in front of the field path.
+func path(namespace string) string {
+	_, field, ok := strings.Cut(namespace, ".")
+	if !ok {
+		return namespace
+	}
+	return field
+}
+
+func message(fe validator.FieldError) string {
+	unit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Map:
+		unit = " entries"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "notblank":
+		return "must not be blank"
+	case "min":
+		if unit == "" {
+			return fmt.Sprintf("must be at least %s", fe.Param())
+		}
+		return fmt.Sprintf("must have at least %s%s", fe.Param(), unit)
+	case "max":
+		if unit == "" {
+			return fmt.Sprintf("must be at most %s", fe.Param())
+		}
+		return fmt.Sprintf("must have at most %s%s", fe.Param(), unit)
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(fe.Param()), ", "))
+	case "datetime":
+		return fmt.Sprintf("must be a date in the %s format", strings.NewReplacer("2006", "YYYY", "01", "MM", "02", "DD").Replace(fe.Param()))
+	case "httpurl":
+		return "must be an absolute http or https URL"
+	case "event":
+		return fmt.Sprintf("must be one of %s", strings.Join(models.EventTypes, ", "))
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a webhook URL leads to an address the
+// dispatcher may not connect to.
+var ErrForbiddenAddress = errors.New("forbidden webhook address")
+
+// NewClient returns the client the dispatcher sends deliveries with. Anyone
+// who may write webhooks chooses where the requests go, so the client refuses
+// to connect to loopback, link-local, private and other internal addresses
+// unless they are in one of the allowed CIDR ranges. The address is checked
+// when the connection is made, after the host name is resolved and for every
+// redirect, so that neither DNS nor redirects lead around the check.
+func NewClient(timeout time.Duration, allowed []string) (*http.Client, error) {
+	networks := make([]*net.IPNet, 0, len(allowed))
+	for _, cidr := range allowed {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("allowed webhook network: %w", err)
+		}
+		networks = append(networks, network)
+	}
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			return checkAddress(address, networks)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the receiver.
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// checkAddress returns ErrForbiddenAddress for the resolved address host:port
+// unless it is public or in one of the allowed networks.
+func checkAddress(address string, allowed []*net.IPNet) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s is not an IP address", ErrForbiddenAddress, host)
+	}
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s is internal", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	client, err := NewClient(time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Post(receiver.URL, "application/json", nil); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("loopback receiver: got %v, want %v", err, ErrForbiddenAddress)
+	}
+
+	client, err = NewClient(time.Second, []string{"127.0.0.0/8", "::1/128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Post(receiver.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("allowed receiver: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("allowed receiver: got %d, want 204", res.StatusCode)
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	for address, forbidden := range map[string]bool{
+		"127.0.0.1:80":         true,
+		"[::1]:443":            true,
+		"10.1.2.3:80":          true,
+		"192.168.0.10:8080":    true,
+		"169.254.169.254:80":   true,
+		"[fe80::1]:80":         true,
+		"0.0.0.0:80":           true,
+		"[::ffff:10.0.0.1]:80": true,
+		"93.184.216.34:443":    false,
+		"[2606:4700::1]:443":   false,
+	} {
+		err := checkAddress(address, nil)
+		if got := errors.Is(err, ErrForbiddenAddress); got != forbidden {
+			t.Errorf("%s: got %v, forbidden %v", address, err, forbidden)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/couchbase/gocb/v2"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/jobs"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+type Options struct {
+	// Client sends the deliveries. It defaults to NewClient without allowed
+	// networks. Point it at an httptest server in tests.
+	Client *http.Client
+	// Interval is how often the queue is polled for due deliveries.
+	Interval time.Duration
+	// MaxAttempts is how often a delivery is tried before it is dead-lettered.
+	MaxAttempts int
+	// BaseBackoff is the delay after the first failed attempt. It doubles with
+	// every further attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// BatchSize is the number of deliveries claimed per poll.
+	BatchSize int
+	// WebhooksDB and DeliveriesDB default to those of the configured
+	// backend. Tests give the dispatcher stores of their own.
+	WebhooksDB   db.WebhooksDB
+	DeliveriesDB db.DeliveriesDB
+}
+
+func (o *Options) withDefaults() Options {
+	opts := *o
+	if opts.Client == nil {
+		// Without allowed networks the client cannot fail.
+		opts.Client, _ = NewClient(10*time.Second, nil)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = 10 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 20
+	}
+	return opts
+}
+
+// Dispatcher sends queued deliveries to the webhooks.
+type Dispatcher interface {
+	// Run dispatches due deliveries every interval until the context is
+	// cancelled. The runs are reported as the webhooks job, see jobs.Status.
+	Run(ctx context.Context)
+	// Dispatch sends the deliveries that are due now and returns how many
+	// were attempted.
+	Dispatch(ctx context.Context) (attempted int, err error)
+}
+
+type dispatcher struct {
+	opts Options
+}
+
+func NewDispatcher(opts Options) Dispatcher {
+	return &dispatcher{
+		opts: opts.withDefaults(),
+	}
+}
+
+func (d *dispatcher) Run(ctx context.Context) {
+	jobs.Run(ctx, "webhooks", d.opts.Interval, func(ctx context.Context) error {
+		if _, err := d.Dispatch(ctx); err != nil {
+			return fmt.Errorf("dispatching webhook deliveries: %w", err)
+		}
+		return nil
+	})
+}
+
+func (d *dispatcher) Dispatch(ctx context.Context) (attempted int, err error) {
+	deliveriesDB, webhooksDB := d.opts.DeliveriesDB, d.opts.WebhooksDB
+	if deliveriesDB == nil {
+		if deliveriesDB, err = db.NewDeliveriesDB(ctx); err != nil {
+			return 0, err
+		}
+	}
+	if webhooksDB == nil {
+		if webhooksDB, err = db.NewWebhooksDB(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	// The lease covers one attempt per claimed delivery.
+	lease := time.Duration(d.opts.BatchSize) * (d.opts.Client.Timeout + time.Second)
+	deliveries, err := deliveriesDB.ClaimDueDeliveries(ctx, time.Now(), lease, d.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		webhook, err := webhooksDB.GetWebhook(ctx, delivery.Webhook)
+		switch {
+		case errors.Is(err, gocb.ErrDocumentNotFound):
+			delivery.Attempts = append(delivery.Attempts, &models.DeliveryAttempt{
+				Time:  time.Now().UTC().UnixMilli(),
+				Error: "webhook was deleted",
+			})
+			delivery.Status = models.DeliveryDead
+		case err != nil:
+			return attempted, err
+		default:
+			attempt := Send(ctx, d.opts.Client, webhook, delivery.ID, delivery.Event)
+			d.record(ctx, &delivery.Delivery, attempt)
+		}
+		attempted++
+
+		delivery.LockedUntil = 0
+		if _, err = deliveriesDB.UpsertDelivery(ctx, delivery.ID, &delivery.Delivery); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// record adds the attempt to the delivery and schedules the next one.
+func (d *dispatcher) record(ctx context.Context, delivery *models.Delivery, attempt *models.DeliveryAttempt) {
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	if attempt.Error == "" {
+		delivery.Status = models.DeliveryDelivered
+		return
+	}
+	delivery.Failures++
+	if delivery.Failures >= d.opts.MaxAttempts {
+		delivery.Status = models.DeliveryDead
+		log.Ctx(ctx).Warn().Msgf("Webhook delivery dead after %d attempts: %s", delivery.Failures, attempt.Error)
+		return
+	}
+	delay := Backoff(delivery.Failures, d.opts.BaseBackoff, d.opts.MaxBackoff)
+	delivery.NextAttempt = time.Now().Add(delay).UTC().UnixMilli()
+}
+
+// Backoff returns the delay before the next attempt after the given number of
+// failed attempts: base doubled per attempt, capped at max, with up to 20%
+// random jitter so that retries of a failing receiver spread out.
+func Backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// Send posts the signed event to the webhook and reports the attempt. Any
+// response outside 2xx counts as a failure.
+func Send(ctx context.Context, client *http.Client, webhook *models.Webhook, deliveryID string, event *models.Event) *models.DeliveryAttempt {
+	start := time.Now()
+	attempt := &models.DeliveryAttempt{
+		Time: start.UTC().UnixMilli(),
+	}
+	defer func() {
+		attempt.Duration = time.Since(start).Milliseconds()
+	}()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(timestamp))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	res, err := client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("receiver responded with %s", res.Status)
+	}
+	return attempt
+}
@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"context"
+	"github.com/rs/xid"
+	"github.com/shoppinglist/config"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	config.MustInit([]string{"-database.backend=memory"})
+	os.Exit(m.Run())
+}
+
+// receiver records the deliveries it gets and answers them with status.
+type receiver struct {
+	*httptest.Server
+	secret string
+	status int
+
+	mu       sync.Mutex
+	received []*http.Request
+	verified []bool
+}
+
+func newReceiver(t *testing.T, secret string, status int) *receiver {
+	r := &receiver{secret: secret, status: status}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+		r.mu.Lock()
+		r.received = append(r.received, req)
+		r.verified = append(r.verified, Verify(r.secret, timestamp, body, req.Header.Get(HeaderSignature)))
+		r.mu.Unlock()
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+// stores are the webhooks and deliveries of a test, kept apart from those
+// of the other tests.
+type stores struct {
+	webhooks   db.WebhooksDB
+	deliveries db.DeliveriesDB
+}
+
+func newStores() *stores {
+	return &stores{webhooks: db.NewPrivateMemoryWebhooksDB(), deliveries: db.NewPrivateMemoryDeliveriesDB()}
+}
+
+// dispatcher returns a dispatcher of the stores.
+func (s *stores) dispatcher(opts Options) Dispatcher {
+	opts.WebhooksDB, opts.DeliveriesDB = s.webhooks, s.deliveries
+	return NewDispatcher(opts)
+}
+
+// queue registers a webhook for the receiver on a list of its own and
+// queues an event for it. It returns the ID of the delivery.
+func (s *stores) queue(t *testing.T, r *receiver) string {
+	ctx := context.Background()
+	list := t.Name() + ":" + xid.New().String()
+	id, err := s.webhooks.UpsertWebhook(ctx, "", &models.Webhook{
+		List:   list,
+		URL:    r.URL + "/hook",
+		Events: []string{models.EventItemBought},
+		Secret: r.secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &models.Event{ID: "e1", Type: models.EventItemBought, List: list, Time: time.Now().UnixMilli()}
+	webhooks, err := s.webhooks.GetSubscribedWebhooks(ctx, list, event.Type)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = queue(ctx, s.deliveries, webhooks, event); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, _, err := s.deliveries.GetDeliveries(ctx, &db.PaginationQuery{}, &db.DeliveryFilter{Webhook: id})
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("queued deliveries: %v, %v", deliveries, err)
+	}
+	return deliveries[0].ID
+}
+
+func (s *stores) delivery(t *testing.T, id string) *models.Delivery {
+	delivery, err := s.deliveries.GetDelivery(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func TestDispatchSigns(t *testing.T) {
+	r := newReceiver(t, "s3cret", http.StatusNoContent)
+	s := newStores()
+	id := s.queue(t, r)
+	d := s.dispatcher(Options{Client: r.Client()})
+
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r.calls() != 1 {
+		t.Fatalf("receiver got %d calls, want 1", r.calls())
+	}
+	req := r.received[0]
+	if !r.verified[0] {
+		t.Errorf("signature %q does not verify", req.Header.Get(HeaderSignature))
+	}
+	if got := req.Header.Get(HeaderEvent); got != models.EventItemBought {
+		t.Errorf("%s is %q", HeaderEvent, got)
+	}
+	if got := req.Header.Get(HeaderDelivery); got != id {
+		t.Errorf("%s is %q, want %q", HeaderDelivery, got, id)
+	}
+	if got := s.delivery(t, id); got.Status != models.DeliveryDelivered || len(got.Attempts) != 1 {
+		t.Errorf("delivery is %s after %d attempts, want delivered after 1", got.Status, len(got.Attempts))
+	}
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	r := newReceiver(t, "s3cret", http.StatusInternalServerError)
+	s := newStores()
+	id := s.queue(t, r)
+	base := 50 * time.Millisecond
+	d := s.dispatcher(Options{Client: r.Client(), MaxAttempts: 5, BaseBackoff: base, MaxBackoff: time.Second})
+	ctx := context.Background()
+
+	for failures := 1; failures <= 3; failures++ {
+		before := time.Now().Truncate(time.Millisecond)
+		if _, err := d.Dispatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+		after := time.Now()
+		got := s.delivery(t, id)
+		if got.Status != models.DeliveryPending || got.Failures != failures {
+			t.Fatalf("after attempt %d: %s with %d failures", failures, got.Status, got.Failures)
+		}
+		// The delay doubles with every failure and has up to 20% jitter.
+		next := time.UnixMilli(got.NextAttempt)
+		want := base << (failures - 1)
+		if next.Before(before.Add(want)) || next.After(after.Add(want*6/5)) {
+			t.Errorf("after attempt %d: next attempt in %s, want %s plus jitter", failures, next.Sub(before), want)
+		}
+
+		// Nothing is sent before the delivery is due again.
+		if _, err := d.Dispatch(ctx); err != nil || r.calls() != failures {
+			t.Errorf("after attempt %d: sent early, %v", failures, err)
+		}
+		time.Sleep(time.Until(time.UnixMilli(got.NextAttempt)) + 5*time.Millisecond)
+	}
+	if r.calls() != 3 {
+		t.Errorf("receiver got %d calls, want 3", r.calls())
+	}
+}
+
+func TestDispatchDeadLetters(t *testing.T) {
+	r := newReceiver(t, "s3cret", http.StatusBadGateway)
+	s := newStores()
+	id := s.queue(t, r)
+	d := s.dispatcher(Options{Client: r.Client(), MaxAttempts: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if _, err := d.Dispatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := s.delivery(t, id)
+	if got.Status != models.DeliveryDead || got.Failures != 2 || len(got.Attempts) != 2 {
+		t.Errorf("delivery is %s after %d failures and %d attempts, want dead after 2", got.Status, got.Failures, len(got.Attempts))
+	}
+	if r.calls() != 2 {
+		t.Errorf("receiver got %d calls, want 2", r.calls())
+	}
+	dead, _, err := s.deliveries.GetDeliveries(ctx, &db.PaginationQuery{}, &db.DeliveryFilter{List: got.List, Status: models.DeliveryDead})
+	if err != nil || len(dead) != 1 || dead[0].ID != id {
+		t.Errorf("dead deliveries: %v, %v", dead, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 10*time.Second, time.Minute
+	for attempts, want := range map[int]time.Duration{1: base, 2: 2 * base, 3: 4 * base, 4: max, 10: max} {
+		for i := 0; i < 20; i++ {
+			if got := Backoff(attempts, base, max); got < want || got > want*6/5 {
+				t.Errorf("Backoff(%d) = %s, want %s plus up to 20%%", attempts, got, want)
+			}
+		}
+	}
+}
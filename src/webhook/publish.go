@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"context"
+	"github.com/shoppinglist/db"
+	"github.com/shoppinglist/log"
+	"github.com/shoppinglist/models"
+	"time"
+)
+
+// Queue queues a delivery of the event for every webhook of its list that
+// subscribed to the event type. The deliveries are sent by the Dispatcher.
+func Queue(ctx context.Context, event *models.Event) error {
+	webhooksDB, err := db.NewWebhooksDB(ctx)
+	if err != nil {
+		return err
+	}
+	webhooks, err := webhooksDB.GetSubscribedWebhooks(ctx, event.List, event.Type)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	deliveriesDB, err := db.NewDeliveriesDB(ctx)
+	if err != nil {
+		return err
+	}
+	return queue(ctx, deliveriesDB, webhooks, event)
+}
+
+// queue queues a delivery of the event for each of the webhooks.
+func queue(ctx context.Context, deliveriesDB db.DeliveriesDB, webhooks []*models.WebhookWithID, event *models.Event) (err error) {
+	now := time.Now().UTC().UnixMilli()
+	for _, webhook := range webhooks {
+		_, err = deliveriesDB.UpsertDelivery(ctx, "", &models.Delivery{
+			Webhook:     webhook.ID,
+			List:        event.List,
+			Event:       event,
+			Status:      models.DeliveryPending,
+			NextAttempt: now,
+			Attempts:    []*models.DeliveryAttempt{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	log.Ctx(ctx).Info().Msgf("Event %s queued for %d webhooks", event.Type, len(webhooks))
+	return nil
+}